@@ -0,0 +1,473 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// charsetTable contains the runes of the bytes 0x80-0xff of a single-byte
+// charset, the bytes 0x00-0x7f are ASCII
+type charsetTable [128]rune
+
+// charsets are the supported single-byte charsets
+var charsets = map[string]*charsetTable{
+	"us-ascii":     &usASCII,
+	"iso-8859-1":   &iso88591,
+	"iso-8859-2":   &iso88592,
+	"iso-8859-5":   &iso88595,
+	"iso-8859-15":  &iso885915,
+	"windows-1250": &windows1250,
+	"windows-1251": &windows1251,
+	"windows-1252": &windows1252,
+	"koi8-r":       &koi8r,
+	"cp866":        &cp866,
+}
+
+// charsetAliases are the other names of the supported charsets
+var charsetAliases = map[string]string{
+	"latin1":      "iso-8859-1",
+	"l1":          "iso-8859-1",
+	"iso8859-1":   "iso-8859-1",
+	"iso_8859-1":  "iso-8859-1",
+	"ascii":       "us-ascii",
+	"iso646-us":   "us-ascii",
+	"latin2":      "iso-8859-2",
+	"l2":          "iso-8859-2",
+	"iso8859-2":   "iso-8859-2",
+	"iso_8859-2":  "iso-8859-2",
+	"iso8859-5":   "iso-8859-5",
+	"iso_8859-5":  "iso-8859-5",
+	"cyrillic":    "iso-8859-5",
+	"latin9":      "iso-8859-15",
+	"latin-9":     "iso-8859-15",
+	"iso8859-15":  "iso-8859-15",
+	"iso_8859-15": "iso-8859-15",
+	"cp1250":      "windows-1250",
+	"x-cp1250":    "windows-1250",
+	"cp1251":      "windows-1251",
+	"x-cp1251":    "windows-1251",
+	"cp1252":      "windows-1252",
+	"x-cp1252":    "windows-1252",
+	"koi8r":       "koi8-r",
+	"ibm866":      "cp866",
+	"866":         "cp866",
+}
+
+// lookupCharset returns the table of a single-byte charset, nil for UTF-8
+func lookupCharset(label string) (*charsetTable, error) {
+	name := strings.ToLower(strings.TrimSpace(label))
+	if name == "" || name == "utf-8" || name == "utf8" {
+		return nil, nil
+	}
+	if alias, found := charsetAliases[name]; found {
+		name = alias
+	}
+	if table, found := charsets[name]; found {
+		return table, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %s", label)
+}
+
+var charsetEncodersMutex sync.Mutex
+var charsetEncoders = map[*charsetTable]map[rune]byte{}
+
+func (t *charsetTable) encoder() map[rune]byte {
+	charsetEncodersMutex.Lock()
+	defer charsetEncodersMutex.Unlock()
+	if encoder, found := charsetEncoders[t]; found {
+		return encoder
+	}
+	encoder := map[rune]byte{}
+	for i, r := range t {
+		if r != utf8.RuneError {
+			encoder[r] = byte(0x80 + i)
+		}
+	}
+	charsetEncoders[t] = encoder
+	return encoder
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+var xmlDeclarationEncoding = regexp.MustCompile(`encoding\s*=\s*["']([^"']*)["']`)
+
+// declaredEncoding returns the encoding of the XML declaration at the start
+// of the document, empty if there is none
+func declaredEncoding(start []byte) string {
+	start = bytes.TrimPrefix(start, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(start, []byte("<?xml")) {
+		return ""
+	}
+	end := bytes.Index(start, []byte("?>"))
+	if end < 0 {
+		return ""
+	}
+	match := xmlDeclarationEncoding.FindSubmatch(start[:end])
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// newUTF8Reader returns a reader converting the document to UTF-8. UTF-16 is
+// detected by its byte order mark, single-byte charsets by the encoding of
+// the XML declaration.
+func newUTF8Reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(2)
+	if bytes.Equal(bom, []byte{0xff, 0xfe}) || bytes.Equal(bom, []byte{0xfe, 0xff}) {
+		br.Discard(2)
+		return &utf16Reader{r: br, bigEndian: bom[0] == 0xfe}, nil
+	}
+
+	// The XML declaration is short, the rest of the buffer is not needed:
+	start, _ := br.Peek(256)
+	encoding := declaredEncoding(start)
+	if strings.HasPrefix(strings.ToLower(encoding), "utf-16") {
+		return nil, errors.New("UTF-16 documents without a byte order mark are not supported")
+	}
+	table, err := lookupCharset(encoding)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return br, nil
+	}
+	return &charsetReader{r: br, table: table}, nil
+}
+
+// passCharsetReader is the xml.Decoder.CharsetReader for documents already
+// converted to UTF-8 by newUTF8Reader
+func passCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// charsetReader converts a single-byte charset to UTF-8
+type charsetReader struct {
+	r       io.Reader
+	table   *charsetTable
+	in      [512]byte
+	pending []byte
+	err     error
+}
+
+func (cr *charsetReader) Read(p []byte) (int, error) {
+	for len(cr.pending) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		var n int
+		n, cr.err = cr.r.Read(cr.in[:])
+		for _, b := range cr.in[:n] {
+			if b < 0x80 {
+				cr.pending = append(cr.pending, b)
+			} else {
+				cr.pending = appendRune(cr.pending, cr.table[b-0x80])
+			}
+		}
+	}
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	return n, nil
+}
+
+// utf16Reader converts UTF-16 (without the byte order mark) to UTF-8
+type utf16Reader struct {
+	r         io.Reader
+	bigEndian bool
+	in        [512]byte
+	// unread byte of an odd read
+	odd     []byte
+	units   []uint16
+	pending []byte
+	err     error
+}
+
+func (ur *utf16Reader) Read(p []byte) (int, error) {
+	for len(ur.pending) == 0 {
+		if ur.err != nil {
+			return 0, ur.err
+		}
+		n := copy(ur.in[:], ur.odd)
+		var read int
+		read, ur.err = ur.r.Read(ur.in[n:])
+		data := ur.in[:n+read]
+		for len(data) >= 2 {
+			if ur.bigEndian {
+				ur.units = append(ur.units, uint16(data[0])<<8|uint16(data[1]))
+			} else {
+				ur.units = append(ur.units, uint16(data[1])<<8|uint16(data[0]))
+			}
+			data = data[2:]
+		}
+		ur.odd = append(ur.odd[:0], data...)
+
+		// A high surrogate waits for the next unit:
+		complete := len(ur.units)
+		if complete > 0 && utf16.IsSurrogate(rune(ur.units[complete-1])) && ur.units[complete-1] < 0xdc00 && ur.err == nil {
+			complete--
+		}
+		for _, r := range utf16.Decode(ur.units[:complete]) {
+			ur.pending = appendRune(ur.pending, r)
+		}
+		ur.units = append(ur.units[:0], ur.units[complete:]...)
+	}
+	n := copy(p, ur.pending)
+	ur.pending = ur.pending[n:]
+	return n, nil
+}
+
+func appendRune(b []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(b, buf[:n]...)
+}
+
+// charsetWriter converts UTF-8 to a single-byte charset, runes which are not
+// available in the charset are written as XML character references
+type charsetWriter struct {
+	w       io.Writer
+	encoder map[rune]byte
+	// incomplete rune at the end of the last write
+	pending []byte
+}
+
+func newCharsetWriter(w io.Writer, table *charsetTable) *charsetWriter {
+	return &charsetWriter{w: w, encoder: table.encoder()}
+}
+
+func (cw *charsetWriter) Write(p []byte) (int, error) {
+	data := p
+	if len(cw.pending) > 0 {
+		data = append(cw.pending, p...)
+		cw.pending = nil
+	}
+	result := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		if data[0] < 0x80 {
+			result = append(result, data[0])
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			cw.pending = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		if b, found := cw.encoder[r]; found {
+			result = append(result, b)
+		} else {
+			result = append(result, fmt.Sprintf("&#%d;", r)...)
+		}
+		data = data[size:]
+	}
+	if _, err := cw.w.Write(result); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// usASCII is 7-bit ASCII, the bytes 0x80-0xff are invalid and all the other
+// runes are written as character references
+var usASCII = func() charsetTable {
+	var table charsetTable
+	for i := range table {
+		table[i] = utf8.RuneError
+	}
+	return table
+}()
+
+// iso88591 is iso-8859-1 (Western European Latin)
+var iso88591 = charsetTable{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008a, 0x008b, 0x008c, 0x008d, 0x008e, 0x008f,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009a, 0x009b, 0x009c, 0x009d, 0x009e, 0x009f,
+	0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7,
+	0x00a8, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+	0x00b8, 0x00b9, 0x00ba, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf,
+	0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+	0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+	0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+	0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+	0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+	0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+	0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+	0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+}
+
+// iso88592 is iso-8859-2 (Central European Latin)
+var iso88592 = charsetTable{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008a, 0x008b, 0x008c, 0x008d, 0x008e, 0x008f,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009a, 0x009b, 0x009c, 0x009d, 0x009e, 0x009f,
+	0x00a0, 0x0104, 0x02d8, 0x0141, 0x00a4, 0x013d, 0x015a, 0x00a7,
+	0x00a8, 0x0160, 0x015e, 0x0164, 0x0179, 0x00ad, 0x017d, 0x017b,
+	0x00b0, 0x0105, 0x02db, 0x0142, 0x00b4, 0x013e, 0x015b, 0x02c7,
+	0x00b8, 0x0161, 0x015f, 0x0165, 0x017a, 0x02dd, 0x017e, 0x017c,
+	0x0154, 0x00c1, 0x00c2, 0x0102, 0x00c4, 0x0139, 0x0106, 0x00c7,
+	0x010c, 0x00c9, 0x0118, 0x00cb, 0x011a, 0x00cd, 0x00ce, 0x010e,
+	0x0110, 0x0143, 0x0147, 0x00d3, 0x00d4, 0x0150, 0x00d6, 0x00d7,
+	0x0158, 0x016e, 0x00da, 0x0170, 0x00dc, 0x00dd, 0x0162, 0x00df,
+	0x0155, 0x00e1, 0x00e2, 0x0103, 0x00e4, 0x013a, 0x0107, 0x00e7,
+	0x010d, 0x00e9, 0x0119, 0x00eb, 0x011b, 0x00ed, 0x00ee, 0x010f,
+	0x0111, 0x0144, 0x0148, 0x00f3, 0x00f4, 0x0151, 0x00f6, 0x00f7,
+	0x0159, 0x016f, 0x00fa, 0x0171, 0x00fc, 0x00fd, 0x0163, 0x02d9,
+}
+
+// iso88595 is iso-8859-5 (Cyrillic)
+var iso88595 = charsetTable{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008a, 0x008b, 0x008c, 0x008d, 0x008e, 0x008f,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009a, 0x009b, 0x009c, 0x009d, 0x009e, 0x009f,
+	0x00a0, 0x0401, 0x0402, 0x0403, 0x0404, 0x0405, 0x0406, 0x0407,
+	0x0408, 0x0409, 0x040a, 0x040b, 0x040c, 0x00ad, 0x040e, 0x040f,
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041a, 0x041b, 0x041c, 0x041d, 0x041e, 0x041f,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042a, 0x042b, 0x042c, 0x042d, 0x042e, 0x042f,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043a, 0x043b, 0x043c, 0x043d, 0x043e, 0x043f,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044a, 0x044b, 0x044c, 0x044d, 0x044e, 0x044f,
+	0x2116, 0x0451, 0x0452, 0x0453, 0x0454, 0x0455, 0x0456, 0x0457,
+	0x0458, 0x0459, 0x045a, 0x045b, 0x045c, 0x00a7, 0x045e, 0x045f,
+}
+
+// iso885915 is iso-8859-15 (Western European Latin with the euro sign)
+var iso885915 = charsetTable{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008a, 0x008b, 0x008c, 0x008d, 0x008e, 0x008f,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009a, 0x009b, 0x009c, 0x009d, 0x009e, 0x009f,
+	0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x20ac, 0x00a5, 0x0160, 0x00a7,
+	0x0161, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x017d, 0x00b5, 0x00b6, 0x00b7,
+	0x017e, 0x00b9, 0x00ba, 0x00bb, 0x0152, 0x0153, 0x0178, 0x00bf,
+	0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+	0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+	0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+	0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+	0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+	0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+	0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+	0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+}
+
+// windows1250 is windows-1250 (Central European)
+var windows1250 = charsetTable{
+	0x20ac, 0xfffd, 0x201a, 0xfffd, 0x201e, 0x2026, 0x2020, 0x2021,
+	0xfffd, 0x2030, 0x0160, 0x2039, 0x015a, 0x0164, 0x017d, 0x0179,
+	0xfffd, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0xfffd, 0x2122, 0x0161, 0x203a, 0x015b, 0x0165, 0x017e, 0x017a,
+	0x00a0, 0x02c7, 0x02d8, 0x0141, 0x00a4, 0x0104, 0x00a6, 0x00a7,
+	0x00a8, 0x00a9, 0x015e, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x017b,
+	0x00b0, 0x00b1, 0x02db, 0x0142, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+	0x00b8, 0x0105, 0x015f, 0x00bb, 0x013d, 0x02dd, 0x013e, 0x017c,
+	0x0154, 0x00c1, 0x00c2, 0x0102, 0x00c4, 0x0139, 0x0106, 0x00c7,
+	0x010c, 0x00c9, 0x0118, 0x00cb, 0x011a, 0x00cd, 0x00ce, 0x010e,
+	0x0110, 0x0143, 0x0147, 0x00d3, 0x00d4, 0x0150, 0x00d6, 0x00d7,
+	0x0158, 0x016e, 0x00da, 0x0170, 0x00dc, 0x00dd, 0x0162, 0x00df,
+	0x0155, 0x00e1, 0x00e2, 0x0103, 0x00e4, 0x013a, 0x0107, 0x00e7,
+	0x010d, 0x00e9, 0x0119, 0x00eb, 0x011b, 0x00ed, 0x00ee, 0x010f,
+	0x0111, 0x0144, 0x0148, 0x00f3, 0x00f4, 0x0151, 0x00f6, 0x00f7,
+	0x0159, 0x016f, 0x00fa, 0x0171, 0x00fc, 0x00fd, 0x0163, 0x02d9,
+}
+
+// windows1251 is windows-1251 (Cyrillic)
+var windows1251 = charsetTable{
+	0x0402, 0x0403, 0x201a, 0x0453, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x20ac, 0x2030, 0x0409, 0x2039, 0x040a, 0x040c, 0x040b, 0x040f,
+	0x0452, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0xfffd, 0x2122, 0x0459, 0x203a, 0x045a, 0x045c, 0x045b, 0x045f,
+	0x00a0, 0x040e, 0x045e, 0x0408, 0x00a4, 0x0490, 0x00a6, 0x00a7,
+	0x0401, 0x00a9, 0x0404, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x0407,
+	0x00b0, 0x00b1, 0x0406, 0x0456, 0x0491, 0x00b5, 0x00b6, 0x00b7,
+	0x0451, 0x2116, 0x0454, 0x00bb, 0x0458, 0x0405, 0x0455, 0x0457,
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041a, 0x041b, 0x041c, 0x041d, 0x041e, 0x041f,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042a, 0x042b, 0x042c, 0x042d, 0x042e, 0x042f,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043a, 0x043b, 0x043c, 0x043d, 0x043e, 0x043f,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044a, 0x044b, 0x044c, 0x044d, 0x044e, 0x044f,
+}
+
+// windows1252 is windows-1252 (Western European)
+var windows1252 = charsetTable{
+	0x20ac, 0xfffd, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0xfffd, 0x017d, 0xfffd,
+	0xfffd, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0xfffd, 0x017e, 0x0178,
+	0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7,
+	0x00a8, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+	0x00b8, 0x00b9, 0x00ba, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf,
+	0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+	0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+	0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+	0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+	0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+	0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+	0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+	0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+}
+
+// koi8r is koi8-r (Russian Cyrillic)
+var koi8r = charsetTable{
+	0x2500, 0x2502, 0x250c, 0x2510, 0x2514, 0x2518, 0x251c, 0x2524,
+	0x252c, 0x2534, 0x253c, 0x2580, 0x2584, 0x2588, 0x258c, 0x2590,
+	0x2591, 0x2592, 0x2593, 0x2320, 0x25a0, 0x2219, 0x221a, 0x2248,
+	0x2264, 0x2265, 0x00a0, 0x2321, 0x00b0, 0x00b2, 0x00b7, 0x00f7,
+	0x2550, 0x2551, 0x2552, 0x0451, 0x2553, 0x2554, 0x2555, 0x2556,
+	0x2557, 0x2558, 0x2559, 0x255a, 0x255b, 0x255c, 0x255d, 0x255e,
+	0x255f, 0x2560, 0x2561, 0x0401, 0x2562, 0x2563, 0x2564, 0x2565,
+	0x2566, 0x2567, 0x2568, 0x2569, 0x256a, 0x256b, 0x256c, 0x00a9,
+	0x044e, 0x0430, 0x0431, 0x0446, 0x0434, 0x0435, 0x0444, 0x0433,
+	0x0445, 0x0438, 0x0439, 0x043a, 0x043b, 0x043c, 0x043d, 0x043e,
+	0x043f, 0x044f, 0x0440, 0x0441, 0x0442, 0x0443, 0x0436, 0x0432,
+	0x044c, 0x044b, 0x0437, 0x0448, 0x044d, 0x0449, 0x0447, 0x044a,
+	0x042e, 0x0410, 0x0411, 0x0426, 0x0414, 0x0415, 0x0424, 0x0413,
+	0x0425, 0x0418, 0x0419, 0x041a, 0x041b, 0x041c, 0x041d, 0x041e,
+	0x041f, 0x042f, 0x0420, 0x0421, 0x0422, 0x0423, 0x0416, 0x0412,
+	0x042c, 0x042b, 0x0417, 0x0428, 0x042d, 0x0429, 0x0427, 0x042a,
+}
+
+// cp866 is cp866 (DOS Cyrillic)
+var cp866 = charsetTable{
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041a, 0x041b, 0x041c, 0x041d, 0x041e, 0x041f,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042a, 0x042b, 0x042c, 0x042d, 0x042e, 0x042f,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043a, 0x043b, 0x043c, 0x043d, 0x043e, 0x043f,
+	0x2591, 0x2592, 0x2593, 0x2502, 0x2524, 0x2561, 0x2562, 0x2556,
+	0x2555, 0x2563, 0x2551, 0x2557, 0x255d, 0x255c, 0x255b, 0x2510,
+	0x2514, 0x2534, 0x252c, 0x251c, 0x2500, 0x253c, 0x255e, 0x255f,
+	0x255a, 0x2554, 0x2569, 0x2566, 0x2560, 0x2550, 0x256c, 0x2567,
+	0x2568, 0x2564, 0x2565, 0x2559, 0x2558, 0x2552, 0x2553, 0x256b,
+	0x256a, 0x2518, 0x250c, 0x2588, 0x2584, 0x258c, 0x2590, 0x2580,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044a, 0x044b, 0x044c, 0x044d, 0x044e, 0x044f,
+	0x0401, 0x0451, 0x0404, 0x0454, 0x0407, 0x0457, 0x040e, 0x045e,
+	0x00b0, 0x2219, 0x00b7, 0x221a, 0x2116, 0x00a4, 0x25a0, 0x00a0,
+}
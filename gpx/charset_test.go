@@ -0,0 +1,103 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf16"
+)
+
+func charsetTestGpx(encoding, name string) string {
+	return `<?xml version="1.0" encoding="` + encoding + `"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="test">
+<wpt lat="1" lon="2"><name>` + name + `</name></wpt>
+</gpx>`
+}
+
+func TestParseSingleByteCharsets(t *testing.T) {
+	for _, test := range []struct {
+		encoding string
+		name     string
+		expected string
+	}{
+		{"ISO-8859-1", "Caf\xe9", "Café"},
+		{"windows-1250", "\x8akofja Loka, \xe8", "Škofja Loka, č"},
+		{"ISO-8859-2", "\xa9kofja Loka", "Škofja Loka"},
+		{"windows-1251", "\xcc\xee\xf1\xea\xe2\xe0", "Москва"},
+		{"KOI8-R", "\xed\xcf\xd3\xcb\xd7\xc1", "Москва"},
+		{"iso-8859-15", "\xa4", "€"},
+		{"latin1", "\xfc", "ü"},
+	} {
+		g, err := ParseString(charsetTestGpx(test.encoding, test.name))
+		assertNil(t, err)
+		assertEquals(t, g.Waypoints[0].Name, test.expected)
+	}
+}
+
+func TestParseUTF16(t *testing.T) {
+	document := charsetTestGpx("UTF-16", "Škofja Loka 𝄞")
+	units := utf16.Encode([]rune(document))
+
+	little := []byte{0xff, 0xfe}
+	big := []byte{0xfe, 0xff}
+	for _, unit := range units {
+		little = append(little, byte(unit), byte(unit>>8))
+		big = append(big, byte(unit>>8), byte(unit))
+	}
+
+	for _, data := range [][]byte{little, big} {
+		g, err := ParseBytes(data)
+		assertNil(t, err)
+		assertEquals(t, g.Waypoints[0].Name, "Škofja Loka 𝄞")
+	}
+}
+
+func TestParseUnsupportedCharset(t *testing.T) {
+	_, err := ParseString(charsetTestGpx("EBCDIC", "a"))
+	parseError, ok := err.(*ParseError)
+	assertTrue(t, "*ParseError expected", ok)
+	assertEquals(t, parseError.Category, CharsetCategory)
+}
+
+func TestWriteCharset(t *testing.T) {
+	g := &GPX{}
+	g.AppendWaypoint(&GPXPoint{Name: "Škofja Loka, 東京"})
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1", Encoding: "windows-1250"})
+	assertNil(t, err)
+	assertTrue(t, "declaration", bytes.HasPrefix(xmlBytes, []byte(`<?xml version="1.0" encoding="windows-1250"?>`)))
+	assertTrue(t, "encoded name", bytes.Contains(xmlBytes, []byte("<name>\x8akofja Loka, &#26481;&#20140;</name>")))
+
+	parsed, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, parsed.Waypoints[0].Name, "Škofja Loka, 東京")
+
+	// ASCII has no runes above 0x7f
+	xmlBytes, err = g.ToXml(ToXmlParams{Version: "1.1", Encoding: "US-ASCII"})
+	assertNil(t, err)
+	assertTrue(t, "ascii name", bytes.Contains(xmlBytes, []byte("<name>&#352;kofja Loka, &#26481;&#20140;</name>")))
+	for _, b := range xmlBytes {
+		if b >= 0x80 {
+			t.Fatalf("Non ASCII byte %x", b)
+		}
+	}
+	parsed, err = ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, parsed.Waypoints[0].Name, "Škofja Loka, 東京")
+
+	_, err = g.ToXml(ToXmlParams{Encoding: "EBCDIC"})
+	assertTrue(t, "unsupported encoding", err != nil)
+}
+
+func TestCharsetWriterSplitRunes(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := newCharsetWriter(&buffer, charsets["iso-8859-2"])
+	for _, b := range []byte("ŠčŠ") {
+		writer.Write([]byte{b})
+	}
+	assertEquals(t, buffer.String(), "\xa9\xe8\xa9")
+}
@@ -5,18 +5,57 @@
 
 package gpx
 
-import (
-	"strings"
-)
-
 //defaultCreator contains the original repo path
 const defaultCreator = "https://github.com/tkrajina/gpxgo"
 
+// metadataBounds returns the bounds to be written, computed from the tracks
+// with ToXmlParams.WriteBounds (nil if there are no track points)
+func (g *GPX) metadataBounds(params ToXmlParams) *GpxBounds {
+	if !params.WriteBounds {
+		return g.DeclaredBounds
+	}
+	bounds := g.Bounds()
+	if bounds.MinLatitude > bounds.MaxLatitude {
+		return nil
+	}
+	return &bounds
+}
+
+// convertMagneticVariation returns the magnetic variation, null if out of
+// range
+func convertMagneticVariation(magVar NullableFloat64) NullableFloat64 {
+	if magVar.NotNull() && !validMagneticVariation(magVar.Value()) {
+		return NullableFloat64{}
+	}
+	return magVar
+}
+
+func validMagneticVariation(value float64) bool {
+	return 0 <= value && value < 360
+}
+
 // ----------------------------------------------------------------------------------------------------
 // Gpx 1.0 Stuff
 // ----------------------------------------------------------------------------------------------------
 
-func convertToGpx10Models(gpxDoc *GPX) *gpx10Gpx {
+// convertLinksToGpx10 returns url and urlname, GPX 1.0 supports only one link
+func convertLinksToGpx10(links []GPXLink) (string, string) {
+	if len(links) == 0 {
+		return "", ""
+	}
+	return links[0].Href, links[0].Text
+}
+
+func convertLinksFromGpx10(url, urlName string) []GPXLink {
+	if len(url) == 0 && len(urlName) == 0 {
+		return nil
+	}
+	return []GPXLink{{Href: url, Text: urlName}}
+}
+
+// convertMetadataToGpx10 converts the root element attributes and the document
+// header, waypoints, routes and tracks are written by the Encoder
+func convertMetadataToGpx10(gpxDoc *GPX, params ToXmlParams) *gpx10Gpx {
 	gpx10Doc := &gpx10Gpx{}
 
 	//gpx10Doc.XMLNs = gpxDoc.XMLNs
@@ -32,93 +71,60 @@ func convertToGpx10Models(gpxDoc *GPX) *gpx10Gpx {
 	}
 	gpx10Doc.Name = gpxDoc.Name
 	gpx10Doc.Desc = gpxDoc.Description
-	gpx10Doc.Author = gpxDoc.AuthorName
-	gpx10Doc.Email = gpxDoc.AuthorEmail
+	gpx10Doc.Author = gpxDoc.Author.getName()
+	gpx10Doc.Email = gpxDoc.Author.getEmail()
 
-	if len(gpxDoc.AuthorLink) > 0 || len(gpxDoc.AuthorLinkText) > 0 {
-		// TODO
-	}
-
-	if len(gpxDoc.Link) > 0 || len(gpxDoc.LinkText) > 0 {
-		gpx10Doc.Url = gpxDoc.Link
-		gpx10Doc.UrlName = gpxDoc.LinkText
-	}
+	gpx10Doc.Url, gpx10Doc.UrlName = convertLinksToGpx10(gpxDoc.Links)
 
 	if gpxDoc.Time != nil {
-		gpx10Doc.Time = formatGPXTime(gpxDoc.Time)
+		gpx10Doc.Time = formatGPXTime(gpxDoc.Time, params)
 	}
 
 	gpx10Doc.Keywords = gpxDoc.Keywords
 
-	if gpxDoc.Waypoints != nil {
-		gpx10Doc.Waypoints = make([]*gpx10GpxPoint, len(gpxDoc.Waypoints))
-		for waypointNo, waypoint := range gpxDoc.Waypoints {
-			gpx10Doc.Waypoints[waypointNo] = convertPointToGpx10(&waypoint)
-		}
+	if bounds := gpxDoc.metadataBounds(params); bounds != nil {
+		gpx10Doc.Bounds = &gpx10GpxBounds{MinLat: bounds.MinLatitude, MaxLat: bounds.MaxLatitude, MinLon: bounds.MinLongitude, MaxLon: bounds.MaxLongitude}
 	}
 
-	if gpxDoc.Routes != nil {
-		gpx10Doc.Routes = make([]*gpx10GpxRte, len(gpxDoc.Routes))
-		for routeNo, route := range gpxDoc.Routes {
-			r := new(gpx10GpxRte)
-			r.Name = route.Name
-			r.Cmt = route.Comment
-			r.Desc = route.Description
-			r.Src = route.Source
-			// TODO
-			//r.Links = route.Links
-			r.Number = route.Number
-			r.Type = route.Type
-			// TODO
-			//r.RoutePoints = route.RoutePoints
-
-			gpx10Doc.Routes[routeNo] = r
-
-			if route.Points != nil {
-				r.Points = make([]*gpx10GpxPoint, len(route.Points))
-				for pointNo, point := range route.Points {
-					r.Points[pointNo] = convertPointToGpx10(&point)
-				}
-			}
-		}
-	}
+	return gpx10Doc
+}
 
-	if gpxDoc.Tracks != nil {
-		gpx10Doc.Tracks = make([]*gpx10GpxTrk, len(gpxDoc.Tracks))
-		for trackNo, track := range gpxDoc.Tracks {
-			gpx10Track := new(gpx10GpxTrk)
-			gpx10Track.Name = track.Name
-			gpx10Track.Cmt = track.Comment
-			gpx10Track.Desc = track.Description
-			gpx10Track.Src = track.Source
-			gpx10Track.Number = track.Number
-			gpx10Track.Type = track.Type
-
-			if track.Segments != nil {
-				gpx10Track.Segments = make([]*gpx10GpxTrkSeg, len(track.Segments))
-				for segmentNo, segment := range track.Segments {
-					gpx10Segment := new(gpx10GpxTrkSeg)
-					if segment.Points != nil {
-						gpx10Segment.Points = make([]*gpx10GpxPoint, len(segment.Points))
-						for pointNo, point := range segment.Points {
-							gpx10Point := convertPointToGpx10(&point)
-							// TODO
-							//gpx10Point.Speed = point.Speed
-							//gpx10Point.Speed = point.Speed
-							gpx10Segment.Points[pointNo] = gpx10Point
-						}
-					}
-					gpx10Track.Segments[segmentNo] = gpx10Segment
-				}
-			}
-			gpx10Doc.Tracks[trackNo] = gpx10Track
+func convertRouteToGpx10(route *GPXRoute, params ToXmlParams) *gpx10GpxRte {
+	r := new(gpx10GpxRte)
+	r.Name = route.Name
+	r.Cmt = route.Comment
+	r.Desc = route.Description
+	r.Src = route.Source
+	r.Url, r.UrlName = convertLinksToGpx10(route.Links)
+	r.Number = route.Number
+	r.Type = route.Type
+	// TODO
+	//r.RoutePoints = route.RoutePoints
+
+	if route.Points != nil {
+		r.Points = make([]*gpx10GpxPoint, len(route.Points))
+		for pointNo, point := range route.Points {
+			r.Points[pointNo] = convertPointToGpx10(&point, params)
 		}
 	}
 
-	return gpx10Doc
+	return r
 }
 
-func convertFromGpx10Models(gpx10Doc *gpx10Gpx) *GPX {
+// convertTrackToGpx10 converts only the track header, segments are written by the Encoder
+func convertTrackToGpx10(track *GPXTrack) *gpx10GpxTrk {
+	gpx10Track := new(gpx10GpxTrk)
+	gpx10Track.Name = track.Name
+	gpx10Track.Cmt = track.Comment
+	gpx10Track.Desc = track.Description
+	gpx10Track.Src = track.Source
+	gpx10Track.Url, gpx10Track.UrlName = convertLinksToGpx10(track.Links)
+	gpx10Track.Number = track.Number
+	gpx10Track.Type = track.Type
+	return gpx10Track
+}
+
+func convertFromGpx10Models(gpx10Doc *gpx10Gpx, opts ParseOptions) *GPX {
 	gpxDoc := new(GPX)
 
 	gpxDoc.XMLNs = gpx10Doc.XMLNs
@@ -129,24 +135,26 @@ func convertFromGpx10Models(gpx10Doc *gpx10Gpx) *GPX {
 	gpxDoc.Version = gpx10Doc.Version
 	gpxDoc.Name = gpx10Doc.Name
 	gpxDoc.Description = gpx10Doc.Desc
-	gpxDoc.AuthorName = gpx10Doc.Author
-	gpxDoc.AuthorEmail = gpx10Doc.Email
-
-	if len(gpx10Doc.Url) > 0 || len(gpx10Doc.UrlName) > 0 {
-		gpxDoc.Link = gpx10Doc.Url
-		gpxDoc.LinkText = gpx10Doc.UrlName
+	if len(gpx10Doc.Author) > 0 || len(gpx10Doc.Email) > 0 {
+		gpxDoc.Author = &Person{Name: gpx10Doc.Author, Email: ParseEmail(gpx10Doc.Email)}
 	}
 
+	gpxDoc.Links = convertLinksFromGpx10(gpx10Doc.Url, gpx10Doc.UrlName)
+
 	if len(gpx10Doc.Time) > 0 {
-		gpxDoc.Time, _ = parseGPXTime(gpx10Doc.Time)
+		gpxDoc.Time, _ = parseGPXTime(gpx10Doc.Time, opts.DefaultLocation)
 	}
 
 	gpxDoc.Keywords = gpx10Doc.Keywords
 
+	if gpx10Doc.Bounds != nil {
+		gpxDoc.DeclaredBounds = &GpxBounds{MinLatitude: gpx10Doc.Bounds.MinLat, MaxLatitude: gpx10Doc.Bounds.MaxLat, MinLongitude: gpx10Doc.Bounds.MinLon, MaxLongitude: gpx10Doc.Bounds.MaxLon}
+	}
+
 	if gpx10Doc.Waypoints != nil {
 		waypoints := make([]GPXPoint, len(gpx10Doc.Waypoints))
 		for waypointNo, waypoint := range gpx10Doc.Waypoints {
-			waypoints[waypointNo] = *convertPointFromGpx10(waypoint)
+			waypoints[waypointNo] = *convertPointFromGpx10(waypoint, opts)
 		}
 		gpxDoc.Waypoints = waypoints
 	}
@@ -154,78 +162,90 @@ func convertFromGpx10Models(gpx10Doc *gpx10Gpx) *GPX {
 	if gpx10Doc.Routes != nil {
 		gpxDoc.Routes = make([]GPXRoute, len(gpx10Doc.Routes))
 		for routeNo, route := range gpx10Doc.Routes {
-			r := new(GPXRoute)
-
-			r.Name = route.Name
-			r.Comment = route.Cmt
-			r.Description = route.Desc
-			r.Source = route.Src
-			// TODO
-			//r.Links = route.Links
-			r.Number = route.Number
-			r.Type = route.Type
-			// TODO
-			//r.RoutePoints = route.RoutePoints
-
-			if route.Points != nil {
-				r.Points = make([]GPXPoint, len(route.Points))
-				for pointNo, point := range route.Points {
-					r.Points[pointNo] = *convertPointFromGpx10(point)
-				}
-			}
-
-			gpxDoc.Routes[routeNo] = *r
+			gpxDoc.Routes[routeNo] = *convertRouteFromGpx10(route, opts)
 		}
 	}
 
 	if gpx10Doc.Tracks != nil {
 		gpxDoc.Tracks = make([]GPXTrack, len(gpx10Doc.Tracks))
 		for trackNo, track := range gpx10Doc.Tracks {
-			gpxTrack := new(GPXTrack)
-			gpxTrack.Name = track.Name
-			gpxTrack.Comment = track.Cmt
-			gpxTrack.Description = track.Desc
-			gpxTrack.Source = track.Src
-			gpxTrack.Number = track.Number
-			gpxTrack.Type = track.Type
-
-			if track.Segments != nil {
-				gpxTrack.Segments = make([]GPXTrackSegment, len(track.Segments))
-				for segmentNo, segment := range track.Segments {
-					gpxSegment := GPXTrackSegment{}
-					if segment.Points != nil {
-						gpxSegment.Points = make([]GPXPoint, len(segment.Points))
-						for pointNo, point := range segment.Points {
-							gpxSegment.Points[pointNo] = *convertPointFromGpx10(point)
-						}
-					}
-					gpxTrack.Segments[segmentNo] = gpxSegment
+			gpxDoc.Tracks[trackNo] = *convertTrackFromGpx10(track, opts)
+		}
+	}
+
+	return gpxDoc
+}
+
+func convertRouteFromGpx10(route *gpx10GpxRte, opts ParseOptions) *GPXRoute {
+	r := new(GPXRoute)
+
+	r.Name = route.Name
+	r.Comment = route.Cmt
+	r.Description = route.Desc
+	r.Source = route.Src
+	r.Links = convertLinksFromGpx10(route.Url, route.UrlName)
+	r.Number = route.Number
+	r.Type = route.Type
+	// TODO
+	//r.RoutePoints = route.RoutePoints
+
+	if route.Points != nil {
+		r.Points = make([]GPXPoint, len(route.Points))
+		for pointNo, point := range route.Points {
+			r.Points[pointNo] = *convertPointFromGpx10(point, opts)
+		}
+	}
+
+	return r
+}
+
+// convertTrackFromGpx10 converts the track with all its segments, for a track
+// without segments only the track header fields are filled
+func convertTrackFromGpx10(track *gpx10GpxTrk, opts ParseOptions) *GPXTrack {
+	gpxTrack := new(GPXTrack)
+	gpxTrack.Name = track.Name
+	gpxTrack.Comment = track.Cmt
+	gpxTrack.Description = track.Desc
+	gpxTrack.Source = track.Src
+	gpxTrack.Links = convertLinksFromGpx10(track.Url, track.UrlName)
+	gpxTrack.Number = track.Number
+	gpxTrack.Type = track.Type
+
+	if track.Segments != nil {
+		gpxTrack.Segments = make([]GPXTrackSegment, len(track.Segments))
+		for segmentNo, segment := range track.Segments {
+			gpxSegment := GPXTrackSegment{}
+			if segment.Points != nil {
+				gpxSegment.Points = make([]GPXPoint, len(segment.Points))
+				for pointNo, point := range segment.Points {
+					gpxSegment.Points[pointNo] = *convertPointFromGpx10(point, opts)
 				}
 			}
-			gpxDoc.Tracks[trackNo] = *gpxTrack
+			gpxTrack.Segments[segmentNo] = gpxSegment
 		}
 	}
 
-	return gpxDoc
+	return gpxTrack
 }
 
-func convertPointToGpx10(original *GPXPoint) *gpx10GpxPoint {
+func convertPointToGpx10(original *GPXPoint, params ToXmlParams) *gpx10GpxPoint {
 	result := new(gpx10GpxPoint)
 	result.Lat = original.Latitude
 	result.Lon = original.Longitude
 	result.Ele = original.Elevation
-	result.Timestamp = formatGPXTime(&original.Timestamp)
+	result.Timestamp = formatGPXTime(&original.Timestamp, params)
+	result.Course = original.Course
+	result.Speed = original.Speed
 	result.MagVar = original.MagneticVariation
 	result.GeoIdHeight = original.GeoidHeight
 	result.Name = original.Name
 	result.Cmt = original.Comment
 	result.Desc = original.Description
 	result.Src = original.Source
-	// TODO
-	//w.Links = original.Links
+	result.Url, result.UrlName = convertLinksToGpx10(original.Links)
 	result.Sym = original.Symbol
 	result.Type = original.Type
-	result.Fix = original.TypeOfGpsFix
+	result.Fix = original.TypeOfGpsFix.String()
 	if original.Satellites.NotNull() {
 		value := original.Satellites.Value()
 		result.Sat = &value
@@ -253,26 +273,27 @@ func convertPointToGpx10(original *GPXPoint) *gpx10GpxPoint {
 	return result
 }
 
-func convertPointFromGpx10(original *gpx10GpxPoint) *GPXPoint {
+func convertPointFromGpx10(original *gpx10GpxPoint, opts ParseOptions) *GPXPoint {
 	result := new(GPXPoint)
 	result.Latitude = original.Lat
 	result.Longitude = original.Lon
 	result.Elevation = original.Ele
-	time, _ := parseGPXTime(original.Timestamp)
+	time, _ := parseGPXTime(original.Timestamp, opts.DefaultLocation)
 	if time != nil {
 		result.Timestamp = *time
 	}
-	result.MagneticVariation = original.MagVar
+	result.Course = original.Course
+	result.Speed = original.Speed
+	result.MagneticVariation = convertMagneticVariation(original.MagVar)
 	result.GeoidHeight = original.GeoIdHeight
 	result.Name = original.Name
 	result.Comment = original.Cmt
 	result.Description = original.Desc
 	result.Source = original.Src
-	// TODO
-	//w.Links = original.Links
+	result.Links = convertLinksFromGpx10(original.Url, original.UrlName)
 	result.Symbol = original.Sym
 	result.Type = original.Type
-	result.TypeOfGpsFix = original.Fix
+	result.TypeOfGpsFix, _ = ParseFixType(original.Fix)
 	if original.Sat != nil {
 		result.Satellites = *NewNullableInt(*original.Sat)
 	}
@@ -298,7 +319,31 @@ func convertPointFromGpx10(original *gpx10GpxPoint) *GPXPoint {
 // Gpx 1.1 Stuff
 // ----------------------------------------------------------------------------------------------------
 
-func convertToGpx11Models(gpxDoc *GPX) *gpx11Gpx {
+func convertLinksToGpx11(links []GPXLink) []gpx11GpxLink {
+	if len(links) == 0 {
+		return nil
+	}
+	result := make([]gpx11GpxLink, len(links))
+	for linkNo, link := range links {
+		result[linkNo] = gpx11GpxLink{Href: link.Href, Text: link.Text, Type: link.Type}
+	}
+	return result
+}
+
+func convertLinksFromGpx11(links []gpx11GpxLink) []GPXLink {
+	if len(links) == 0 {
+		return nil
+	}
+	result := make([]GPXLink, len(links))
+	for linkNo, link := range links {
+		result[linkNo] = GPXLink{Href: link.Href, Text: link.Text, Type: link.Type}
+	}
+	return result
+}
+
+// convertMetadataToGpx11 converts the root element attributes and the document
+// metadata, waypoints, routes and tracks are written by the Encoder
+func convertMetadataToGpx11(gpxDoc *GPX, ns *namespacePrefixes, params ToXmlParams) *gpx11Gpx {
 	gpx11Doc := &gpx11Gpx{}
 
 	gpx11Doc.Version = "1.1"
@@ -312,114 +357,76 @@ func convertToGpx11Models(gpxDoc *GPX) *gpx11Gpx {
 	} else {
 		gpx11Doc.Creator = gpxDoc.Creator
 	}
-	gpx11Doc.Name = gpxDoc.Name
-	gpx11Doc.Desc = gpxDoc.Description
-	gpx11Doc.AuthorName = gpxDoc.AuthorName
-
-	if len(gpxDoc.AuthorEmail) > 0 {
-		parts := strings.Split(gpxDoc.AuthorEmail, "@")
-		if len(parts) == 1 {
-			gpx11Doc.AuthorEmail = new(gpx11GpxEmail)
-			gpx11Doc.AuthorEmail.Id = parts[0]
-		} else if len(parts) > 1 {
-			gpx11Doc.AuthorEmail = new(gpx11GpxEmail)
-			gpx11Doc.AuthorEmail.Id = parts[0]
-			gpx11Doc.AuthorEmail.Domain = parts[1]
+	gpx11Doc.Metadata.Name = gpxDoc.Name
+	gpx11Doc.Metadata.Desc = gpxDoc.Description
+
+	if author := gpxDoc.Author; author != nil {
+		gpx11Doc.Metadata.Author = &gpx11GpxPerson{Name: author.Name}
+		if author.Email != nil {
+			gpx11Doc.Metadata.Author.Email = &gpx11GpxEmail{Id: author.Email.ID, Domain: author.Email.Domain}
+		}
+		if author.Link != nil {
+			gpx11Doc.Metadata.Author.Link = &gpx11GpxLink{Href: author.Link.Href, Text: author.Link.Text, Type: author.Link.Type}
 		}
 	}
 
-	if len(gpxDoc.AuthorLink) > 0 || len(gpxDoc.AuthorLinkText) > 0 || len(gpxDoc.AuthorLinkType) > 0 {
-		gpx11Doc.AuthorLink = new(gpx11GpxLink)
-		gpx11Doc.AuthorLink.Href = gpxDoc.AuthorLink
-		gpx11Doc.AuthorLink.Text = gpxDoc.AuthorLinkText
-		gpx11Doc.AuthorLink.Type = gpxDoc.AuthorLinkType
+	if copyright := gpxDoc.Copyright; copyright != nil {
+		gpx11Doc.Metadata.Copyright = &gpx11GpxCopyright{Author: copyright.Author, Year: copyright.Year, License: copyright.License}
 	}
 
-	if len(gpxDoc.Copyright) > 0 || len(gpxDoc.CopyrightYear) > 0 || len(gpxDoc.CopyrightLicense) > 0 {
-		gpx11Doc.Copyright = new(gpx11GpxCopyright)
-		gpx11Doc.Copyright.Author = gpxDoc.Copyright
-		gpx11Doc.Copyright.Year = gpxDoc.CopyrightYear
-		gpx11Doc.Copyright.License = gpxDoc.CopyrightLicense
-	}
+	gpx11Doc.Metadata.Links = convertLinksToGpx11(gpxDoc.Links)
 
-	if len(gpxDoc.Link) > 0 || len(gpxDoc.LinkText) > 0 || len(gpxDoc.LinkType) > 0 {
-		gpx11Doc.Link = new(gpx11GpxLink)
-		gpx11Doc.Link.Href = gpxDoc.Link
-		gpx11Doc.Link.Text = gpxDoc.LinkText
-		gpx11Doc.Link.Type = gpxDoc.LinkType
+	if gpxDoc.Time != nil {
+		gpx11Doc.Metadata.Timestamp = formatGPXTime(gpxDoc.Time, params)
 	}
 
-	if gpxDoc.Time != nil {
-		gpx11Doc.Timestamp = formatGPXTime(gpxDoc.Time)
+	gpx11Doc.Metadata.Keywords = gpxDoc.Keywords
+	if bounds := gpxDoc.metadataBounds(params); bounds != nil {
+		gpx11Doc.Metadata.Bounds = &gpx11GpxBounds{MinLat: bounds.MinLatitude, MaxLat: bounds.MaxLatitude, MinLon: bounds.MinLongitude, MaxLon: bounds.MaxLongitude}
 	}
+	gpx11Doc.Metadata.Extensions = ns.toGpx11(&gpxDoc.MetadataExtensions)
 
-	gpx11Doc.Keywords = gpxDoc.Keywords
+	return gpx11Doc
+}
 
-	if gpxDoc.Waypoints != nil {
-		gpx11Doc.Waypoints = make([]*gpx11GpxPoint, len(gpxDoc.Waypoints))
-		for waypointNo, waypoint := range gpxDoc.Waypoints {
-			gpx11Doc.Waypoints[waypointNo] = convertPointToGpx11(&waypoint)
-		}
-	}
+func convertRouteToGpx11(route *GPXRoute, ns *namespacePrefixes, params ToXmlParams) *gpx11GpxRte {
+	r := new(gpx11GpxRte)
+	r.Name = route.Name
+	r.Cmt = route.Comment
+	r.Desc = route.Description
+	r.Src = route.Source
+	r.Links = convertLinksToGpx11(route.Links)
+	r.Number = route.Number
+	r.Type = route.Type
+	r.Extensions = ns.toGpx11(route.allExtensions())
+	// TODO
+	//r.RoutePoints = route.RoutePoints
 
-	if gpxDoc.Routes != nil {
-		gpx11Doc.Routes = make([]*gpx11GpxRte, len(gpxDoc.Routes))
-		for routeNo, route := range gpxDoc.Routes {
-			r := new(gpx11GpxRte)
-			r.Name = route.Name
-			r.Cmt = route.Comment
-			r.Desc = route.Description
-			r.Src = route.Source
-			// TODO
-			//r.Links = route.Links
-			r.Number = route.Number
-			r.Type = route.Type
-			// TODO
-			//r.RoutePoints = route.RoutePoints
-
-			gpx11Doc.Routes[routeNo] = r
-
-			if route.Points != nil {
-				r.Points = make([]*gpx11GpxPoint, len(route.Points))
-				for pointNo, point := range route.Points {
-					r.Points[pointNo] = convertPointToGpx11(&point)
-				}
-			}
+	if route.Points != nil {
+		r.Points = make([]*gpx11GpxPoint, len(route.Points))
+		for pointNo, point := range route.Points {
+			r.Points[pointNo] = convertPointToGpx11(&point, ns, params)
 		}
 	}
 
-	if gpxDoc.Tracks != nil {
-		gpx11Doc.Tracks = make([]*gpx11GpxTrk, len(gpxDoc.Tracks))
-		for trackNo, track := range gpxDoc.Tracks {
-			gpx11Track := new(gpx11GpxTrk)
-			gpx11Track.Name = track.Name
-			gpx11Track.Cmt = track.Comment
-			gpx11Track.Desc = track.Description
-			gpx11Track.Src = track.Source
-			gpx11Track.Number = track.Number
-			gpx11Track.Type = track.Type
-
-			if track.Segments != nil {
-				gpx11Track.Segments = make([]*gpx11GpxTrkSeg, len(track.Segments))
-				for segmentNo, segment := range track.Segments {
-					gpx11Segment := new(gpx11GpxTrkSeg)
-					if segment.Points != nil {
-						gpx11Segment.Points = make([]*gpx11GpxPoint, len(segment.Points))
-						for pointNo, point := range segment.Points {
-							gpx11Segment.Points[pointNo] = convertPointToGpx11(&point)
-						}
-					}
-					gpx11Track.Segments[segmentNo] = gpx11Segment
-				}
-			}
-			gpx11Doc.Tracks[trackNo] = gpx11Track
-		}
-	}
+	return r
+}
 
-	return gpx11Doc
+// convertTrackToGpx11 converts only the track header, segments are written by the Encoder
+func convertTrackToGpx11(track *GPXTrack, ns *namespacePrefixes) *gpx11GpxTrk {
+	gpx11Track := new(gpx11GpxTrk)
+	gpx11Track.Name = track.Name
+	gpx11Track.Cmt = track.Comment
+	gpx11Track.Desc = track.Description
+	gpx11Track.Src = track.Source
+	gpx11Track.Links = convertLinksToGpx11(track.Links)
+	gpx11Track.Number = track.Number
+	gpx11Track.Type = track.Type
+	gpx11Track.Extensions = ns.toGpx11(track.allExtensions())
+	return gpx11Track
 }
 
-func convertFromGpx11Models(gpx11Doc *gpx11Gpx) *GPX {
+func convertFromGpx11Models(gpx11Doc *gpx11Gpx, opts ParseOptions) *GPX {
 	gpxDoc := new(GPX)
 
 	gpxDoc.XMLNs = gpx11Doc.XMLNs
@@ -428,47 +435,49 @@ func convertFromGpx11Models(gpx11Doc *gpx11Gpx) *GPX {
 
 	gpxDoc.Creator = gpx11Doc.Creator
 	gpxDoc.Version = gpx11Doc.Version
-	gpxDoc.Name = gpx11Doc.Name
-	gpxDoc.Description = gpx11Doc.Desc
-	gpxDoc.AuthorName = gpx11Doc.AuthorName
+	gpxDoc.Name = gpx11Doc.Metadata.Name
+	gpxDoc.Description = gpx11Doc.Metadata.Desc
 
-	if gpx11Doc.AuthorEmail != nil {
-		gpxDoc.AuthorEmail = gpx11Doc.AuthorEmail.Id + "@" + gpx11Doc.AuthorEmail.Domain
-	}
-	if gpx11Doc.AuthorLink != nil {
-		gpxDoc.AuthorLink = gpx11Doc.AuthorLink.Href
-		gpxDoc.AuthorLinkText = gpx11Doc.AuthorLink.Text
-		gpxDoc.AuthorLinkType = gpx11Doc.AuthorLink.Type
+	if author := gpx11Doc.Metadata.Author; author != nil {
+		gpxDoc.Author = &Person{Name: author.Name}
+		if author.Email != nil {
+			gpxDoc.Author.Email = &Email{ID: author.Email.Id, Domain: author.Email.Domain}
+		}
+		if author.Link != nil {
+			gpxDoc.Author.Link = &GPXLink{Href: author.Link.Href, Text: author.Link.Text, Type: author.Link.Type}
+		}
 	}
 
-	/* TODO
-	if gpx11Doc.Extensions != nil {
-		gpxDoc.Extensions = &gpx11Doc.Extensions.Bytes
+	for _, attr := range gpx11Doc.Attrs {
+		if attr.Name.Space == "xmlns" && attr.Name.Local != "xsi" {
+			if gpxDoc.Namespaces == nil {
+				gpxDoc.Namespaces = map[string]string{}
+			}
+			gpxDoc.Namespaces[attr.Name.Local] = attr.Value
+		}
 	}
-	*/
 
-	if len(gpx11Doc.Timestamp) > 0 {
-		gpxDoc.Time, _ = parseGPXTime(gpx11Doc.Timestamp)
+	if len(gpx11Doc.Metadata.Timestamp) > 0 {
+		gpxDoc.Time, _ = parseGPXTime(gpx11Doc.Metadata.Timestamp, opts.DefaultLocation)
 	}
 
-	if gpx11Doc.Copyright != nil {
-		gpxDoc.Copyright = gpx11Doc.Copyright.Author
-		gpxDoc.CopyrightYear = gpx11Doc.Copyright.Year
-		gpxDoc.CopyrightLicense = gpx11Doc.Copyright.License
+	if copyright := gpx11Doc.Metadata.Copyright; copyright != nil {
+		gpxDoc.Copyright = &Copyright{Author: copyright.Author, Year: copyright.Year, License: copyright.License}
 	}
 
-	if gpx11Doc.Link != nil {
-		gpxDoc.Link = gpx11Doc.Link.Href
-		gpxDoc.LinkText = gpx11Doc.Link.Text
-		gpxDoc.LinkType = gpx11Doc.Link.Type
-	}
+	gpxDoc.Links = convertLinksFromGpx11(gpx11Doc.Metadata.Links)
 
-	gpxDoc.Keywords = gpx11Doc.Keywords
+	gpxDoc.Keywords = gpx11Doc.Metadata.Keywords
+	if bounds := gpx11Doc.Metadata.Bounds; bounds != nil {
+		gpxDoc.DeclaredBounds = &GpxBounds{MinLatitude: bounds.MinLat, MaxLatitude: bounds.MaxLat, MinLongitude: bounds.MinLon, MaxLongitude: bounds.MaxLon}
+	}
+	gpxDoc.MetadataExtensions = convertExtensionFromGpx11(gpx11Doc.Metadata.Extensions)
+	gpxDoc.Extensions = convertExtensionFromGpx11(gpx11Doc.Extensions)
 
 	if gpx11Doc.Waypoints != nil {
 		waypoints := make([]GPXPoint, len(gpx11Doc.Waypoints))
 		for waypointNo, waypoint := range gpx11Doc.Waypoints {
-			waypoints[waypointNo] = *convertPointFromGpx11(waypoint)
+			waypoints[waypointNo] = *convertPointFromGpx11(waypoint, opts)
 		}
 		gpxDoc.Waypoints = waypoints
 	}
@@ -476,78 +485,93 @@ func convertFromGpx11Models(gpx11Doc *gpx11Gpx) *GPX {
 	if gpx11Doc.Routes != nil {
 		gpxDoc.Routes = make([]GPXRoute, len(gpx11Doc.Routes))
 		for routeNo, route := range gpx11Doc.Routes {
-			r := new(GPXRoute)
-
-			r.Name = route.Name
-			r.Comment = route.Cmt
-			r.Description = route.Desc
-			r.Source = route.Src
-			// TODO
-			//r.Links = route.Links
-			r.Number = route.Number
-			r.Type = route.Type
-			// TODO
-			//r.RoutePoints = route.RoutePoints
-
-			if route.Points != nil {
-				r.Points = make([]GPXPoint, len(route.Points))
-				for pointNo, point := range route.Points {
-					r.Points[pointNo] = *convertPointFromGpx11(point)
-				}
-			}
-
-			gpxDoc.Routes[routeNo] = *r
+			gpxDoc.Routes[routeNo] = *convertRouteFromGpx11(route, opts)
 		}
 	}
 
 	if gpx11Doc.Tracks != nil {
 		gpxDoc.Tracks = make([]GPXTrack, len(gpx11Doc.Tracks))
 		for trackNo, track := range gpx11Doc.Tracks {
-			gpxTrack := new(GPXTrack)
-			gpxTrack.Name = track.Name
-			gpxTrack.Comment = track.Cmt
-			gpxTrack.Description = track.Desc
-			gpxTrack.Source = track.Src
-			gpxTrack.Number = track.Number
-			gpxTrack.Type = track.Type
-
-			if track.Segments != nil {
-				gpxTrack.Segments = make([]GPXTrackSegment, len(track.Segments))
-				for segmentNo, segment := range track.Segments {
-					gpxSegment := GPXTrackSegment{}
-					if segment.Points != nil {
-						gpxSegment.Points = make([]GPXPoint, len(segment.Points))
-						for pointNo, point := range segment.Points {
-							gpxSegment.Points[pointNo] = *convertPointFromGpx11(point)
-						}
-					}
-					gpxTrack.Segments[segmentNo] = gpxSegment
+			gpxDoc.Tracks[trackNo] = *convertTrackFromGpx11(track, opts)
+		}
+	}
+
+	return gpxDoc
+}
+
+func convertRouteFromGpx11(route *gpx11GpxRte, opts ParseOptions) *GPXRoute {
+	r := new(GPXRoute)
+
+	r.Name = route.Name
+	r.Comment = route.Cmt
+	r.Description = route.Desc
+	r.Source = route.Src
+	r.Links = convertLinksFromGpx11(route.Links)
+	r.Number = route.Number
+	r.Type = route.Type
+	r.Extensions = convertExtensionFromGpx11(route.Extensions)
+	r.readTypedExtensions()
+	// TODO
+	//r.RoutePoints = route.RoutePoints
+
+	if route.Points != nil {
+		r.Points = make([]GPXPoint, len(route.Points))
+		for pointNo, point := range route.Points {
+			r.Points[pointNo] = *convertPointFromGpx11(point, opts)
+		}
+	}
+
+	return r
+}
+
+// convertTrackFromGpx11 converts the track with all its segments, for a track
+// without segments only the track header fields are filled
+func convertTrackFromGpx11(track *gpx11GpxTrk, opts ParseOptions) *GPXTrack {
+	gpxTrack := new(GPXTrack)
+	gpxTrack.Name = track.Name
+	gpxTrack.Comment = track.Cmt
+	gpxTrack.Description = track.Desc
+	gpxTrack.Source = track.Src
+	gpxTrack.Links = convertLinksFromGpx11(track.Links)
+	gpxTrack.Number = track.Number
+	gpxTrack.Type = track.Type
+	gpxTrack.Extensions = convertExtensionFromGpx11(track.Extensions)
+	gpxTrack.readTypedExtensions()
+
+	if track.Segments != nil {
+		gpxTrack.Segments = make([]GPXTrackSegment, len(track.Segments))
+		for segmentNo, segment := range track.Segments {
+			gpxSegment := GPXTrackSegment{}
+			gpxSegment.Extensions = convertExtensionFromGpx11(segment.Extensions)
+			if segment.Points != nil {
+				gpxSegment.Points = make([]GPXPoint, len(segment.Points))
+				for pointNo, point := range segment.Points {
+					gpxSegment.Points[pointNo] = *convertPointFromGpx11(point, opts)
 				}
 			}
-			gpxDoc.Tracks[trackNo] = *gpxTrack
+			gpxTrack.Segments[segmentNo] = gpxSegment
 		}
 	}
 
-	return gpxDoc
+	return gpxTrack
 }
 
-func convertPointToGpx11(original *GPXPoint) *gpx11GpxPoint {
+func convertPointToGpx11(original *GPXPoint, ns *namespacePrefixes, params ToXmlParams) *gpx11GpxPoint {
 	result := new(gpx11GpxPoint)
 	result.Lat = original.Latitude
 	result.Lon = original.Longitude
 	result.Ele = original.Elevation
-	result.Timestamp = formatGPXTime(&original.Timestamp)
+	result.Timestamp = formatGPXTime(&original.Timestamp, params)
 	result.MagVar = original.MagneticVariation
 	result.GeoIdHeight = original.GeoidHeight
 	result.Name = original.Name
 	result.Cmt = original.Comment
 	result.Desc = original.Description
 	result.Src = original.Source
-	// TODO
-	//w.Links = original.Links
+	result.Links = convertLinksToGpx11(original.Links)
 	result.Sym = original.Symbol
 	result.Type = original.Type
-	result.Fix = original.TypeOfGpsFix
+	result.Fix = original.TypeOfGpsFix.String()
 	if original.Satellites.NotNull() {
 		value := original.Satellites.Value()
 		result.Sat = &value
@@ -572,29 +596,29 @@ func convertPointToGpx11(original *GPXPoint) *gpx11GpxPoint {
 		value := original.DGpsId.Value()
 		result.DGpsId = &value
 	}
+	result.Extensions = ns.toGpx11(original.allExtensions())
 	return result
 }
 
-func convertPointFromGpx11(original *gpx11GpxPoint) *GPXPoint {
+func convertPointFromGpx11(original *gpx11GpxPoint, opts ParseOptions) *GPXPoint {
 	result := new(GPXPoint)
 	result.Latitude = original.Lat
 	result.Longitude = original.Lon
 	result.Elevation = original.Ele
-	time, _ := parseGPXTime(original.Timestamp)
+	time, _ := parseGPXTime(original.Timestamp, opts.DefaultLocation)
 	if time != nil {
 		result.Timestamp = *time
 	}
-	result.MagneticVariation = original.MagVar
+	result.MagneticVariation = convertMagneticVariation(original.MagVar)
 	result.GeoidHeight = original.GeoIdHeight
 	result.Name = original.Name
 	result.Comment = original.Cmt
 	result.Description = original.Desc
 	result.Source = original.Src
-	// TODO
-	//w.Links = original.Links
+	result.Links = convertLinksFromGpx11(original.Links)
 	result.Symbol = original.Sym
 	result.Type = original.Type
-	result.TypeOfGpsFix = original.Fix
+	result.TypeOfGpsFix, _ = ParseFixType(original.Fix)
 	if original.Sat != nil {
 		result.Satellites = *NewNullableInt(*original.Sat)
 	}
@@ -613,5 +637,7 @@ func convertPointFromGpx11(original *gpx11GpxPoint) *GPXPoint {
 	if original.DGpsId != nil {
 		result.DGpsId = *NewNullableInt(*original.DGpsId)
 	}
+	result.Extensions = convertExtensionFromGpx11(original.Extensions)
+	result.readTypedExtensions()
 	return result
 }
@@ -0,0 +1,389 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVUnixTime is the CSV time format for Unix timestamps in seconds (with
+// optional decimals)
+const CSVUnixTime = "unix"
+
+// CSVOptions contains settings for GPX.WriteCSV
+type CSVOptions struct {
+	// Delimiter between the values, a comma if zero
+	Delimiter rune
+	// TimeFormat is a time layout (in UTC) or CSVUnixTime, RFC3339 if empty
+	TimeFormat string
+}
+
+// WriteCSV writes the track points as CSV, with a header row and a row for
+// each point with the columns track, segment and point (the indexes), lat,
+// lon, ele, time, distance (cumulative 2D distance from the start of the
+// track in meters) and speed (the recorded speed, or calculated from the
+// neighbour points, in m/s). The Garmin TrackPointExtension values (atemp,
+// wtemp, depth, hr and cad) and the other simple extension elements (named
+// with their prefixed names, nested elements separated by "/") are added as
+// columns if any point has them (for example gpxdata:distance). Empty cells
+// are missing values.
+func (g *GPX) WriteCSV(w io.Writer, opts CSVOptions) error {
+	fields := g.csvFields()
+	ns := newNamespacePrefixes(g.Namespaces)
+	extensionColumns := g.csvExtensionColumns(ns)
+
+	writer := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
+	header := []string{"track", "segment", "point", "lat", "lon", "ele", "time", "distance", "speed"}
+	for _, field := range fields {
+		header = append(header, field.name)
+	}
+	header = append(header, extensionColumns...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		var distance float64
+		for segmentNo := range track.Segments {
+			segment := &track.Segments[segmentNo]
+			for pointNo := range segment.Points {
+				point := &segment.Points[pointNo]
+				if pointNo > 0 {
+					distance += point.Distance2D(&segment.Points[pointNo-1])
+				}
+
+				var speed string
+				if point.Speed.NotNull() || !point.Timestamp.IsZero() {
+					if value := segment.Speed(pointNo); !math.IsNaN(value) && !math.IsInf(value, 0) {
+						speed = strconv.FormatFloat(value, 'f', 2, 64)
+					}
+				}
+				row := []string{
+					strconv.Itoa(trackNo),
+					strconv.Itoa(segmentNo),
+					strconv.Itoa(pointNo),
+					formatExtensionFloat(point.Latitude),
+					formatExtensionFloat(point.Longitude),
+					formatNullableFloat64(point.Elevation),
+					opts.formatTime(point.Timestamp),
+					strconv.FormatFloat(distance, 'f', 2, 64),
+					speed,
+				}
+				for _, field := range fields {
+					if field.float != nil {
+						row = append(row, formatNullableFloat64(*field.float(point)))
+					} else {
+						row = append(row, formatNullableInt(*field.int(point)))
+					}
+				}
+				values := map[string]string{}
+				csvExtensionValues(point.Extensions.Nodes, "", ns, values)
+				for _, column := range extensionColumns {
+					row = append(row, values[column])
+				}
+				if err := writer.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (opts CSVOptions) formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch opts.TimeFormat {
+	case "":
+		return formatGPXTime(&t, ToXmlParams{})
+	case CSVUnixTime:
+		return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+	}
+	return t.UTC().Format(opts.TimeFormat)
+}
+
+// csvFields returns the TrackPointExtension fields (without the v2 speed and
+// course, which are GPX 1.0 fields) of the track points
+func (g *GPX) csvFields() []trackPointExtensionField {
+	var result []trackPointExtensionField
+	for _, field := range trackPointExtensionFields {
+		if !field.v2 && g.csvHasField(field) {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func (g *GPX) csvHasField(field trackPointExtensionField) bool {
+	for _, track := range g.Tracks {
+		for _, segment := range track.Segments {
+			for pointNo := range segment.Points {
+				point := &segment.Points[pointNo]
+				if (field.float != nil && field.float(point).NotNull()) || (field.int != nil && field.int(point).NotNull()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// csvExtensionColumns returns the names of the simple extension elements of
+// all track points, in the order of their first appearance
+func (g *GPX) csvExtensionColumns(ns *namespacePrefixes) []string {
+	var result []string
+	found := map[string]bool{}
+	for _, track := range g.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				values := map[string]string{}
+				for _, column := range csvExtensionValues(point.Extensions.Nodes, "", ns, values) {
+					if !found[column] {
+						found[column] = true
+						result = append(result, column)
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// csvExtensionValues collects the values of the simple nodes (in values) and
+// returns their names (the element path with the namespace prefixes used by
+// ToXml) in document order
+func csvExtensionValues(nodes []ExtensionNode, path string, ns *namespacePrefixes, values map[string]string) []string {
+	var names []string
+	for nodeNo := range nodes {
+		node := &nodes[nodeNo]
+		name := path + node.XMLName.Local
+		if prefix := ns.prefix(node.XMLName.Space); len(prefix) > 0 {
+			name = path + prefix + ":" + node.XMLName.Local
+		}
+		if isSimpleNode(node) {
+			if _, found := values[name]; !found {
+				names = append(names, name)
+			}
+			values[name] = strings.TrimSpace(node.Data)
+		} else {
+			names = append(names, csvExtensionValues(node.Nodes, name+"/", ns, values)...)
+		}
+	}
+	return names
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// CSVMapping contains the CSV column names (in the header row, compared case
+// insensitively) of the point values for ReadCSV, and the format settings.
+// Empty column names are not read.
+type CSVMapping struct {
+	// Latitude and Longitude columns are required, rows with empty values are
+	// ignored
+	Latitude  string
+	Longitude string
+	Elevation string
+	Time      string
+	// Speed in m/s
+	Speed string
+	// Temperature in degrees Celsius
+	Temperature string
+	HeartRate   string
+	Cadence     string
+	// Track and Segment columns start a new track or segment when their
+	// value changes
+	Track   string
+	Segment string
+
+	// Delimiter between the values, a comma if zero
+	Delimiter rune
+	// TimeFormat is a time layout or CSVUnixTime, the GPX time formats
+	// (RFC3339) if empty
+	TimeFormat string
+	// Location of times without time zone, UTC if nil
+	Location *time.Location
+}
+
+// DefaultCSVMapping returns the mapping of the columns written by
+// GPX.WriteCSV
+func DefaultCSVMapping() CSVMapping {
+	return CSVMapping{
+		Latitude:    "lat",
+		Longitude:   "lon",
+		Elevation:   "ele",
+		Time:        "time",
+		Speed:       "speed",
+		Temperature: "atemp",
+		HeartRate:   "hr",
+		Cadence:     "cad",
+		Track:       "track",
+		Segment:     "segment",
+	}
+}
+
+// csvColumns are the column indexes of a CSVMapping, -1 for columns not read
+type csvColumns struct {
+	latitude, longitude, elevation, time, speed, temperature, heartRate, cadence, track, segment int
+}
+
+// ReadCSV builds a GPX with the tracks from CSV data with a header row. Rows
+// are converted to track points with the values of the mapped columns.
+// Columns in the mapping but not in the header are ignored, except the
+// required latitude and longitude columns.
+func ReadCSV(r io.Reader, mapping CSVMapping) (*GPX, error) {
+	reader := csv.NewReader(r)
+	if mapping.Delimiter != 0 {
+		reader.Comma = mapping.Delimiter
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV without header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := func(name string) int {
+		for columnNo, column := range header {
+			if len(name) > 0 && strings.EqualFold(strings.TrimSpace(column), name) {
+				return columnNo
+			}
+		}
+		return -1
+	}
+	columns := csvColumns{
+		latitude:    index(mapping.Latitude),
+		longitude:   index(mapping.Longitude),
+		elevation:   index(mapping.Elevation),
+		time:        index(mapping.Time),
+		speed:       index(mapping.Speed),
+		temperature: index(mapping.Temperature),
+		heartRate:   index(mapping.HeartRate),
+		cadence:     index(mapping.Cadence),
+		track:       index(mapping.Track),
+		segment:     index(mapping.Segment),
+	}
+	if columns.latitude < 0 || columns.longitude < 0 {
+		return nil, fmt.Errorf("CSV without latitude (%q) or longitude (%q) column", mapping.Latitude, mapping.Longitude)
+	}
+
+	g := &GPX{Version: "1.1"}
+	var track, segment string
+	for rowNo := 2; ; rowNo++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(columnNo int) string {
+			if columnNo < 0 || columnNo >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[columnNo])
+		}
+		if len(value(columns.latitude)) == 0 || len(value(columns.longitude)) == 0 {
+			continue
+		}
+
+		point, err := mapping.point(value, &columns)
+		if err != nil {
+			return nil, fmt.Errorf("CSV row %d: %s", rowNo, err.Error())
+		}
+		if len(g.Tracks) == 0 || value(columns.track) != track {
+			g.AppendTrack(new(GPXTrack))
+			g.Tracks[len(g.Tracks)-1].AppendSegment(new(GPXTrackSegment))
+		} else if value(columns.segment) != segment {
+			g.Tracks[len(g.Tracks)-1].AppendSegment(new(GPXTrackSegment))
+		}
+		track, segment = value(columns.track), value(columns.segment)
+		g.AppendPoint(point)
+	}
+	return g, nil
+}
+
+func (mapping *CSVMapping) point(value func(int) string, columns *csvColumns) (*GPXPoint, error) {
+	var err error
+	parseFloat := func(name string, columnNo int, result *float64) bool {
+		if err != nil || len(value(columnNo)) == 0 {
+			return false
+		}
+		if *result, err = strconv.ParseFloat(value(columnNo), 64); err != nil {
+			err = fmt.Errorf("invalid %s %q", name, value(columnNo))
+			return false
+		}
+		return true
+	}
+
+	point := new(GPXPoint)
+	parseFloat("latitude", columns.latitude, &point.Latitude)
+	parseFloat("longitude", columns.longitude, &point.Longitude)
+	var f float64
+	if parseFloat("elevation", columns.elevation, &f) {
+		point.Elevation.SetValue(f)
+	}
+	if parseFloat("speed", columns.speed, &f) {
+		point.Speed.SetValue(f)
+	}
+	if parseFloat("temperature", columns.temperature, &f) {
+		point.Temperature.SetValue(f)
+	}
+	if parseFloat("heart rate", columns.heartRate, &f) {
+		point.HeartRate.SetValue(int(math.Round(f)))
+	}
+	if parseFloat("cadence", columns.cadence, &f) {
+		point.Cadence.SetValue(int(math.Round(f)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if timeStr := value(columns.time); len(timeStr) > 0 {
+		if point.Timestamp, err = mapping.parseTime(timeStr); err != nil {
+			return nil, fmt.Errorf("invalid time %q", timeStr)
+		}
+	}
+	return point, nil
+}
+
+func (mapping *CSVMapping) parseTime(value string) (time.Time, error) {
+	location := mapping.Location
+	if location == nil {
+		location = time.UTC
+	}
+	switch mapping.TimeFormat {
+	case "":
+		t, err := parseGPXTime(value, location)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return *t, nil
+	case CSVUnixTime:
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole := math.Floor(seconds)
+		return time.Unix(int64(whole), int64(math.Round((seconds-whole)*1e9))).UTC(), nil
+	}
+	return time.ParseInLocation(mapping.TimeFormat, value, location)
+}
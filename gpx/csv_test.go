@@ -0,0 +1,130 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func csvTestGPX() *GPX {
+	t0 := time.Date(2014, 6, 1, 7, 0, 0, 0, time.UTC)
+	first := GPXPoint{Point: Point{Latitude: 46, Longitude: 13}, Timestamp: t0}
+	first.Elevation.SetValue(500)
+	first.HeartRate.SetValue(120)
+	first.Extensions.Nodes = []ExtensionNode{
+		simpleExtensionNode(ClueTrustGpxData, "distance", "0"),
+		{XMLName: xml.Name{Space: "http://example.com", Local: "sensors"}, Nodes: []ExtensionNode{simpleExtensionNode("http://example.com", "power", "250")}},
+	}
+	second := GPXPoint{Point: Point{Latitude: 46.001, Longitude: 13}, Timestamp: t0.Add(10 * time.Second)}
+	second.Speed.SetValue(11)
+	third := GPXPoint{Point: Point{Latitude: 46.002, Longitude: 13}}
+	third.Extensions.Nodes = []ExtensionNode{simpleExtensionNode(ClueTrustGpxData, "distance", "222.2")}
+
+	g := new(GPX)
+	g.AppendTrack(&GPXTrack{Segments: []GPXTrackSegment{{Points: []GPXPoint{first, second}}, {Points: []GPXPoint{third}}}})
+	g.AppendTrack(&GPXTrack{Segments: []GPXTrackSegment{{Points: []GPXPoint{{Point: Point{Latitude: -1.5, Longitude: 2.5}}}}}})
+	return g
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buffer bytes.Buffer
+	assertNil(t, csvTestGPX().WriteCSV(&buffer, CSVOptions{}))
+	assertLinesEquals(t, buffer.String(), `track,segment,point,lat,lon,ele,time,distance,speed,hr,gpxdata:distance,ns1:sensors/ns1:power
+0,0,0,46,13,500,2014-06-01T07:00:00Z,0.00,0.00,120,0,250
+0,0,1,46.001,13,,2014-06-01T07:00:10Z,111.12,11.00,,,
+0,1,0,46.002,13,,,111.12,,,222.2,
+1,0,0,-1.5,2.5,,,0.00,,,,
+`)
+
+	buffer.Reset()
+	assertNil(t, csvTestGPX().WriteCSV(&buffer, CSVOptions{Delimiter: ';', TimeFormat: CSVUnixTime}))
+	assertTrue(t, "unix time", strings.Contains(buffer.String(), "0;0;1;46.001;13;;1401606010;111.12;11.00;;;\n"))
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	original, err := ParseFile("../test_files/file.gpx")
+	assertNil(t, err)
+	var buffer bytes.Buffer
+	assertNil(t, original.WriteCSV(&buffer, CSVOptions{}))
+
+	g, err := ReadCSV(&buffer, DefaultCSVMapping())
+	assertNil(t, err)
+	assertEquals(t, len(g.Tracks), len(original.Tracks))
+	for trackNo, track := range original.Tracks {
+		assertEquals(t, len(g.Tracks[trackNo].Segments), len(track.Segments))
+		for segmentNo, segment := range track.Segments {
+			points := g.Tracks[trackNo].Segments[segmentNo].Points
+			assertEquals(t, len(points), len(segment.Points))
+			for pointNo, point := range segment.Points {
+				assertEquals(t, points[pointNo].Point.Latitude, point.Latitude)
+				assertEquals(t, points[pointNo].Point.Longitude, point.Longitude)
+				assertEquals(t, points[pointNo].Elevation, point.Elevation)
+				assertTrue(t, "time", points[pointNo].Timestamp.Equal(point.Timestamp))
+			}
+		}
+	}
+}
+
+func TestReadCSVLogger(t *testing.T) {
+	data := `Time; Lat; Lon; Alt; HR; Lap; Temp
+01.06.2014 09:00:00; 46.0; 13.0; 500.5; 120; 1; 21.5
+01.06.2014 09:00:05; ; ; 501; 121; 1;
+01.06.2014 09:00:10; 46.001; 13.0; ; 122.4; 1;
+01.06.2014 09:00:20; 46.002; 13.0; 502; ; 2
+`
+	location := time.FixedZone("CEST", 2*60*60)
+	g, err := ReadCSV(strings.NewReader(data), CSVMapping{
+		Latitude:    "lat",
+		Longitude:   "lon",
+		Elevation:   "alt",
+		Time:        "time",
+		HeartRate:   "hr",
+		Temperature: "temp",
+		Segment:     "lap",
+		Delimiter:   ';',
+		TimeFormat:  "02.01.2006 15:04:05",
+		Location:    location,
+	})
+	assertNil(t, err)
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+	points := g.Tracks[0].Segments[0].Points
+	// The row without position is ignored:
+	assertEquals(t, len(points), 2)
+	assertEquals(t, points[0].Elevation.Value(), 500.5)
+	assertEquals(t, points[0].HeartRate.Value(), 120)
+	assertEquals(t, points[0].Temperature.Value(), 21.5)
+	assertTrue(t, "time", points[0].Timestamp.Equal(time.Date(2014, 6, 1, 7, 0, 0, 0, time.UTC)))
+	assertTrue(t, "no elevation", points[1].Elevation.Null())
+	assertEquals(t, points[1].HeartRate.Value(), 122)
+	assertTrue(t, "no temperature", points[1].Temperature.Null())
+	assertEquals(t, g.Tracks[0].Segments[1].Points[0].Latitude, 46.002)
+
+	g, err = ReadCSV(strings.NewReader("lon,lat,time\n13,46,1401606000.5\n"), CSVMapping{Latitude: "lat", Longitude: "lon", Time: "time", TimeFormat: CSVUnixTime})
+	assertNil(t, err)
+	assertTrue(t, "unix time", g.Tracks[0].Segments[0].Points[0].Timestamp.Equal(time.Date(2014, 6, 1, 7, 0, 0, 500000000, time.UTC)))
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	for data, expected := range map[string]string{
+		"":                           "CSV without header",
+		"x,y\n1,2\n":                 `CSV without latitude ("lat") or longitude ("lon") column`,
+		"lat,lon\n46,13\nx,13\n":     `CSV row 3: invalid latitude "x"`,
+		"lat,lon,ele\n46,13,high\n":  `CSV row 2: invalid elevation "high"`,
+		"lat,lon,time\n46,13,noon\n": `CSV row 2: invalid time "noon"`,
+	} {
+		_, err := ReadCSV(strings.NewReader(data), DefaultCSVMapping())
+		if err == nil {
+			t.Errorf("Expected error %s", expected)
+		} else {
+			assertEquals(t, err.Error(), expected)
+		}
+	}
+}
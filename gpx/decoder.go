@@ -0,0 +1,848 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TokenType identifies the content of a Token returned by Decoder.Next
+type TokenType int
+
+const (
+	// MetadataToken carries the document header, it is always the first
+	// token. Header elements found after the first waypoint, route or track
+	// (which the GPX schema doesn't allow) are kept: a second MetadataToken
+	// with the whole header is sent at the end of the document, before the
+	// ExtensionsToken.
+	MetadataToken TokenType = iota
+	// WaypointToken carries a single waypoint
+	WaypointToken
+	// RouteToken carries a whole route with its points
+	RouteToken
+	// TrackToken marks the start of a track, the track has no segments
+	TrackToken
+	// TrackSegmentToken marks the start of a segment in the current track
+	TrackSegmentToken
+	// TrackPointToken carries a single point of the current segment
+	TrackPointToken
+	// TrackSegmentExtensionsToken carries the extensions of the current
+	// segment, it follows all the segment points (GPX 1.1 only)
+	TrackSegmentExtensionsToken
+	// ExtensionsToken carries the root element extensions, it is always the
+	// last token (GPX 1.1 only)
+	ExtensionsToken
+)
+
+// Token is a unit of GPX content emitted by the Decoder. Only the fields
+// relevant for its Type are set.
+type Token struct {
+	Type TokenType
+
+	// Metadata contains everything except waypoints, routes and tracks
+	Metadata *GPX
+	// Point is set for WaypointToken and TrackPointToken
+	Point *GPXPoint
+	Route *GPXRoute
+	// Track contains only the track header (without segments)
+	Track *GPXTrack
+	// Extensions is set for TrackSegmentExtensionsToken and ExtensionsToken
+	Extensions *Extension
+
+	WaypointNo int
+	RouteNo    int
+	TrackNo    int
+	SegmentNo  int
+	PointNo    int
+}
+
+// Decoder reads a GPX document incrementally, without loading the whole
+// file in memory. Errors are returned as *ParseError.
+type Decoder struct {
+	// r is the original reader, d is created on the first call to Next
+	r       io.Reader
+	openErr error
+	d       *xml.Decoder
+	pr      *positionReader
+	opts    ParseOptions
+	version string
+
+	// Input offset of the last token
+	offset int64
+	// Errors collected in lenient mode
+	errors []*ParseError
+	// The document is truncated, buffered headers can't be complete
+	truncated bool
+
+	started      bool
+	finished     bool
+	metadataSent bool
+	inTrack      bool
+	trackSent    bool
+	inSegment    bool
+
+	// Buffered tokens (and their offsets) of the document header and of the
+	// current track header. After the first MetadataToken the header buffer
+	// collects the header elements found later in the document.
+	headerTokens  []xml.Token
+	headerOffsets []int64
+	trackTokens   []xml.Token
+	trackOffsets  []int64
+	// header is the gpx10Gpx or gpx11Gpx model of the header, the late
+	// header elements are decoded into it
+	header interface{}
+	// Root extensions, sent at the end of the document
+	extensions *Extension
+
+	waypointNo int
+	routeNo    int
+	trackNo    int
+	segmentNo  int
+	pointNo    int
+
+	// Elements found in the document, including the skipped ones:
+	waypointsSeen int
+	routesSeen    int
+	pointsSeen    int
+
+	queue []*Token
+}
+
+// NewDecoder creates a new GPX decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, ParseOptions{})
+}
+
+// NewDecoderWithOptions creates a new GPX decoder reading from r. With
+// opts.Lenient invalid elements are skipped and their errors are available
+// with Errors.
+func NewDecoderWithOptions(r io.Reader, opts ParseOptions) *Decoder {
+	return &Decoder{
+		r:          r,
+		opts:       opts,
+		waypointNo: -1,
+		routeNo:    -1,
+		trackNo:    -1,
+	}
+}
+
+// Version returns the GPX version of the document, it is known after the
+// first call to Next.
+func (dec *Decoder) Version() string {
+	return dec.version
+}
+
+// Errors returns the errors of the elements skipped in lenient mode
+func (dec *Decoder) Errors() []*ParseError {
+	return dec.errors
+}
+
+// Next returns the next token of the document, io.EOF is returned after the
+// end of the document.
+//
+// In lenient mode a syntax error (usually a truncated file) ends the
+// document: the complete elements read before it are returned and the error
+// is available with Errors.
+func (dec *Decoder) Next() (*Token, error) {
+	if dec.d == nil {
+		if err := dec.open(); err != nil {
+			return nil, err
+		}
+	}
+	for len(dec.queue) == 0 {
+		if dec.finished {
+			return nil, io.EOF
+		}
+		if err := dec.step(); err != nil {
+			if parseError, ok := err.(*ParseError); ok && dec.opts.Lenient && dec.started && parseError.Category == SyntaxCategory {
+				if err := dec.finishTruncated(parseError); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+	}
+	token := dec.queue[0]
+	dec.queue = dec.queue[1:]
+	return token, nil
+}
+
+// open starts reading the document, which is converted to UTF-8 if needed
+func (dec *Decoder) open() error {
+	if dec.openErr != nil {
+		return dec.openErr
+	}
+	r, err := newUTF8Reader(dec.r)
+	if err != nil {
+		dec.openErr = &ParseError{Line: 1, Column: 1, Category: CharsetCategory, Err: err}
+		return dec.openErr
+	}
+	dec.pr = newPositionReader(r)
+	dec.d = xml.NewDecoder(dec.pr)
+	dec.d.CharsetReader = passCharsetReader
+	return nil
+}
+
+func (dec *Decoder) step() error {
+	dec.offset = dec.d.InputOffset()
+	t, err := dec.d.Token()
+	if err == io.EOF {
+		if !dec.started {
+			return dec.newError(StructureCategory, "", dec.offset, errors.New("invalid GPX file, no gpx element found"))
+		}
+		return dec.syntaxError(io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return dec.syntaxError(err)
+	}
+
+	switch element := t.(type) {
+	case xml.StartElement:
+		if !dec.started {
+			return dec.startDocument(element)
+		}
+		return dec.startElement(element)
+	case xml.EndElement:
+		return dec.endElement(element)
+	}
+	return nil
+}
+
+func (dec *Decoder) startDocument(start xml.StartElement) error {
+	if start.Name.Local != "gpx" {
+		return dec.newError(StructureCategory, "", dec.offset, fmt.Errorf("expected element type <gpx> but have <%s>", start.Name.Local))
+	}
+	if len(dec.opts.ForceVersion) > 0 {
+		if err := checkForcedVersion(dec.opts.ForceVersion); err != nil {
+			return dec.newError(VersionCategory, "gpx", dec.offset, err)
+		}
+		dec.version = dec.opts.ForceVersion
+	} else {
+		version, err := rootVersion(start)
+		if err != nil {
+			return dec.newError(VersionCategory, "gpx", dec.offset, err)
+		}
+		dec.version = version
+	}
+	dec.started = true
+	dec.headerTokens = []xml.Token{start.Copy()}
+	dec.headerOffsets = []int64{dec.offset}
+	return nil
+}
+
+func (dec *Decoder) startElement(start xml.StartElement) error {
+	if dec.inSegment {
+		if start.Name.Local == "extensions" && dec.version == "1.1" {
+			extensions, err := dec.decodeExtensions(&start, dec.path()+"/extensions")
+			if err != nil {
+				return err
+			}
+			dec.emit(&Token{Type: TrackSegmentExtensionsToken, Extensions: extensions, TrackNo: dec.trackNo, SegmentNo: dec.segmentNo})
+			return nil
+		}
+		if start.Name.Local != "trkpt" {
+			return dec.d.Skip()
+		}
+		dec.pointsSeen++
+		point, err := dec.decodePoint(&start, fmt.Sprintf("%s/trkpt[%d]", dec.path(), dec.pointsSeen))
+		if err != nil || point == nil {
+			return err
+		}
+		dec.pointNo++
+		dec.emit(&Token{Type: TrackPointToken, Point: point, TrackNo: dec.trackNo, SegmentNo: dec.segmentNo, PointNo: dec.pointNo})
+		return nil
+	}
+
+	if dec.inTrack {
+		if start.Name.Local != "trkseg" {
+			if dec.trackSent {
+				return dec.d.Skip()
+			}
+			tokens, offsets, err := dec.readElement(start)
+			dec.trackTokens = append(dec.trackTokens, tokens...)
+			dec.trackOffsets = append(dec.trackOffsets, offsets...)
+			return err
+		}
+		if err := dec.sendTrack(); err != nil {
+			return err
+		}
+		dec.inSegment = true
+		dec.segmentNo++
+		dec.pointNo = -1
+		dec.pointsSeen = 0
+		dec.emit(&Token{Type: TrackSegmentToken, TrackNo: dec.trackNo, SegmentNo: dec.segmentNo})
+		return nil
+	}
+
+	switch start.Name.Local {
+	case "wpt":
+		if err := dec.sendMetadata(); err != nil {
+			return err
+		}
+		dec.waypointsSeen++
+		point, err := dec.decodePoint(&start, fmt.Sprintf("gpx/wpt[%d]", dec.waypointsSeen))
+		if err != nil || point == nil {
+			return err
+		}
+		dec.waypointNo++
+		dec.emit(&Token{Type: WaypointToken, Point: point, WaypointNo: dec.waypointNo})
+	case "rte":
+		if err := dec.sendMetadata(); err != nil {
+			return err
+		}
+		dec.routesSeen++
+		route, err := dec.decodeRoute(&start, fmt.Sprintf("gpx/rte[%d]", dec.routesSeen))
+		if err != nil || route == nil {
+			return err
+		}
+		dec.routeNo++
+		dec.emit(&Token{Type: RouteToken, Route: route, RouteNo: dec.routeNo})
+	case "trk":
+		if err := dec.sendMetadata(); err != nil {
+			return err
+		}
+		dec.inTrack = true
+		dec.trackSent = false
+		dec.trackNo++
+		dec.segmentNo = -1
+		dec.trackTokens = []xml.Token{start.Copy()}
+		dec.trackOffsets = []int64{dec.offset}
+	case "extensions":
+		if dec.version != "1.1" {
+			return dec.d.Skip()
+		}
+		extensions, err := dec.decodeExtensions(&start, "gpx/extensions")
+		if err != nil {
+			return err
+		}
+		if dec.extensions == nil {
+			dec.extensions = extensions
+		} else {
+			dec.extensions.Nodes = append(dec.extensions.Nodes, extensions.Nodes...)
+		}
+	default:
+		// After the first MetadataToken only the elements of the header
+		// models are kept, the other ones would be ignored anyway
+		if dec.metadataSent && !headerElements[dec.version][start.Name.Local] {
+			return dec.d.Skip()
+		}
+		tokens, offsets, err := dec.readElement(start)
+		dec.headerTokens = append(dec.headerTokens, tokens...)
+		dec.headerOffsets = append(dec.headerOffsets, offsets...)
+		return err
+	}
+	return nil
+}
+
+func (dec *Decoder) endElement(end xml.EndElement) error {
+	switch {
+	case dec.inSegment:
+		// Only the trkseg end is possible here, other elements are skipped
+		dec.inSegment = false
+	case dec.inTrack:
+		if err := dec.sendTrack(); err != nil {
+			return err
+		}
+		dec.inTrack = false
+	default:
+		if err := dec.sendMetadata(); err != nil {
+			return err
+		}
+		if err := dec.sendLateMetadata(); err != nil {
+			return err
+		}
+		if dec.extensions != nil {
+			dec.emit(&Token{Type: ExtensionsToken, Extensions: dec.extensions})
+		}
+		dec.finished = true
+	}
+	return nil
+}
+
+// finishTruncated ends a document which can't be read anymore, the buffered
+// headers are sent as if all the open elements were closed
+func (dec *Decoder) finishTruncated(parseError *ParseError) error {
+	dec.errors = append(dec.errors, parseError)
+	dec.truncated = true
+	if dec.inTrack {
+		if err := dec.sendTrack(); err != nil {
+			return err
+		}
+	}
+	if err := dec.sendMetadata(); err != nil {
+		return err
+	}
+	if err := dec.sendLateMetadata(); err != nil {
+		return err
+	}
+	if dec.extensions != nil {
+		dec.emit(&Token{Type: ExtensionsToken, Extensions: dec.extensions})
+	}
+	dec.inSegment, dec.inTrack = false, false
+	dec.finished = true
+	return nil
+}
+
+func (dec *Decoder) emit(token *Token) {
+	dec.queue = append(dec.queue, token)
+}
+
+// readElement returns copies of all the tokens of the element (including
+// start and end) and their input offsets
+func (dec *Decoder) readElement(start xml.StartElement) ([]xml.Token, []int64, error) {
+	tokens := []xml.Token{start.Copy()}
+	offsets := []int64{dec.offset}
+	depth := 1
+	for depth > 0 {
+		offset := dec.d.InputOffset()
+		t, err := dec.d.Token()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return tokens, offsets, dec.syntaxError(err)
+		}
+		switch t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+		tokens = append(tokens, xml.CopyToken(t))
+		offsets = append(offsets, offset)
+	}
+	return tokens, offsets, nil
+}
+
+func (dec *Decoder) sendMetadata() error {
+	if dec.metadataSent {
+		return nil
+	}
+	dec.metadataSent = true
+	if dec.version == "1.0" {
+		dec.header = &gpx10Gpx{}
+	} else {
+		dec.header = &gpx11Gpx{}
+	}
+	return dec.decodeHeader()
+}
+
+// sendLateMetadata sends the header again if header elements were found
+// after the first waypoint, route or track
+func (dec *Decoder) sendLateMetadata() error {
+	if len(dec.headerTokens) <= 1 {
+		return nil
+	}
+	return dec.decodeHeader()
+}
+
+// decodeHeader decodes the buffered header elements into the header model
+// (like xml.Unmarshal, later elements override or are appended to the
+// earlier ones) and sends the header
+func (dec *Decoder) decodeHeader() error {
+	root := dec.headerTokens[0].(xml.StartElement)
+	tokens := append(dec.headerTokens, xml.EndElement{Name: root.Name})
+	offsets := append(dec.headerOffsets, dec.offset)
+	dec.headerTokens, dec.headerOffsets = []xml.Token{root}, []int64{offsets[0]}
+
+	tokens, err := dec.checkElement("gpx", tokens, offsets)
+	if err != nil {
+		return err
+	}
+
+	// In lenient mode the partially decoded header is used
+	if err := decodeTokens(tokens, dec.header); err != nil && !dec.truncated {
+		if err := dec.elementError(errorCategory(err), "gpx", offsets[0], err); err != nil {
+			return err
+		}
+	}
+	var metadata *GPX
+	if g, ok := dec.header.(*gpx10Gpx); ok {
+		metadata = convertFromGpx10Models(g, dec.opts)
+	} else {
+		metadata = convertFromGpx11Models(dec.header.(*gpx11Gpx), dec.opts)
+	}
+	// The detected (or forced) version, not the version attribute:
+	metadata.Version = dec.version
+	dec.emit(&Token{Type: MetadataToken, Metadata: metadata})
+	return nil
+}
+
+func (dec *Decoder) sendTrack() error {
+	if dec.trackSent {
+		return nil
+	}
+	dec.trackSent = true
+
+	tokens := append(dec.trackTokens, xml.EndElement{Name: dec.trackTokens[0].(xml.StartElement).Name})
+	offsets := append(dec.trackOffsets, dec.offset)
+	dec.trackTokens, dec.trackOffsets = nil, nil
+
+	path := fmt.Sprintf("gpx/trk[%d]", dec.trackNo+1)
+	tokens, err := dec.checkElement(path, tokens, offsets)
+	if err != nil {
+		return err
+	}
+
+	// In lenient mode the partially decoded header is used
+	var track *GPXTrack
+	if dec.version == "1.0" {
+		trk := &gpx10GpxTrk{}
+		if err := decodeTokens(tokens, trk); err != nil && !dec.truncated {
+			if err := dec.elementError(errorCategory(err), path, offsets[0], err); err != nil {
+				return err
+			}
+		}
+		track = convertTrackFromGpx10(trk, dec.opts)
+	} else {
+		trk := &gpx11GpxTrk{}
+		if err := decodeTokens(tokens, trk); err != nil && !dec.truncated {
+			if err := dec.elementError(errorCategory(err), path, offsets[0], err); err != nil {
+				return err
+			}
+		}
+		track = convertTrackFromGpx11(trk, dec.opts)
+	}
+	dec.emit(&Token{Type: TrackToken, Track: track, TrackNo: dec.trackNo})
+	return nil
+}
+
+// decodePoint returns nil (without an error) if the point is skipped in
+// lenient mode
+func (dec *Decoder) decodePoint(start *xml.StartElement, path string) (*GPXPoint, error) {
+	dec.pr.forget(dec.offset)
+	tokens, offsets, err := dec.readElement(*start)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err = dec.checkElement(path, tokens, offsets)
+	if err != nil || tokens == nil {
+		return nil, err
+	}
+
+	if dec.version == "1.0" {
+		point := &gpx10GpxPoint{}
+		if err := decodeTokens(tokens, point); err != nil {
+			return nil, dec.elementError(errorCategory(err), path, offsets[0], err)
+		}
+		return convertPointFromGpx10(point, dec.opts), nil
+	}
+	point := &gpx11GpxPoint{}
+	if err := decodeTokens(tokens, point); err != nil {
+		return nil, dec.elementError(errorCategory(err), path, offsets[0], err)
+	}
+	return convertPointFromGpx11(point, dec.opts), nil
+}
+
+// decodeRoute returns nil (without an error) if the route is skipped in
+// lenient mode
+func (dec *Decoder) decodeRoute(start *xml.StartElement, path string) (*GPXRoute, error) {
+	dec.pr.forget(dec.offset)
+	tokens, offsets, err := dec.readElement(*start)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err = dec.checkElement(path, tokens, offsets)
+	if err != nil || tokens == nil {
+		return nil, err
+	}
+
+	if dec.version == "1.0" {
+		route := &gpx10GpxRte{}
+		if err := decodeTokens(tokens, route); err != nil {
+			return nil, dec.elementError(errorCategory(err), path, offsets[0], err)
+		}
+		return convertRouteFromGpx10(route, dec.opts), nil
+	}
+	route := &gpx11GpxRte{}
+	if err := decodeTokens(tokens, route); err != nil {
+		return nil, dec.elementError(errorCategory(err), path, offsets[0], err)
+	}
+	return convertRouteFromGpx11(route, dec.opts), nil
+}
+
+func (dec *Decoder) decodeExtensions(start *xml.StartElement, path string) (*Extension, error) {
+	offset := dec.offset
+	extensions := &gpx11GpxExtensions{}
+	if err := dec.d.DecodeElement(extensions, start); err != nil {
+		return nil, dec.newError(errorCategory(err), path, offset, err)
+	}
+	result := convertExtensionFromGpx11(extensions)
+	return &result, nil
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// path returns the path of the element being decoded
+func (dec *Decoder) path() string {
+	switch {
+	case dec.inSegment:
+		return fmt.Sprintf("gpx/trk[%d]/trkseg[%d]", dec.trackNo+1, dec.segmentNo+1)
+	case dec.inTrack:
+		return fmt.Sprintf("gpx/trk[%d]", dec.trackNo+1)
+	case dec.started:
+		return "gpx"
+	}
+	return ""
+}
+
+func (dec *Decoder) newError(category ParseErrorCategory, path string, offset int64, err error) *ParseError {
+	line, column := dec.pr.position(offset)
+	return &ParseError{Line: line, Column: column, Path: path, Category: category, Err: err}
+}
+
+func (dec *Decoder) syntaxError(err error) error {
+	return dec.newError(SyntaxCategory, dec.path(), dec.d.InputOffset(), err)
+}
+
+// elementError returns the error of an element which can't be decoded, in
+// lenient mode the error is collected and nil is returned
+func (dec *Decoder) elementError(category ParseErrorCategory, path string, offset int64, err error) error {
+	parseError := dec.newError(category, path, offset, err)
+	if dec.opts.Lenient {
+		dec.errors = append(dec.errors, parseError)
+		return nil
+	}
+	return parseError
+}
+
+// checkedFloatAttributes are the attributes decoded as float64 by the
+// gpx10/gpx11 models, encoding/xml fails on the whole document if they are
+// invalid
+var checkedFloatAttributes = map[string][]string{
+	"wpt":    {"lat", "lon"},
+	"rtept":  {"lat", "lon"},
+	"trkpt":  {"lat", "lon"},
+	"bounds": {"minlat", "maxlat", "minlon", "maxlon"},
+}
+
+// maxAttributeValues are the ranges of the coordinates, out of range points
+// are skipped in lenient mode
+var maxAttributeValues = map[string]float64{
+	"lat":    90,
+	"lon":    180,
+	"minlat": 90,
+	"maxlat": 90,
+	"minlon": 180,
+	"maxlon": 180,
+}
+
+// headerElements are the header elements decoded by the gpx10Gpx and
+// gpx11Gpx models
+var headerElements = map[string]map[string]bool{
+	"1.0": {"name": true, "desc": true, "author": true, "email": true, "url": true, "urlname": true, "time": true, "keywords": true, "bounds": true},
+	"1.1": {"metadata": true},
+}
+
+// checkedValueElements are decoded as *int or *float64 by the gpx10/gpx11
+// models, an invalid value fails the whole document
+var checkedValueElements = map[string]func(string) error{
+	"sat":           parseIntValue,
+	"dgpsid":        parseIntValue,
+	"hdop":          parseFloatValue,
+	"vdop":          parseFloatValue,
+	"pdop":          parseFloatValue,
+	"ageofdgpsdata": parseFloatValue,
+}
+
+// ignoredValueElements are decoded as NullableFloat64, NullableInt or
+// FixType, which ignore invalid values. They are reported only in lenient
+// mode.
+var ignoredValueElements = map[string]func(string) error{
+	"ele":         parseFloatValue,
+	"number":      parseFloatValue,
+	"course":      parseFloatValue,
+	"speed":       parseFloatValue,
+	"magvar":      parseMagneticVariation,
+	"geoidheight": parseFloatValue,
+	"fix":         parseFixValue,
+}
+
+func parseIntValue(value string) error {
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err
+}
+
+func parseFloatValue(value string) error {
+	_, err := strconv.ParseFloat(value, 64)
+	return err
+}
+
+func parseMagneticVariation(value string) error {
+	magVar, err := strconv.ParseFloat(value, 64)
+	if err == nil && !validMagneticVariation(magVar) {
+		return errors.New("magnetic variation out of range")
+	}
+	return err
+}
+
+func parseFixValue(value string) error {
+	_, err := ParseFixType(value)
+	return err
+}
+
+// valueParser returns the validation of the element value, nil if it isn't
+// checked. Times are parsed as strings by the converters, which ignore
+// invalid values, so (like ignoredValueElements) they are reported only in
+// lenient mode.
+func (dec *Decoder) valueParser(name string) func(string) error {
+	if parser, found := checkedValueElements[name]; found {
+		return parser
+	}
+	if !dec.opts.Lenient {
+		return nil
+	}
+	if name == "time" {
+		return func(value string) error {
+			_, err := parseGPXTime(value, dec.opts.DefaultLocation)
+			return err
+		}
+	}
+	return ignoredValueElements[name]
+}
+
+func (dec *Decoder) checkAttributes(start xml.StartElement) error {
+	for _, name := range checkedFloatAttributes[start.Name.Local] {
+		for _, attr := range start.Attr {
+			if attr.Name.Space != "" || attr.Name.Local != name {
+				continue
+			}
+			value := strings.TrimSpace(attr.Value)
+			if len(value) == 0 {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", name, attr.Value)
+			}
+			if max, found := maxAttributeValues[name]; found && dec.opts.Lenient && (parsed < -max || parsed > max) {
+				return fmt.Errorf("%s %q out of range", name, attr.Value)
+			}
+		}
+	}
+	return nil
+}
+
+type checkedElement struct {
+	name    string
+	path    string
+	start   int
+	parser  func(string) error
+	data    []byte
+	counts  map[string]int
+	skip    bool
+	invalid bool
+}
+
+// checkElement validates the values encoding/xml can't decode (invalid
+// float attributes and elements fail the whole document). In lenient mode the
+// errors are collected and the invalid elements are removed from the returned
+// tokens, nil is returned if the element itself is invalid.
+// Lenient mode also reports the values which the converters silently drop
+// (times, invalid NullableFloat64 values) and out of range coordinates.
+func (dec *Decoder) checkElement(path string, tokens []xml.Token, offsets []int64) ([]xml.Token, error) {
+	var stack []*checkedElement
+	var invalid [][2]int
+	for tokenNo, t := range tokens {
+		switch token := t.(type) {
+		case xml.StartElement:
+			element := &checkedElement{name: token.Name.Local, path: path, start: tokenNo}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				if parent.skip {
+					element.skip = true
+					stack = append(stack, element)
+					continue
+				}
+				if parent.counts == nil {
+					parent.counts = map[string]int{}
+				}
+				element.path = parent.path + "/" + elementPathName(parent.counts, element.name)
+			}
+			element.skip = element.name == "extensions"
+			if !element.skip {
+				element.parser = dec.valueParser(element.name)
+				if err := dec.checkAttributes(token); err != nil {
+					if err := dec.elementError(ValueCategory, element.path, offsets[tokenNo], err); err != nil {
+						return nil, err
+					}
+					element.invalid = true
+				}
+			}
+			stack = append(stack, element)
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1].parser != nil {
+				element := stack[len(stack)-1]
+				element.data = append(element.data, token...)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			element := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if element.parser != nil {
+				value := strings.TrimSpace(string(element.data))
+				if len(value) > 0 {
+					if err := element.parser(value); err != nil {
+						if err := dec.elementError(ValueCategory, element.path, offsets[element.start], fmt.Errorf("invalid %s %q", element.name, value)); err != nil {
+							return nil, err
+						}
+						element.invalid = true
+					}
+				}
+			}
+			if element.invalid {
+				invalid = append(invalid, [2]int{element.start, tokenNo})
+			}
+		}
+	}
+
+	if len(invalid) == 0 {
+		return tokens, nil
+	}
+	dropped := make([]bool, len(tokens))
+	for _, tokenRange := range invalid {
+		for tokenNo := tokenRange[0]; tokenNo <= tokenRange[1]; tokenNo++ {
+			dropped[tokenNo] = true
+		}
+	}
+	if dropped[0] {
+		return nil, nil
+	}
+	result := make([]xml.Token, 0, len(tokens))
+	for tokenNo, t := range tokens {
+		if !dropped[tokenNo] {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// tokenSlice replays previously read tokens, so that buffered elements can be
+// unmarshalled with the gpx10/gpx11 models
+type tokenSlice struct {
+	tokens []xml.Token
+}
+
+func (ts *tokenSlice) Token() (xml.Token, error) {
+	if len(ts.tokens) == 0 {
+		return nil, io.EOF
+	}
+	t := ts.tokens[0]
+	ts.tokens = ts.tokens[1:]
+	return t, nil
+}
+
+func decodeTokens(tokens []xml.Token, v interface{}) error {
+	return xml.NewTokenDecoder(&tokenSlice{tokens: tokens}).Decode(v)
+}
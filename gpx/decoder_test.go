@@ -0,0 +1,182 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func decodeAll(t *testing.T, r io.Reader) *GPX {
+	var result *GPX
+	decoder := NewDecoder(r)
+	for {
+		token, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Error("Error decoding:", err.Error())
+			return nil
+		}
+		switch token.Type {
+		case MetadataToken:
+			if result != nil {
+				token.Metadata.Waypoints = result.Waypoints
+				token.Metadata.Routes = result.Routes
+				token.Metadata.Tracks = result.Tracks
+			}
+			result = token.Metadata
+		case WaypointToken:
+			result.AppendWaypoint(token.Point)
+		case RouteToken:
+			result.AppendRoute(token.Route)
+		case TrackToken:
+			assertEquals(t, token.TrackNo, len(result.Tracks))
+			result.AppendTrack(token.Track)
+		case TrackSegmentToken:
+			track := &result.Tracks[len(result.Tracks)-1]
+			assertEquals(t, token.SegmentNo, len(track.Segments))
+			track.AppendSegment(new(GPXTrackSegment))
+		case TrackPointToken:
+			track := &result.Tracks[len(result.Tracks)-1]
+			segment := &track.Segments[len(track.Segments)-1]
+			assertEquals(t, token.PointNo, len(segment.Points))
+			segment.AppendPoint(token.Point)
+		case TrackSegmentExtensionsToken:
+			track := &result.Tracks[len(result.Tracks)-1]
+			track.Segments[len(track.Segments)-1].Extensions = *token.Extensions
+		case ExtensionsToken:
+			result.Extensions = *token.Extensions
+		}
+	}
+	return result
+}
+
+func TestDecoderSameAsParseFile(t *testing.T) {
+	for _, fileName := range loadTestGPXs() {
+		parsed, err := ParseFile(fileName)
+		if err != nil {
+			t.Error("Error parsing", fileName, err.Error())
+			continue
+		}
+
+		f, err := os.Open(fileName)
+		if err != nil {
+			t.Error("Error opening", fileName, err.Error())
+			continue
+		}
+		decoded := decodeAll(t, f)
+		f.Close()
+		if decoded == nil {
+			continue
+		}
+
+		assertEquals(t, decoded.Version, parsed.Version)
+		assertEquals(t, decoded.GetTrackPointsNo(), parsed.GetTrackPointsNo())
+
+		parsedXml, _ := parsed.ToXml(ToXmlParams{Indent: true})
+		decodedXml, _ := decoded.ToXml(ToXmlParams{Indent: true})
+		assertLinesEquals(t, string(parsedXml), string(decodedXml))
+	}
+}
+
+func TestDecoderTokens(t *testing.T) {
+	xml := `<gpx version="1.0" creator="test">
+<name>tokens</name>
+<wpt lat="1" lon="2"><name>w</name></wpt>
+<trk><name>t1</name>
+<trkseg><trkpt lat="1" lon="1"></trkpt><trkpt lat="2" lon="2"></trkpt></trkseg>
+<trkseg><trkpt lat="3" lon="3"></trkpt></trkseg>
+</trk>
+<trk></trk>
+</gpx>`
+	decoder := NewDecoder(strings.NewReader(xml))
+	expected := []TokenType{MetadataToken, WaypointToken, TrackToken, TrackSegmentToken, TrackPointToken, TrackPointToken, TrackSegmentToken, TrackPointToken, TrackToken}
+	for tokenNo, tokenType := range expected {
+		token, err := decoder.Next()
+		if err != nil {
+			t.Fatal("Error decoding:", err.Error())
+		}
+		assertEquals(t, token.Type, tokenType)
+		switch tokenNo {
+		case 0:
+			assertEquals(t, token.Metadata.Name, "tokens")
+			assertEquals(t, token.Metadata.Version, "1.0")
+		case 2:
+			assertEquals(t, token.Track.Name, "t1")
+		case 7:
+			assertEquals(t, token.TrackNo, 0)
+			assertEquals(t, token.SegmentNo, 1)
+			assertEquals(t, token.PointNo, 0)
+			assertEquals(t, token.Point.Latitude, 3.0)
+		case 8:
+			assertEquals(t, token.TrackNo, 1)
+		}
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Error("Expected EOF, found:", err)
+	}
+	assertEquals(t, decoder.Version(), "1.0")
+}
+
+func TestDecoderInvalidXml(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(`<gpx version="1.1"><trk><trkseg><trkpt lat="1" lon="1"></trkpt>`))
+	var err error
+	for err == nil {
+		_, err = decoder.Next()
+	}
+	if err == io.EOF {
+		t.Error("Expected an error for a truncated document")
+	}
+}
+
+func TestDecoderLateHeader(t *testing.T) {
+	xml := `<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>first</name><desc>desc</desc></metadata>
+<wpt lat="1" lon="2"></wpt>
+<trk><trkseg><trkpt lat="1" lon="1"></trkpt></trkseg></trk>
+<metadata><name>late</name><keywords>kw</keywords></metadata>
+</gpx>`
+	decoder := NewDecoder(strings.NewReader(xml))
+	expected := []TokenType{MetadataToken, WaypointToken, TrackToken, TrackSegmentToken, TrackPointToken, MetadataToken}
+	for tokenNo, tokenType := range expected {
+		token, err := decoder.Next()
+		if err != nil {
+			t.Fatal("Error decoding:", err.Error())
+		}
+		assertEquals(t, token.Type, tokenType)
+		switch tokenNo {
+		case 0:
+			assertEquals(t, token.Metadata.Name, "first")
+			assertEquals(t, token.Metadata.Keywords, "")
+		case 5:
+			assertEquals(t, token.Metadata.Name, "late")
+			assertEquals(t, token.Metadata.Description, "desc")
+			assertEquals(t, token.Metadata.Keywords, "kw")
+		}
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Error("Expected EOF, found:", err)
+	}
+
+	g, err := ParseString(xml)
+	assertNil(t, err)
+	assertEquals(t, g.Name, "late")
+	assertEquals(t, g.Description, "desc")
+	assertEquals(t, g.Keywords, "kw")
+	assertEquals(t, len(g.Waypoints), 1)
+	assertEquals(t, g.GetTrackPointsNo(), 1)
+
+	// GPX 1.0 header elements after the tracks
+	g, err = ParseString(`<gpx version="1.0" creator="test"><trk><trkseg><trkpt lat="1" lon="1"></trkpt></trkseg></trk><name>late</name><time>2020-01-02T03:04:05Z</time></gpx>`)
+	assertNil(t, err)
+	assertEquals(t, g.Name, "late")
+	assertTrue(t, "late time", g.Time != nil && g.Time.Year() == 2020)
+	assertEquals(t, g.GetTrackPointsNo(), 1)
+}
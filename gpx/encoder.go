@@ -0,0 +1,407 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder states, GPX requires waypoints, routes and tracks in this order
+const (
+	encoderStart = iota
+	encoderMetadata
+	encoderWaypoints
+	encoderRoutes
+	encoderTracks
+	encoderExtensions
+	encoderClosed
+)
+
+// Encoder writes a GPX document incrementally, the result is the same as
+// the one written by ToXml.
+type Encoder struct {
+	w       io.Writer
+	err     error
+	enc     *xml.Encoder
+	params  ToXmlParams
+	version string
+	ns      *namespacePrefixes
+
+	state     int
+	inTrack   bool
+	inSegment bool
+}
+
+// NewEncoder creates an encoder writing to w. Params.Version is optional,
+// if empty the version of the GPX passed to WriteMetadata is used.
+func NewEncoder(w io.Writer, params ToXmlParams) *Encoder {
+	table, err := lookupCharset(params.Encoding)
+	if table != nil {
+		w = newCharsetWriter(w, table)
+	}
+	enc := xml.NewEncoder(w)
+	if params.Indent {
+		enc.Indent("", "	")
+	}
+	return &Encoder{w: w, err: err, enc: enc, params: params}
+}
+
+// Encode writes the complete GPX document and closes the encoder
+func (e *Encoder) Encode(g *GPX) error {
+	if err := e.WriteMetadata(g); err != nil {
+		return err
+	}
+	for waypointNo := range g.Waypoints {
+		if err := e.WriteWaypoint(&g.Waypoints[waypointNo]); err != nil {
+			return err
+		}
+	}
+	for routeNo := range g.Routes {
+		if err := e.WriteRoute(&g.Routes[routeNo]); err != nil {
+			return err
+		}
+	}
+	for trackNo := range g.Tracks {
+		if err := e.WriteTrack(&g.Tracks[trackNo]); err != nil {
+			return err
+		}
+	}
+	if err := e.WriteExtensions(&g.Extensions); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// WriteMetadata writes the XML declaration, the root element and the
+// document header. Waypoints, routes, tracks and root extensions of g are
+// not written, but the namespaces of their extensions are declared in the
+// root element. It must be called before any other write method.
+func (e *Encoder) WriteMetadata(g *GPX) error {
+	if e.state != encoderStart {
+		return errors.New("gpx metadata already written")
+	}
+	if e.err != nil {
+		return e.err
+	}
+	e.state = encoderMetadata
+
+	e.version = e.params.Version
+	if len(e.version) == 0 {
+		e.version = g.Version
+	}
+	if e.version != "1.0" {
+		e.version = "1.1"
+	}
+
+	header := xml.Header
+	if table, _ := lookupCharset(e.params.Encoding); table != nil {
+		header = fmt.Sprintf(`<?xml version="1.0" encoding="%s"?>`+"\n", e.params.Encoding)
+	}
+	if _, err := io.WriteString(e.w, header); err != nil {
+		return err
+	}
+
+	e.ns = newNamespacePrefixes(g.Namespaces)
+	if e.version == "1.0" {
+		return e.writeMetadata10(convertMetadataToGpx10(g, e.params))
+	}
+	return e.writeMetadata11(convertMetadataToGpx11(g, e.ns, e.params), e.ns.declare(g.extensionNamespaces()))
+}
+
+func (e *Encoder) writeMetadata10(doc *gpx10Gpx) error {
+	if err := e.enc.EncodeToken(rootElement(doc.XMLNs, doc.XmlNsXsi, doc.XmlSchemaLoc, nil, doc.Version, doc.Creator)); err != nil {
+		return err
+	}
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"name", doc.Name},
+		{"desc", doc.Desc},
+		{"author", doc.Author},
+		{"email", doc.Email},
+		{"url", doc.Url},
+		{"urlname", doc.UrlName},
+		{"time", doc.Time},
+		{"keywords", doc.Keywords},
+	}
+	for _, field := range fields {
+		if err := e.encodeString(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	if doc.Bounds == nil {
+		return nil
+	}
+	return e.enc.EncodeElement(doc.Bounds, xml.StartElement{Name: xml.Name{Local: "bounds"}})
+}
+
+func (e *Encoder) writeMetadata11(doc *gpx11Gpx, namespaces []xml.Attr) error {
+	if err := e.enc.EncodeToken(rootElement(doc.XMLNs, doc.XmlNsXsi, doc.XmlSchemaLoc, namespaces, doc.Version, doc.Creator)); err != nil {
+		return err
+	}
+	return e.enc.Encode(doc.Metadata)
+}
+
+func rootElement(xmlNs, xmlNsXsi, schemaLoc string, namespaces []xml.Attr, version, creator string) xml.StartElement {
+	root := xml.StartElement{Name: xml.Name{Local: "gpx"}}
+	attrs := []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: xmlNs},
+		{Name: xml.Name{Local: "xmlns:xsi"}, Value: xmlNsXsi},
+		{Name: xml.Name{Local: "xsi:schemaLocation"}, Value: schemaLoc},
+	}
+	for _, attr := range attrs {
+		if len(attr.Value) > 0 {
+			root.Attr = append(root.Attr, attr)
+		}
+	}
+	root.Attr = append(root.Attr, namespaces...)
+	root.Attr = append(root.Attr,
+		xml.Attr{Name: xml.Name{Local: "version"}, Value: version},
+		xml.Attr{Name: xml.Name{Local: "creator"}, Value: creator})
+	return root
+}
+
+func (e *Encoder) encodeString(name, value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	return e.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+// moveTo checks that elements are written in the order required by GPX
+func (e *Encoder) moveTo(state int) error {
+	if e.state == encoderStart {
+		if err := e.WriteMetadata(new(GPX)); err != nil {
+			return err
+		}
+	}
+	if e.state == encoderClosed {
+		return errors.New("gpx encoder already closed")
+	}
+	if state < e.state || e.state == encoderExtensions {
+		return errors.New("gpx waypoints, routes and tracks must be written in this order")
+	}
+	e.state = state
+	return nil
+}
+
+// WriteWaypoint writes a waypoint, all waypoints must be written before routes and tracks
+func (e *Encoder) WriteWaypoint(p *GPXPoint) error {
+	if err := e.moveTo(encoderWaypoints); err != nil {
+		return err
+	}
+	return e.encodePoint(p, "wpt")
+}
+
+// WriteRoute writes a route with all its points, all routes must be written before tracks
+func (e *Encoder) WriteRoute(r *GPXRoute) error {
+	if err := e.moveTo(encoderRoutes); err != nil {
+		return err
+	}
+	if e.version == "1.0" {
+		return e.enc.Encode(convertRouteToGpx10(r, e.params))
+	}
+	return e.enc.Encode(convertRouteToGpx11(r, e.ns, e.params))
+}
+
+// WriteTrack writes a complete track with all its segments
+func (e *Encoder) WriteTrack(t *GPXTrack) error {
+	if err := e.BeginTrack(t); err != nil {
+		return err
+	}
+	for _, segment := range t.Segments {
+		if err := e.BeginSegment(); err != nil {
+			return err
+		}
+		for pointNo := range segment.Points {
+			if err := e.WritePoint(&segment.Points[pointNo]); err != nil {
+				return err
+			}
+		}
+		if !segment.Extensions.Empty() {
+			if err := e.WriteSegmentExtensions(&segment.Extensions); err != nil {
+				return err
+			}
+		}
+	}
+	return e.endTrack()
+}
+
+// BeginTrack closes the current track (if any) and starts a new one. Only
+// the track header is written, segments must be added with BeginSegment.
+func (e *Encoder) BeginTrack(t *GPXTrack) error {
+	if err := e.moveTo(encoderTracks); err != nil {
+		return err
+	}
+	if err := e.endTrack(); err != nil {
+		return err
+	}
+
+	if err := e.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "trk"}}); err != nil {
+		return err
+	}
+	e.inTrack = true
+
+	if e.version == "1.0" {
+		return e.writeTrackHeader10(convertTrackToGpx10(t))
+	}
+	return e.writeTrackHeader11(convertTrackToGpx11(t, e.ns))
+}
+
+func (e *Encoder) writeTrackHeader10(header *gpx10GpxTrk) error {
+	for _, field := range [][2]string{{"name", header.Name}, {"cmt", header.Cmt}, {"desc", header.Desc}, {"src", header.Src}, {"url", header.Url}, {"urlname", header.UrlName}} {
+		if err := e.encodeString(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	if err := e.enc.EncodeElement(header.Number, xml.StartElement{Name: xml.Name{Local: "number"}}); err != nil {
+		return err
+	}
+	return e.encodeString("type", header.Type)
+}
+
+func (e *Encoder) writeTrackHeader11(header *gpx11GpxTrk) error {
+	for _, field := range [][2]string{{"name", header.Name}, {"cmt", header.Cmt}, {"desc", header.Desc}, {"src", header.Src}} {
+		if err := e.encodeString(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	for _, link := range header.Links {
+		if err := e.enc.EncodeElement(link, xml.StartElement{Name: xml.Name{Local: "link"}}); err != nil {
+			return err
+		}
+	}
+	if err := e.enc.EncodeElement(header.Number, xml.StartElement{Name: xml.Name{Local: "number"}}); err != nil {
+		return err
+	}
+	if err := e.encodeString("type", header.Type); err != nil {
+		return err
+	}
+	return e.encodeExtensions(header.Extensions)
+}
+
+// BeginSegment closes the current segment (if any) and starts a new one in
+// the current track. If no track was started an empty one is created.
+func (e *Encoder) BeginSegment() error {
+	if !e.inTrack {
+		if err := e.BeginTrack(new(GPXTrack)); err != nil {
+			return err
+		}
+	}
+	if err := e.endSegment(); err != nil {
+		return err
+	}
+	if err := e.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "trkseg"}}); err != nil {
+		return err
+	}
+	e.inSegment = true
+	return nil
+}
+
+// WritePoint writes a point in the current segment. If no segment was
+// started a new one is created.
+func (e *Encoder) WritePoint(p *GPXPoint) error {
+	if !e.inSegment {
+		if err := e.BeginSegment(); err != nil {
+			return err
+		}
+	}
+	return e.encodePoint(p, "trkpt")
+}
+
+// WriteSegmentExtensions writes the extensions of the current segment and
+// closes it, extensions must follow all the segment points. If no segment was
+// started a new one is created. GPX 1.0 has no extensions, so with 1.0 the
+// segment is only closed.
+func (e *Encoder) WriteSegmentExtensions(ext *Extension) error {
+	if !e.inSegment {
+		if err := e.BeginSegment(); err != nil {
+			return err
+		}
+	}
+	if e.version != "1.0" {
+		if err := e.encodeExtensions(e.ns.toGpx11(ext)); err != nil {
+			return err
+		}
+	}
+	return e.endSegment()
+}
+
+// WriteExtensions closes the current track (if any) and writes the root
+// element extensions, only Close is allowed after it. With GPX 1.0 the
+// extensions are ignored.
+func (e *Encoder) WriteExtensions(ext *Extension) error {
+	if err := e.moveTo(encoderTracks); err != nil {
+		return err
+	}
+	if err := e.endTrack(); err != nil {
+		return err
+	}
+	e.state = encoderExtensions
+	if e.version == "1.0" {
+		return nil
+	}
+	return e.encodeExtensions(e.ns.toGpx11(ext))
+}
+
+func (e *Encoder) encodeExtensions(ext *gpx11GpxExtensions) error {
+	if ext == nil {
+		return nil
+	}
+	return e.enc.EncodeElement(ext, xml.StartElement{Name: xml.Name{Local: "extensions"}})
+}
+
+func (e *Encoder) encodePoint(p *GPXPoint, elementName string) error {
+	start := xml.StartElement{Name: xml.Name{Local: elementName}}
+	if e.version == "1.0" {
+		return e.enc.EncodeElement(convertPointToGpx10(p, e.params), start)
+	}
+	return e.enc.EncodeElement(convertPointToGpx11(p, e.ns, e.params), start)
+}
+
+func (e *Encoder) endSegment() error {
+	if !e.inSegment {
+		return nil
+	}
+	e.inSegment = false
+	return e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "trkseg"}})
+}
+
+func (e *Encoder) endTrack() error {
+	if err := e.endSegment(); err != nil {
+		return err
+	}
+	if !e.inTrack {
+		return nil
+	}
+	e.inTrack = false
+	return e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "trk"}})
+}
+
+// Close closes all open elements and flushes the output. It does not close
+// the underlying writer.
+func (e *Encoder) Close() error {
+	if e.state == encoderClosed {
+		return nil
+	}
+	if e.state != encoderExtensions {
+		if err := e.moveTo(encoderTracks); err != nil {
+			return err
+		}
+		if err := e.endTrack(); err != nil {
+			return err
+		}
+	}
+	e.state = encoderClosed
+	if err := e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "gpx"}}); err != nil {
+		return err
+	}
+	return e.enc.Flush()
+}
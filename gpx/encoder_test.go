@@ -0,0 +1,130 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestEncoderStreamFromDecoder(t *testing.T) {
+	for _, fileName := range loadTestGPXs() {
+		parsed, err := ParseFile(fileName)
+		if err != nil {
+			t.Error("Error parsing", fileName, err.Error())
+			continue
+		}
+		expected, _ := parsed.ToXml(ToXmlParams{Indent: true})
+
+		f, err := os.Open(fileName)
+		if err != nil {
+			t.Error("Error opening", fileName, err.Error())
+			continue
+		}
+
+		var buffer bytes.Buffer
+		encoder := NewEncoder(&buffer, ToXmlParams{Indent: true})
+		decoder := NewDecoder(f)
+		for {
+			token, err := decoder.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error("Error decoding:", err.Error())
+				break
+			}
+			switch token.Type {
+			case MetadataToken:
+				err = encoder.WriteMetadata(token.Metadata)
+			case WaypointToken:
+				err = encoder.WriteWaypoint(token.Point)
+			case RouteToken:
+				err = encoder.WriteRoute(token.Route)
+			case TrackToken:
+				err = encoder.BeginTrack(token.Track)
+			case TrackSegmentToken:
+				err = encoder.BeginSegment()
+			case TrackPointToken:
+				err = encoder.WritePoint(token.Point)
+			case TrackSegmentExtensionsToken:
+				err = encoder.WriteSegmentExtensions(token.Extensions)
+			case ExtensionsToken:
+				err = encoder.WriteExtensions(token.Extensions)
+			}
+			if err != nil {
+				t.Error("Error encoding:", err.Error())
+			}
+		}
+		f.Close()
+		if err := encoder.Close(); err != nil {
+			t.Error("Error closing:", err.Error())
+		}
+
+		assertLinesEquals(t, string(expected), buffer.String())
+	}
+}
+
+func TestEncoderIncremental(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer, ToXmlParams{Version: "1.1"})
+	assertNil(t, encoder.WriteMetadata(&GPX{Creator: "test", Metadata: Metadata{Name: "stream"}}))
+	assertNil(t, encoder.WriteWaypoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 2}}))
+	assertNil(t, encoder.BeginTrack(&GPXTrack{Name: "t"}))
+	assertNil(t, encoder.WritePoint(&GPXPoint{Point: Point{Latitude: 3, Longitude: 4}}))
+	assertNil(t, encoder.BeginSegment())
+	assertNil(t, encoder.WritePoint(&GPXPoint{Point: Point{Latitude: 5, Longitude: 6}}))
+	assertNil(t, encoder.Close())
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="test"><metadata><name>stream</name></metadata><wpt lat="1" lon="2"></wpt><trk><name>t</name><trkseg><trkpt lat="3" lon="4"></trkpt></trkseg><trkseg><trkpt lat="5" lon="6"></trkpt></trkseg></trk></gpx>`
+	assertEquals(t, buffer.String(), expected)
+
+	g, err := ParseBytes(buffer.Bytes())
+	assertNil(t, err)
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+}
+
+func TestEncoderIncrementalGPX10(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer, ToXmlParams{Version: "1.0"})
+	assertNil(t, encoder.WriteMetadata(&GPX{Creator: "test", Metadata: Metadata{Name: "stream"}}))
+	assertNil(t, encoder.WriteWaypoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 2}}))
+	assertNil(t, encoder.BeginTrack(&GPXTrack{Name: "t"}))
+	point := GPXPoint{Point: Point{Latitude: 3, Longitude: 4}}
+	point.Speed.SetValue(2.5)
+	point.Course.SetValue(90)
+	assertNil(t, encoder.WritePoint(&point))
+	assertNil(t, encoder.BeginSegment())
+	assertNil(t, encoder.WritePoint(&GPXPoint{Point: Point{Latitude: 5, Longitude: 6}}))
+	assertNil(t, encoder.Close())
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/0" version="1.0" creator="test"><name>stream</name><wpt lat="1" lon="2"></wpt><trk><name>t</name><trkseg><trkpt lat="3" lon="4"><course>90</course><speed>2.5</speed></trkpt></trkseg><trkseg><trkpt lat="5" lon="6"></trkpt></trkseg></trk></gpx>`
+	assertEquals(t, buffer.String(), expected)
+
+	g, err := ParseBytes(buffer.Bytes())
+	assertNil(t, err)
+	assertEquals(t, g.Version, "1.0")
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+	assertEquals(t, g.Tracks[0].Segments[0].Points[0].Speed.Value(), 2.5)
+	assertEquals(t, g.Tracks[0].Segments[0].Points[0].Course.Value(), 90.0)
+}
+
+func TestEncoderInvalidOrder(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer, ToXmlParams{})
+	assertNil(t, encoder.WritePoint(&GPXPoint{}))
+	if err := encoder.WriteWaypoint(&GPXPoint{}); err == nil {
+		t.Error("Waypoints can't be written after tracks")
+	}
+	assertNil(t, encoder.Close())
+	if err := encoder.WritePoint(&GPXPoint{}); err == nil {
+		t.Error("Encoder is closed")
+	}
+}
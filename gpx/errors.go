@@ -0,0 +1,154 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ParseErrorCategory classifies a ParseError
+type ParseErrorCategory int
+
+const (
+	// SyntaxCategory is a document which isn't well formed XML (including
+	// truncated documents)
+	SyntaxCategory ParseErrorCategory = iota
+	// VersionCategory is an unsupported GPX version
+	VersionCategory
+	// StructureCategory is a document with an unexpected structure, for
+	// example without the gpx root element
+	StructureCategory
+	// ValueCategory is an element or attribute value which can't be parsed
+	ValueCategory
+	// CharsetCategory is an unsupported document encoding
+	CharsetCategory
+)
+
+func (c ParseErrorCategory) String() string {
+	switch c {
+	case SyntaxCategory:
+		return "syntax error"
+	case VersionCategory:
+		return "version error"
+	case StructureCategory:
+		return "structure error"
+	case ValueCategory:
+		return "invalid value"
+	case CharsetCategory:
+		return "charset error"
+	}
+	return fmt.Sprintf("ParseErrorCategory(%d)", int(c))
+}
+
+// ParseError is an error found while parsing a GPX document
+type ParseError struct {
+	// Line and Column (in bytes) where the error was found, starting with 1
+	Line   int
+	Column int
+	// Path of the element, for example gpx/trk[2]/trkseg[1]/trkpt[341]/time.
+	// Repeatable elements are numbered starting with 1.
+	Path     string
+	Category ParseErrorCategory
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Category, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d, %s: %s: %s", e.Line, e.Column, e.Path, e.Category, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func errorCategory(err error) ParseErrorCategory {
+	switch err.(type) {
+	case *xml.SyntaxError:
+		return SyntaxCategory
+	case *strconv.NumError:
+		return ValueCategory
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return SyntaxCategory
+	}
+	return StructureCategory
+}
+
+// repeatableElements are numbered in the ParseError paths
+var repeatableElements = map[string]bool{
+	"wpt":    true,
+	"rte":    true,
+	"rtept":  true,
+	"trk":    true,
+	"trkseg": true,
+	"trkpt":  true,
+	"link":   true,
+}
+
+func elementPathName(counts map[string]int, name string) string {
+	if !repeatableElements[name] {
+		return name
+	}
+	counts[name]++
+	return fmt.Sprintf("%s[%d]", name, counts[name])
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// positionReader keeps the offsets of line starts, so that the line and
+// column of a decoder input offset can be found
+type positionReader struct {
+	r      io.Reader
+	offset int64
+	// lineStarts are the offsets of lines firstLine, firstLine+1...
+	lineStarts []int64
+	firstLine  int
+}
+
+func newPositionReader(r io.Reader) *positionReader {
+	return &positionReader{r: r, lineStarts: []int64{0}, firstLine: 1}
+}
+
+func (pr *positionReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			pr.lineStarts = append(pr.lineStarts, pr.offset+int64(i)+1)
+		}
+	}
+	pr.offset += int64(n)
+	return n, err
+}
+
+func (pr *positionReader) lineIndex(offset int64) int {
+	index := sort.Search(len(pr.lineStarts), func(i int) bool { return pr.lineStarts[i] > offset }) - 1
+	if index < 0 {
+		return 0
+	}
+	return index
+}
+
+func (pr *positionReader) position(offset int64) (int, int) {
+	index := pr.lineIndex(offset)
+	return pr.firstLine + index, int(offset-pr.lineStarts[index]) + 1
+}
+
+// forget drops the line starts before the line of offset, positions before
+// it can't be found anymore
+func (pr *positionReader) forget(offset int64) {
+	index := pr.lineIndex(offset)
+	if index > 0 {
+		pr.lineStarts = append(pr.lineStarts[:0], pr.lineStarts[index:]...)
+		pr.firstLine += index
+	}
+}
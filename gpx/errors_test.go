@@ -0,0 +1,180 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"testing"
+)
+
+const invalidValuesGpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="test">
+<wpt lat="1" lon="1"><name>w1</name></wpt>
+<wpt lat="x" lon="1"><name>w2</name></wpt>
+<rte>
+  <rtept lat="1" lon="1"></rtept>
+  <rtept lat="1" lon="--"></rtept>
+  <rtept lat="2" lon="2"></rtept>
+</rte>
+<trk>
+  <trkseg>
+    <trkpt lat="1" lon="1"><time>2013-01-01T12:00:00Z</time></trkpt>
+    <trkpt lat="2" lon="2"><time>2013-01-01T12:00:01Z</time></trkpt>
+    <trkpt lat="3" lon="3"><time>yesterday</time></trkpt>
+  </trkseg>
+</trk>
+</gpx>`
+
+func assertParseError(t *testing.T, err error, category ParseErrorCategory, path string, line, column int) {
+	parseError, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected a *ParseError, found %#v", err)
+	}
+	assertEquals(t, parseError.Category, category)
+	assertEquals(t, parseError.Path, path)
+	assertEquals(t, parseError.Line, line)
+	assertEquals(t, parseError.Column, column)
+}
+
+func TestParseErrorInvalidAttribute(t *testing.T) {
+	_, err := ParseString(invalidValuesGpx)
+	assertParseError(t, err, ValueCategory, "gpx/wpt[2]", 4, 1)
+	assertEquals(t, err.Error(), `line 4, column 1, gpx/wpt[2]: invalid value: invalid lat "x"`)
+}
+
+func TestParseErrorInvalidTime(t *testing.T) {
+	xml := `<gpx version="1.0">
+<trk><trkseg><trkpt lat="1" lon="1"/></trkseg><trkseg><trkpt lat="1" lon="1"/>
+<trkpt lat="1" lon="1">
+  <time>2013-13-01</time>
+</trkpt></trkseg></trk></gpx>`
+	// Invalid times are ignored, and reported only in lenient mode
+	g, err := ParseString(xml)
+	assertNil(t, err)
+	assertTrue(t, "no time", g.Tracks[0].Segments[1].Points[1].Timestamp.IsZero())
+
+	g, err = ParseStringWithOptions(xml, ParseOptions{Lenient: true})
+	assertNil(t, err)
+	assertEquals(t, len(g.ParseErrors), 1)
+	assertParseError(t, g.ParseErrors[0], ValueCategory, "gpx/trk[1]/trkseg[2]/trkpt[2]/time", 4, 3)
+}
+
+func TestParseErrorSyntax(t *testing.T) {
+	_, err := ParseString("<gpx version=\"1.1\">\n<trk><trkseg>\n  <trkpt lat=\"1\" lon=\"1\"></trk>")
+	parseError, ok := err.(*ParseError)
+	assertTrue(t, "*ParseError expected", ok)
+	assertEquals(t, parseError.Category, SyntaxCategory)
+	assertEquals(t, parseError.Line, 3)
+	assertEquals(t, parseError.Path, "gpx/trk[1]/trkseg[1]")
+
+	_, err = ParseString("<gpx version=\"1.1\">\n<trk><trkseg>\n")
+	assertParseError(t, err, SyntaxCategory, "gpx/trk[1]/trkseg[1]", 3, 1)
+}
+
+func TestParseErrorVersion(t *testing.T) {
+	_, err := ParseString(`<gpx version="2.0"></gpx>`)
+	assertParseError(t, err, VersionCategory, "gpx", 1, 1)
+
+	_, err = ParseString(`<?xml version="1.0"?><kml></kml>`)
+	assertParseError(t, err, StructureCategory, "", 1, 22)
+}
+
+func TestParseLenient(t *testing.T) {
+	g, err := ParseStringWithOptions(invalidValuesGpx, ParseOptions{Lenient: true})
+	assertNil(t, err)
+
+	assertEquals(t, len(g.Waypoints), 1)
+	assertEquals(t, g.Waypoints[0].Name, "w1")
+	assertEquals(t, len(g.Routes[0].Points), 2)
+	assertEquals(t, g.Routes[0].Points[1].Latitude, 2.0)
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 3)
+	assertTrue(t, "invalid time", points[2].Timestamp.IsZero())
+	assertEquals(t, points[2].Latitude, 3.0)
+
+	assertEquals(t, len(g.ParseErrors), 3)
+	assertEquals(t, g.ParseErrors[0].Path, "gpx/wpt[2]")
+	assertEquals(t, g.ParseErrors[1].Path, "gpx/rte[1]/rtept[2]")
+	assertEquals(t, g.ParseErrors[1].Line, 7)
+	assertEquals(t, g.ParseErrors[1].Column, 3)
+	assertEquals(t, g.ParseErrors[2].Path, "gpx/trk[1]/trkseg[1]/trkpt[3]/time")
+	assertEquals(t, g.ParseErrors[2].Line, 14)
+}
+
+func TestParseLenientValidFiles(t *testing.T) {
+	for _, fileName := range loadTestGPXs() {
+		g, err := ParseFileWithOptions(fileName, ParseOptions{Lenient: true})
+		if err != nil {
+			t.Error("Error parsing", fileName, err.Error())
+			continue
+		}
+		assertEquals(t, len(g.ParseErrors), 0)
+	}
+}
+
+func TestParseLenientTruncated(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="test">
+<metadata><name>truncated</name></metadata>
+<wpt lat="1" lon="1"></wpt>
+<trk><name>t</name>
+<trkseg>
+<trkpt lat="1" lon="1"><ele>10</ele></trkpt>
+<trkpt lat="2" lon="2"><ele>11</ele></trkpt>
+<trkpt lat="3" lon="3"><ele>1`
+
+	_, err := ParseString(xml)
+	assertParseError(t, err, SyntaxCategory, "gpx/trk[1]/trkseg[1]", 9, 30)
+
+	g, err := ParseStringWithOptions(xml, ParseOptions{Lenient: true})
+	assertNil(t, err)
+	assertEquals(t, g.Name, "truncated")
+	assertEquals(t, len(g.Waypoints), 1)
+	assertEquals(t, g.Tracks[0].Name, "t")
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 2)
+	assertEquals(t, g.Tracks[0].Segments[0].Points[1].Elevation.Value(), 11.0)
+	assertEquals(t, len(g.ParseErrors), 1)
+	assertEquals(t, g.ParseErrors[0].Category, SyntaxCategory)
+}
+
+func TestParseLenientTruncatedHeader(t *testing.T) {
+	for _, xml := range []string{
+		`<gpx version="1.0"><name>n</name><trk><name>t</name><number>2</num`,
+		`<gpx version="1.0"><name>n</name><trk><name>t</name><number>2</number>` + "\x00\x00\x00",
+	} {
+		g, err := ParseStringWithOptions(xml, ParseOptions{Lenient: true})
+		assertNil(t, err)
+		assertEquals(t, g.Name, "n")
+		assertEquals(t, len(g.Tracks), 1)
+		assertEquals(t, g.Tracks[0].Name, "t")
+		assertEquals(t, len(g.ParseErrors), 1)
+	}
+}
+
+func TestParseInvalidNumbers(t *testing.T) {
+	xml := `<gpx version="1.1">
+<trk><trkseg>
+<trkpt lat="1" lon="1"><ele>abc</ele><hdop>1.5</hdop></trkpt>
+<trkpt lat="1" lon="1"><ele>10</ele><hdop>?</hdop></trkpt>
+<trkpt lat="95" lon="1"></trkpt>
+</trkseg></trk></gpx>`
+
+	_, err := ParseString(xml)
+	assertParseError(t, err, ValueCategory, "gpx/trk[1]/trkseg[1]/trkpt[2]/hdop", 4, 37)
+
+	g, err := ParseStringWithOptions(xml, ParseOptions{Lenient: true})
+	assertNil(t, err)
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 2)
+	assertTrue(t, "invalid elevation", points[0].Elevation.Null())
+	assertEquals(t, points[0].HorizontalDilution.Value(), 1.5)
+	assertEquals(t, points[1].Elevation.Value(), 10.0)
+	assertTrue(t, "invalid hdop", points[1].HorizontalDilution.Null())
+
+	assertEquals(t, len(g.ParseErrors), 3)
+	assertEquals(t, g.ParseErrors[0].Path, "gpx/trk[1]/trkseg[1]/trkpt[1]/ele")
+	assertEquals(t, g.ParseErrors[1].Path, "gpx/trk[1]/trkseg[1]/trkpt[2]/hdop")
+	assertEquals(t, g.ParseErrors[2].Path, "gpx/trk[1]/trkseg[1]/trkpt[3]")
+}
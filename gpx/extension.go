@@ -0,0 +1,296 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	gpx10Namespace = "http://www.topografix.com/GPX/1/0"
+	gpx11Namespace = "http://www.topografix.com/GPX/1/1"
+)
+
+// knownNamespacePrefixes contains the usual prefixes for common extension
+// namespaces, used when the document does not declare its own
+var knownNamespacePrefixes = map[string]string{
+	"http://www.garmin.com/xmlschemas/GpxExtensions/v3":         "gpxx",
+	"http://www.garmin.com/xmlschemas/TrackPointExtension/v1":   "gpxtpx",
+	"http://www.garmin.com/xmlschemas/TrackPointExtension/v2":   "gpxtpx",
+	"http://www.garmin.com/xmlschemas/WaypointExtension/v1":     "wptx1",
+	"http://www.garmin.com/xmlschemas/TrackStatsExtension/v1":   "gpxtrkx",
+	"http://www.garmin.com/xmlschemas/PowerExtension/v1":        "gpxpx",
+	"http://www.garmin.com/xmlschemas/AccelerationExtension/v1": "gpxacc",
+	"http://www.cluetrust.com/XML/GPXDATA/1/0":                  "gpxdata",
+}
+
+// Extension contains the elements of a GPX 1.1 <extensions> block
+type Extension struct {
+	Nodes []ExtensionNode `xml:",any"`
+}
+
+// ExtensionNode is a generic XML element inside an extensions block.
+// XMLName.Space is the namespace URL (not the prefix).
+type ExtensionNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr      `xml:",any,attr"`
+	Data    string          `xml:",chardata"`
+	Nodes   []ExtensionNode `xml:",any"`
+}
+
+// Empty checks if there are no extension nodes
+func (ext *Extension) Empty() bool {
+	return len(ext.Nodes) == 0
+}
+
+// GetNode returns the first node with the given namespace and local name.
+// If namespace is empty only the local name is compared.
+func (ext *Extension) GetNode(namespace, name string) *ExtensionNode {
+	return getExtensionNode(ext.Nodes, namespace, name)
+}
+
+// GetNode returns the first child node with the given namespace and local
+// name. If namespace is empty only the local name is compared.
+func (n *ExtensionNode) GetNode(namespace, name string) *ExtensionNode {
+	return getExtensionNode(n.Nodes, namespace, name)
+}
+
+// GetAttr returns the value of the attribute with the given local name
+func (n *ExtensionNode) GetAttr(name string) (string, bool) {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func getExtensionNode(nodes []ExtensionNode, namespace, name string) *ExtensionNode {
+	for nodeNo := range nodes {
+		node := &nodes[nodeNo]
+		if node.XMLName.Local == name && (len(namespace) == 0 || node.XMLName.Space == namespace) {
+			return node
+		}
+	}
+	return nil
+}
+
+// extensionNamespaces returns the namespaces declared in the original
+// document and the ones used by the extensions of all its elements
+func (g *GPX) extensionNamespaces() map[string]bool {
+	result := map[string]bool{}
+	for _, url := range g.Namespaces {
+		result[url] = true
+	}
+	g.MetadataExtensions.namespaces(result)
+	g.Extensions.namespaces(result)
+	for _, waypoint := range g.Waypoints {
+		waypoint.allExtensions().namespaces(result)
+	}
+	for _, route := range g.Routes {
+		route.allExtensions().namespaces(result)
+		for _, point := range route.Points {
+			point.allExtensions().namespaces(result)
+		}
+	}
+	for _, track := range g.Tracks {
+		track.allExtensions().namespaces(result)
+		for _, segment := range track.Segments {
+			segment.Extensions.namespaces(result)
+			for _, point := range segment.Points {
+				point.allExtensions().namespaces(result)
+			}
+		}
+	}
+	return result
+}
+
+func (ext *Extension) namespaces(result map[string]bool) {
+	for _, node := range ext.Nodes {
+		node.namespaces(result)
+	}
+}
+
+func (n *ExtensionNode) namespaces(result map[string]bool) {
+	result[n.XMLName.Space] = true
+	for _, attr := range n.Attrs {
+		if len(attr.Name.Space) > 0 {
+			result[attr.Name.Space] = true
+		}
+	}
+	for _, node := range n.Nodes {
+		node.namespaces(result)
+	}
+}
+
+// convertExtensionFromGpx11 cleans up the decoded nodes: namespace
+// declarations and whitespace around child elements are removed
+func convertExtensionFromGpx11(original *gpx11GpxExtensions) Extension {
+	if original == nil {
+		return Extension{}
+	}
+	return Extension{Nodes: cleanExtensionNodes(original.Nodes)}
+}
+
+func cleanExtensionNodes(nodes []ExtensionNode) []ExtensionNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	result := make([]ExtensionNode, len(nodes))
+	for nodeNo, node := range nodes {
+		result[nodeNo].XMLName = node.XMLName
+		result[nodeNo].Data = strings.TrimSpace(node.Data)
+		result[nodeNo].Nodes = cleanExtensionNodes(node.Nodes)
+		for _, attr := range node.Attrs {
+			if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+				result[nodeNo].Attrs = append(result[nodeNo].Attrs, attr)
+			}
+		}
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// namespacePrefixes assigns prefixes to the extension namespaces when writing
+// a document. encoding/xml can't write prefixed names, so nodes are written
+// with "prefix:name" local names.
+type namespacePrefixes struct {
+	// preferred prefixes, from the original document
+	preferred map[string]string
+	// url -> prefix
+	prefixes map[string]string
+	// prefixes already used
+	used map[string]bool
+	// namespaces declared on the root element
+	declared map[string]bool
+}
+
+func newNamespacePrefixes(preferred map[string]string) *namespacePrefixes {
+	np := &namespacePrefixes{
+		preferred: map[string]string{},
+		prefixes:  map[string]string{},
+		used:      map[string]bool{"xsi": true, "xml": true, "xmlns": true},
+		declared:  map[string]bool{},
+	}
+	for prefix, url := range preferred {
+		np.preferred[url] = prefix
+	}
+	return np
+}
+
+func (np *namespacePrefixes) prefix(url string) string {
+	if url == "" || url == gpx11Namespace {
+		return ""
+	}
+	if prefix, found := np.prefixes[url]; found {
+		return prefix
+	}
+	prefix, found := np.preferred[url]
+	if !found {
+		prefix = knownNamespacePrefixes[url]
+	}
+	if len(prefix) == 0 || np.used[prefix] {
+		base := prefix
+		if len(base) == 0 {
+			base = "ns"
+		}
+		for i := 1; ; i++ {
+			prefix = fmt.Sprintf("%s%d", base, i)
+			if !np.used[prefix] {
+				break
+			}
+		}
+	}
+	np.prefixes[url] = prefix
+	np.used[prefix] = true
+	return prefix
+}
+
+// declare returns the root element attributes declaring the given namespaces
+func (np *namespacePrefixes) declare(urls map[string]bool) []xml.Attr {
+	sorted := make([]string, 0, len(urls))
+	for url := range urls {
+		if len(np.prefix(url)) > 0 {
+			sorted = append(sorted, url)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return np.prefix(sorted[i]) < np.prefix(sorted[j])
+	})
+
+	result := make([]xml.Attr, len(sorted))
+	for urlNo, url := range sorted {
+		np.declared[url] = true
+		result[urlNo] = xml.Attr{Name: xml.Name{Local: "xmlns:" + np.prefix(url)}, Value: url}
+	}
+	return result
+}
+
+func (np *namespacePrefixes) name(name xml.Name) xml.Name {
+	prefix := np.prefix(name.Space)
+	if len(prefix) == 0 {
+		return xml.Name{Local: name.Local}
+	}
+	return xml.Name{Local: prefix + ":" + name.Local}
+}
+
+// toGpx11 returns a copy of the extension with prefixed names, namespaces not
+// declared on the root element are declared on the nodes using them
+func (np *namespacePrefixes) toGpx11(ext *Extension) *gpx11GpxExtensions {
+	if ext == nil || ext.Empty() {
+		return nil
+	}
+	return &gpx11GpxExtensions{Nodes: np.convertNodes(ext.Nodes, map[string]bool{})}
+}
+
+func (np *namespacePrefixes) convertNodes(nodes []ExtensionNode, inScope map[string]bool) []ExtensionNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	result := make([]ExtensionNode, len(nodes))
+	for nodeNo, node := range nodes {
+		scope := inScope
+		var declarations []xml.Attr
+		urls := []string{node.XMLName.Space}
+		for _, attr := range node.Attrs {
+			urls = append(urls, attr.Name.Space)
+		}
+		for _, url := range urls {
+			prefix := np.prefix(url)
+			if len(prefix) > 0 && !np.declared[url] && !scope[url] {
+				if len(declarations) == 0 {
+					scope = copyNamespaceScope(inScope)
+				}
+				scope[url] = true
+				declarations = append(declarations, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: url})
+			}
+		}
+
+		converted := ExtensionNode{
+			XMLName: np.name(node.XMLName),
+			Data:    node.Data,
+			Attrs:   declarations,
+		}
+		for _, attr := range node.Attrs {
+			converted.Attrs = append(converted.Attrs, xml.Attr{Name: np.name(attr.Name), Value: attr.Value})
+		}
+		converted.Nodes = np.convertNodes(node.Nodes, scope)
+		result[nodeNo] = converted
+	}
+	return result
+}
+
+func copyNamespaceScope(scope map[string]bool) map[string]bool {
+	result := make(map[string]bool, len(scope)+1)
+	for url := range scope {
+		result[url] = true
+	}
+	return result
+}
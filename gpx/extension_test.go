@@ -0,0 +1,68 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestExtensionsGarmin(t *testing.T) {
+	g, err := ParseFile("../test_files/file.gpx")
+	assertNil(t, err)
+
+	assertEquals(t, g.Namespaces["gpxx"], "http://www.garmin.com/xmlschemas/GpxExtensions/v3")
+	assertEquals(t, g.Namespaces["gpxtpx"], "http://www.garmin.com/xmlschemas/TrackPointExtension/v1")
+	_, found := g.Namespaces["xsi"]
+	assertTrue(t, "xsi is not an extension namespace", !found)
+
+	// Garmin track extension values are moved to the typed fields
+	assertEquals(t, g.Tracks[0].DisplayColor, "Cyan")
+	assertTrue(t, "no extension nodes", g.Tracks[0].Extensions.Empty())
+
+	for _, point := range g.Tracks[0].Segments[0].Points {
+		// TrackPointExtension values are moved to the typed fields
+		assertEquals(t, point.Cadence.Value(), 0)
+		assertTrue(t, "cadence", point.Cadence.NotNull())
+		assertTrue(t, "no extension nodes", point.Extensions.Empty())
+	}
+}
+
+func TestExtensionsUndeclaredNamespace(t *testing.T) {
+	g := new(GPX)
+	g.AppendTrack(&GPXTrack{})
+	g.Tracks[0].AppendSegment(&GPXTrackSegment{})
+	g.Tracks[0].Segments[0].AppendPoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 2}})
+	g.Tracks[0].Segments[0].Points[0].Extensions.Nodes = []ExtensionNode{
+		{XMLName: xml.Name{Space: "http://www.garmin.com/xmlschemas/PowerExtension/v1", Local: "PowerInWatts"}, Data: "120"},
+		{XMLName: xml.Name{Space: "http://example.com/ext", Local: "custom"}, Data: "x"},
+	}
+	g.Tracks[0].Segments[0].Extensions.Nodes = []ExtensionNode{{XMLName: xml.Name{Space: "", Local: "seg"}, Data: "1"}}
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	output := string(xmlBytes)
+	assertTrue(t, "known prefix", strings.Contains(output, `xmlns:gpxpx="http://www.garmin.com/xmlschemas/PowerExtension/v1"`))
+	assertTrue(t, "generated prefix", strings.Contains(output, `<ns1:custom>x</ns1:custom>`))
+	assertTrue(t, "segment extensions", strings.Contains(output, `</trkpt><extensions><seg>1</seg></extensions></trkseg>`))
+
+	reparsed, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	point := reparsed.Tracks[0].Segments[0].Points[0]
+	assertEquals(t, point.Extensions.GetNode("http://www.garmin.com/xmlschemas/PowerExtension/v1", "PowerInWatts").Data, "120")
+	assertEquals(t, point.Extensions.GetNode("http://example.com/ext", "custom").Data, "x")
+	assertEquals(t, reparsed.Tracks[0].Segments[0].Extensions.GetNode("", "seg").Data, "1")
+}
+
+func TestExtensionsIgnoredInGpx10(t *testing.T) {
+	g, err := ParseFile("../test_files/file.gpx")
+	assertNil(t, err)
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.0"})
+	assertNil(t, err)
+	assertTrue(t, "no extensions in 1.0", !strings.Contains(string(xmlBytes), "extensions"))
+	assertTrue(t, "no namespaces in 1.0", !strings.Contains(string(xmlBytes), "gpxx"))
+}
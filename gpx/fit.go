@@ -0,0 +1,447 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// FIT global message numbers
+const (
+	fitFileID  = 0
+	fitSession = 18
+	fitLap     = 19
+	fitRecord  = 20
+	fitEvent   = 21
+)
+
+// FIT field numbers
+const (
+	fitTimestampField = 253
+
+	fitFileIDTimeCreated = 4
+
+	fitSessionStartTime = 2
+	fitSessionSport     = 5
+
+	fitEventEvent     = 0
+	fitEventEventType = 1
+
+	fitRecordLatitude         = 0
+	fitRecordLongitude        = 1
+	fitRecordAltitude         = 2
+	fitRecordHeartRate        = 3
+	fitRecordCadence          = 4
+	fitRecordDistance         = 5
+	fitRecordSpeed            = 6
+	fitRecordPower            = 7
+	fitRecordTemperature      = 13
+	fitRecordEnhancedSpeed    = 73
+	fitRecordEnhancedAltitude = 78
+)
+
+// fitEpoch is the start of FIT timestamps (1989-12-31T00:00:00Z) in Unix time
+const fitEpoch = 631065600
+
+// fitSports are the names of the FIT sport enum values
+var fitSports = map[int64]string{
+	0: "generic", 1: "running", 2: "cycling", 3: "transition", 4: "fitness_equipment",
+	5: "swimming", 6: "basketball", 7: "soccer", 8: "tennis", 9: "american_football",
+	10: "training", 11: "walking", 12: "cross_country_skiing", 13: "alpine_skiing",
+	14: "snowboarding", 15: "rowing", 16: "mountaineering", 17: "hiking",
+	18: "multisport", 19: "paddling",
+}
+
+// fitBaseTypeSizes are the sizes of the FIT base types (the low 5 bits of the
+// base type byte)
+var fitBaseTypeSizes = []int{1, 1, 1, 2, 2, 4, 4, 1, 4, 8, 1, 2, 4, 1, 8, 8, 8}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		for _, nibble := range []byte{b & 0xF, b >> 4} {
+			tmp := fitCRCTable[crc&0xF]
+			crc = (crc >> 4) & 0x0FFF
+			crc = crc ^ tmp ^ fitCRCTable[nibble]
+		}
+	}
+	return crc
+}
+
+type fitFieldDefinition struct {
+	number   byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	byteOrder binary.ByteOrder
+	fields    []fitFieldDefinition
+	// developerSize is the size of the developer fields, they are skipped
+	developerSize int
+}
+
+type fitField struct {
+	data     []byte
+	baseType byte
+}
+
+type fitMessage struct {
+	byteOrder binary.ByteOrder
+	fields    map[byte]fitField
+	// timestamp is the timestamp field or the compressed header timestamp
+	timestamp    uint32
+	hasTimestamp bool
+}
+
+// integer returns the value of an integer field, false if the field is
+// missing or has the invalid value of its base type. Only the first value of
+// array fields is used.
+func (m *fitMessage) integer(number byte) (int64, bool) {
+	field, found := m.fields[number]
+	if !found {
+		return 0, false
+	}
+	baseType := int(field.baseType & 0x1F)
+	if baseType >= len(fitBaseTypeSizes) || len(field.data) < fitBaseTypeSizes[baseType] {
+		return 0, false
+	}
+
+	var value uint64
+	switch fitBaseTypeSizes[baseType] {
+	case 1:
+		value = uint64(field.data[0])
+	case 2:
+		value = uint64(m.byteOrder.Uint16(field.data))
+	case 4:
+		value = uint64(m.byteOrder.Uint32(field.data))
+	case 8:
+		value = m.byteOrder.Uint64(field.data)
+	}
+
+	size := uint(fitBaseTypeSizes[baseType]) * 8
+	switch baseType {
+	case 1, 3, 5, 14: // sint8, sint16, sint32, sint64
+		if value == 1<<(size-1)-1 {
+			return 0, false
+		}
+		// Sign extension:
+		return int64(value<<(64-size)) >> (64 - size), true
+	case 10, 11, 12, 16: // uint8z, uint16z, uint32z, uint64z
+		if value == 0 {
+			return 0, false
+		}
+	case 7, 8, 9: // string, float32, float64
+		return 0, false
+	default:
+		if value == 1<<size-1 {
+			return 0, false
+		}
+	}
+	return int64(value), true
+}
+
+func (m *fitMessage) float(number byte, scale, offset float64) (float64, bool) {
+	value, ok := m.integer(number)
+	return float64(value)/scale - offset, ok
+}
+
+func (m *fitMessage) time(number byte) (time.Time, bool) {
+	value, ok := m.integer(number)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(fitEpoch+value, 0).UTC(), true
+}
+
+type fitSessionStart struct {
+	start time.Time
+	sport string
+}
+
+// fitDecoder contains the state of ParseFIT
+type fitDecoder struct {
+	data        []byte
+	pos         int
+	definitions [16]*fitDefinition
+	// lastTimestamp is the last timestamp field, for compressed timestamps
+	lastTimestamp uint32
+
+	created  time.Time
+	sessions []fitSessionStart
+	points   []GPXPoint
+	// breaks are the indexes of the points starting a new segment
+	breaks     map[int]bool
+	newSegment bool
+}
+
+// ParseFIT decodes a FIT (Flexible and Interoperable Data Transfer) activity
+// file, as recorded by Garmin, Wahoo, Coros and other devices. Each session
+// is converted to a track (with the sport as type), with a new segment after
+// each lap and after each timer stop event. Record messages without position
+// are ignored. Heart rates, cadences, temperatures and speeds are kept in
+// the GPXPoint fields, powers and distances in the point extensions
+// (GarminPowerExtensionV1 PowerInWatts and ClueTrustGpxData distance
+// elements). Developer fields are skipped.
+func ParseFIT(r io.Reader) (*GPX, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &fitDecoder{data: data, breaks: map[int]bool{}}
+	// Chained FIT files are decoded one after the other:
+	for {
+		if err := d.decodeFile(); err != nil {
+			return nil, err
+		}
+		if d.pos >= len(d.data) {
+			break
+		}
+	}
+	return d.gpx(), nil
+}
+
+func (d *fitDecoder) decodeFile() error {
+	start := d.pos
+	if len(d.data)-start < 12 {
+		return errors.New("invalid FIT file header")
+	}
+	headerSize := int(d.data[start])
+	if headerSize < 12 || len(d.data)-start < headerSize || string(d.data[start+8:start+12]) != ".FIT" {
+		return errors.New("invalid FIT file header")
+	}
+	end := start + headerSize + int(binary.LittleEndian.Uint32(d.data[start+4:]))
+	if end+2 > len(d.data) || end < start {
+		return errors.New("truncated FIT file")
+	}
+	if crc := binary.LittleEndian.Uint16(d.data[end:]); crc != fitCRC(d.data[start:end]) {
+		return fmt.Errorf("invalid FIT file CRC %04x", crc)
+	}
+
+	d.pos = start + headerSize
+	for d.pos < end {
+		if err := d.decodeRecord(end); err != nil {
+			return err
+		}
+	}
+	d.pos = end + 2
+	return nil
+}
+
+// read returns the next size bytes of the current file
+func (d *fitDecoder) read(size, end int) ([]byte, error) {
+	if d.pos+size > end {
+		return nil, errors.New("truncated FIT record")
+	}
+	result := d.data[d.pos : d.pos+size]
+	d.pos += size
+	return result, nil
+}
+
+func (d *fitDecoder) decodeRecord(end int) error {
+	header, err := d.read(1, end)
+	if err != nil {
+		return err
+	}
+
+	if header[0]&0x80 != 0 {
+		// Compressed timestamp header, the offset is added to the last
+		// timestamp:
+		offset := uint32(header[0] & 0x1F)
+		timestamp := d.lastTimestamp&^0x1F + offset
+		if offset < d.lastTimestamp&0x1F {
+			timestamp += 0x20
+		}
+		return d.decodeData(int(header[0]>>5&0x03), end, &timestamp)
+	}
+
+	local := int(header[0] & 0x0F)
+	if header[0]&0x40 != 0 {
+		return d.decodeDefinition(local, header[0]&0x20 != 0, end)
+	}
+	return d.decodeData(local, end, nil)
+}
+
+func (d *fitDecoder) decodeDefinition(local int, developerFields bool, end int) error {
+	header, err := d.read(5, end)
+	if err != nil {
+		return err
+	}
+	definition := &fitDefinition{byteOrder: binary.LittleEndian}
+	if header[1] == 1 {
+		definition.byteOrder = binary.BigEndian
+	}
+	definition.global = definition.byteOrder.Uint16(header[2:])
+
+	fields, err := d.read(3*int(header[4]), end)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		definition.fields = append(definition.fields, fitFieldDefinition{number: fields[i], size: int(fields[i+1]), baseType: fields[i+2]})
+	}
+
+	if developerFields {
+		count, err := d.read(1, end)
+		if err != nil {
+			return err
+		}
+		fields, err := d.read(3*int(count[0]), end)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(fields); i += 3 {
+			definition.developerSize += int(fields[i+1])
+		}
+	}
+
+	d.definitions[local] = definition
+	return nil
+}
+
+func (d *fitDecoder) decodeData(local, end int, timestamp *uint32) error {
+	definition := d.definitions[local]
+	if definition == nil {
+		return fmt.Errorf("FIT data message with undefined local message type %d", local)
+	}
+
+	msg := fitMessage{byteOrder: definition.byteOrder, fields: map[byte]fitField{}}
+	for _, field := range definition.fields {
+		data, err := d.read(field.size, end)
+		if err != nil {
+			return err
+		}
+		msg.fields[field.number] = fitField{data: data, baseType: field.baseType}
+	}
+	if _, err := d.read(definition.developerSize, end); err != nil {
+		return err
+	}
+
+	if value, ok := msg.integer(fitTimestampField); ok {
+		d.lastTimestamp = uint32(value)
+		msg.timestamp, msg.hasTimestamp = uint32(value), true
+	} else if timestamp != nil {
+		d.lastTimestamp = *timestamp
+		msg.timestamp, msg.hasTimestamp = *timestamp, true
+	}
+
+	switch definition.global {
+	case fitFileID:
+		if created, ok := msg.time(fitFileIDTimeCreated); ok {
+			d.created = created
+		}
+	case fitSession:
+		if start, ok := msg.time(fitSessionStartTime); ok {
+			sport, _ := msg.integer(fitSessionSport)
+			d.sessions = append(d.sessions, fitSessionStart{start: start, sport: fitSports[sport]})
+		}
+	case fitLap:
+		d.newSegment = true
+	case fitEvent:
+		event, _ := msg.integer(fitEventEvent)
+		eventType, _ := msg.integer(fitEventEventType)
+		// Timer stop, stop_all, stop_disable and stop_disable_all:
+		if event == 0 && (eventType == 1 || eventType == 4 || eventType == 8 || eventType == 9) {
+			d.newSegment = true
+		}
+	case fitRecord:
+		d.decodeRecordMessage(&msg)
+	}
+	return nil
+}
+
+func (d *fitDecoder) decodeRecordMessage(msg *fitMessage) {
+	lat, latOk := msg.integer(fitRecordLatitude)
+	lon, lonOk := msg.integer(fitRecordLongitude)
+	if !latOk || !lonOk {
+		return
+	}
+
+	// Semicircles to degrees:
+	point := GPXPoint{Point: Point{Latitude: float64(lat) * 180 / (1 << 31), Longitude: float64(lon) * 180 / (1 << 31)}}
+	if msg.hasTimestamp {
+		point.Timestamp = time.Unix(fitEpoch+int64(msg.timestamp), 0).UTC()
+	}
+	if altitude, ok := msg.float(fitRecordEnhancedAltitude, 5, 500); ok {
+		point.Elevation.SetValue(altitude)
+	} else if altitude, ok := msg.float(fitRecordAltitude, 5, 500); ok {
+		point.Elevation.SetValue(altitude)
+	}
+	if speed, ok := msg.float(fitRecordEnhancedSpeed, 1000, 0); ok {
+		point.Speed.SetValue(speed)
+	} else if speed, ok := msg.float(fitRecordSpeed, 1000, 0); ok {
+		point.Speed.SetValue(speed)
+	}
+	if heartRate, ok := msg.integer(fitRecordHeartRate); ok {
+		point.HeartRate.SetValue(int(heartRate))
+	}
+	if cadence, ok := msg.integer(fitRecordCadence); ok {
+		point.Cadence.SetValue(int(cadence))
+	}
+	if temperature, ok := msg.integer(fitRecordTemperature); ok {
+		point.Temperature.SetValue(float64(temperature))
+	}
+	if power, ok := msg.integer(fitRecordPower); ok {
+		point.Extensions.Nodes = append(point.Extensions.Nodes, simpleExtensionNode(GarminPowerExtensionV1, "PowerInWatts", fmt.Sprint(power)))
+	}
+	if distance, ok := msg.float(fitRecordDistance, 100, 0); ok {
+		point.Extensions.Nodes = append(point.Extensions.Nodes, simpleExtensionNode(ClueTrustGpxData, "distance", formatExtensionFloat(distance)))
+	}
+
+	if d.newSegment {
+		d.breaks[len(d.points)] = true
+		d.newSegment = false
+	}
+	d.points = append(d.points, point)
+}
+
+// gpx builds the tracks, the points are assigned to the sessions by time
+func (d *fitDecoder) gpx() *GPX {
+	g := &GPX{Version: "1.1"}
+	if !d.created.IsZero() {
+		created := d.created
+		g.Time = &created
+	}
+
+	sort.SliceStable(d.sessions, func(i, j int) bool { return d.sessions[i].start.Before(d.sessions[j].start) })
+	if len(d.sessions) == 0 {
+		d.sessions = []fitSessionStart{{}}
+	}
+
+	sessionNo := -1
+	var track *GPXTrack
+	for pointNo := range d.points {
+		point := &d.points[pointNo]
+		newSessionNo := sessionNo
+		for newSessionNo+1 < len(d.sessions) && (newSessionNo < 0 || !point.Timestamp.Before(d.sessions[newSessionNo+1].start)) {
+			newSessionNo++
+		}
+		if newSessionNo != sessionNo {
+			sessionNo = newSessionNo
+			g.AppendTrack(&GPXTrack{Type: d.sessions[sessionNo].sport})
+			track = &g.Tracks[len(g.Tracks)-1]
+			track.AppendSegment(new(GPXTrackSegment))
+		} else if d.breaks[pointNo] && len(track.Segments[len(track.Segments)-1].Points) > 0 {
+			track.AppendSegment(new(GPXTrackSegment))
+		}
+		segment := &track.Segments[len(track.Segments)-1]
+		segment.Points = append(segment.Points, *point)
+	}
+	return g
+}
@@ -0,0 +1,213 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fitTestWriter builds FIT files for the tests
+type fitTestWriter struct {
+	data bytes.Buffer
+}
+
+type fitTestDefinition struct {
+	local     byte
+	global    uint16
+	bigEndian bool
+	fields    [][3]byte
+	developer [][3]byte
+}
+
+func (w *fitTestWriter) definition(def fitTestDefinition) {
+	header := 0x40 | def.local
+	if len(def.developer) > 0 {
+		header |= 0x20
+	}
+	w.data.WriteByte(header)
+	w.data.WriteByte(0)
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if def.bigEndian {
+		byteOrder = binary.BigEndian
+		w.data.WriteByte(1)
+	} else {
+		w.data.WriteByte(0)
+	}
+	binary.Write(&w.data, byteOrder, def.global)
+	w.data.WriteByte(byte(len(def.fields)))
+	for _, field := range def.fields {
+		w.data.Write(field[:])
+	}
+	if len(def.developer) > 0 {
+		w.data.WriteByte(byte(len(def.developer)))
+		for _, field := range def.developer {
+			w.data.Write(field[:])
+		}
+	}
+}
+
+func (w *fitTestWriter) message(header byte, byteOrder binary.ByteOrder, values ...interface{}) {
+	w.data.WriteByte(header)
+	for _, value := range values {
+		binary.Write(&w.data, byteOrder, value)
+	}
+}
+
+func (w *fitTestWriter) bytes() []byte {
+	var result bytes.Buffer
+	result.WriteByte(14)
+	result.WriteByte(0x20)
+	binary.Write(&result, binary.LittleEndian, uint16(2093))
+	binary.Write(&result, binary.LittleEndian, uint32(w.data.Len()))
+	result.WriteString(".FIT")
+	binary.Write(&result, binary.LittleEndian, fitCRC(result.Bytes()))
+	result.Write(w.data.Bytes())
+	binary.Write(&result, binary.LittleEndian, fitCRC(result.Bytes()))
+	return result.Bytes()
+}
+
+func fitTestSemicircles(degrees float64) int32 {
+	return int32(degrees / 180 * (1 << 31))
+}
+
+// fitTestFile returns a file starting at t0 (a multiple of 32)
+func fitTestFile(t0 uint32) []byte {
+	le := binary.LittleEndian
+	w := new(fitTestWriter)
+
+	w.definition(fitTestDefinition{local: 0, global: fitFileID, fields: [][3]byte{{4, 4, 0x86}}})
+	w.message(0, le, t0-60)
+
+	// Record with all fields and a developer field:
+	w.definition(fitTestDefinition{local: 1, global: fitRecord, fields: [][3]byte{
+		{253, 4, 0x86}, {0, 4, 0x85}, {1, 4, 0x85}, {78, 4, 0x86}, {3, 1, 0x02},
+		{4, 1, 0x02}, {5, 4, 0x86}, {73, 4, 0x86}, {7, 2, 0x84}, {13, 1, 0x01},
+	}, developer: [][3]byte{{0, 2, 0}}})
+	w.message(1, le, t0, fitTestSemicircles(46), fitTestSemicircles(13), uint32((1000+500)*5), uint8(120),
+		uint8(80), uint32(0), uint32(2500), uint16(250), int8(-5), uint16(0xABCD))
+
+	// Records with compressed timestamps (the second one rolls over):
+	w.definition(fitTestDefinition{local: 2, global: fitRecord, fields: [][3]byte{
+		{0, 4, 0x85}, {1, 4, 0x85}, {2, 2, 0x84}, {6, 2, 0x84}, {3, 1, 0x02},
+	}})
+	w.message(0x80|2<<5|5, le, fitTestSemicircles(46.001), fitTestSemicircles(13), uint16((1010+500)*5), uint16(3000), uint8(0xFF))
+	w.message(0x80|2<<5|2, le, fitTestSemicircles(46.002), fitTestSemicircles(13), uint16(0xFFFF), uint16(0xFFFF), uint8(0xFF))
+
+	// Record without position:
+	w.message(1, le, t0+35, int32(0x7FFFFFFF), int32(0x7FFFFFFF), uint32(0xFFFFFFFF), uint8(130),
+		uint8(0xFF), uint32(0xFFFFFFFF), uint32(0xFFFFFFFF), uint16(0xFFFF), int8(0x7F), uint16(0))
+
+	// Timer stop and start:
+	w.definition(fitTestDefinition{local: 3, global: fitEvent, fields: [][3]byte{{253, 4, 0x86}, {0, 1, 0x00}, {1, 1, 0x00}}})
+	w.message(3, le, t0+40, uint8(0), uint8(4))
+	w.message(3, le, t0+100, uint8(0), uint8(0))
+
+	w.message(1, le, t0+100, fitTestSemicircles(46.003), fitTestSemicircles(13), uint32(0xFFFFFFFF), uint8(0xFF),
+		uint8(0xFF), uint32(0xFFFFFFFF), uint32(0xFFFFFFFF), uint16(0xFFFF), int8(0x7F), uint16(0))
+
+	w.definition(fitTestDefinition{local: 4, global: fitLap, fields: [][3]byte{{253, 4, 0x86}}})
+	w.message(4, le, t0+101)
+
+	w.message(1, le, t0+110, fitTestSemicircles(46.004), fitTestSemicircles(13), uint32(0xFFFFFFFF), uint8(0xFF),
+		uint8(0xFF), uint32(0xFFFFFFFF), uint32(0xFFFFFFFF), uint16(0xFFFF), int8(0x7F), uint16(0))
+
+	// Second session:
+	w.message(1, le, t0+200, fitTestSemicircles(-46.5), fitTestSemicircles(-13.5), uint32(0xFFFFFFFF), uint8(0xFF),
+		uint8(0xFF), uint32(0xFFFFFFFF), uint32(0xFFFFFFFF), uint16(0xFFFF), int8(0x7F), uint16(0))
+
+	// Sessions (big endian) are written at the end:
+	w.definition(fitTestDefinition{local: 5, global: fitSession, bigEndian: true, fields: [][3]byte{{253, 4, 0x86}, {2, 4, 0x86}, {5, 1, 0x00}}})
+	w.message(5, binary.BigEndian, t0+150, t0, uint8(1))
+	w.message(5, binary.BigEndian, t0+250, t0+200, uint8(2))
+
+	return w.bytes()
+}
+
+func fitTestTime(seconds int64) time.Time {
+	return time.Unix(fitEpoch+1000000000+seconds, 0).UTC()
+}
+
+func TestParseFIT(t *testing.T) {
+	g, err := ParseFIT(bytes.NewReader(fitTestFile(1000000000)))
+	assertNil(t, err)
+
+	assertTrue(t, "created", g.Time != nil && g.Time.Equal(fitTestTime(-60)))
+	assertEquals(t, len(g.Tracks), 2)
+	assertEquals(t, g.Tracks[0].Type, "running")
+	assertEquals(t, g.Tracks[1].Type, "cycling")
+
+	// New segments after the timer stop and after the lap:
+	segments := g.Tracks[0].Segments
+	assertEquals(t, len(segments), 3)
+	assertEquals(t, len(segments[0].Points), 3)
+	assertEquals(t, len(segments[1].Points), 1)
+	assertEquals(t, len(segments[2].Points), 1)
+	assertEquals(t, len(g.Tracks[1].Segments), 1)
+
+	first := segments[0].Points[0]
+	assertTrue(t, "latitude", cca(first.Latitude, 46))
+	assertTrue(t, "longitude", cca(first.Longitude, 13))
+	assertTrue(t, "time", first.Timestamp.Equal(fitTestTime(0)))
+	assertEquals(t, first.Elevation.Value(), 1000.0)
+	assertEquals(t, first.HeartRate.Value(), 120)
+	assertEquals(t, first.Cadence.Value(), 80)
+	assertEquals(t, first.Speed.Value(), 2.5)
+	assertEquals(t, first.Temperature.Value(), -5.0)
+	assertEquals(t, first.Extensions.GetNode(GarminPowerExtensionV1, "PowerInWatts").Data, "250")
+	assertEquals(t, first.Extensions.GetNode(ClueTrustGpxData, "distance").Data, "0")
+
+	second := segments[0].Points[1]
+	assertTrue(t, "compressed time", second.Timestamp.Equal(fitTestTime(5)))
+	assertEquals(t, second.Elevation.Value(), 1010.0)
+	assertEquals(t, second.Speed.Value(), 3.0)
+	assertTrue(t, "invalid heart rate", second.HeartRate.Null())
+
+	third := segments[0].Points[2]
+	assertTrue(t, "compressed time rollover", third.Timestamp.Equal(fitTestTime(34)))
+	assertTrue(t, "invalid elevation", third.Elevation.Null())
+	assertTrue(t, "invalid speed", third.Speed.Null())
+
+	assertTrue(t, "after timer stop", segments[1].Points[0].Timestamp.Equal(fitTestTime(100)))
+	assertTrue(t, "after lap", segments[2].Points[0].Timestamp.Equal(fitTestTime(110)))
+	last := g.Tracks[1].Segments[0].Points[0]
+	assertTrue(t, "negative latitude", cca(last.Latitude, -46.5))
+	assertTrue(t, "negative longitude", cca(last.Longitude, -13.5))
+	assertTrue(t, "no extensions", last.Extensions.Empty())
+
+	xml, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	assertTrue(t, "power extension", strings.Contains(string(xml), "<gpxpx:PowerInWatts>250</gpxpx:PowerInWatts>"))
+}
+
+func TestParseFITChained(t *testing.T) {
+	file := append(fitTestFile(1000000000), fitTestFile(1000003200)...)
+	g, err := ParseFIT(bytes.NewReader(file))
+	assertNil(t, err)
+	assertEquals(t, len(g.Tracks), 4)
+}
+
+func TestParseFITErrors(t *testing.T) {
+	file := fitTestFile(1000000000)
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"not FIT":   []byte(strings.Repeat("x", 20)),
+		"truncated": file[:len(file)-10],
+		"crc":       append(append([]byte{}, file[:len(file)-1]...), file[len(file)-1]^0xFF),
+	} {
+		_, err := ParseFIT(bytes.NewReader(data))
+		assertTrue(t, "error expected for "+name, err != nil)
+	}
+
+	// Data message for an undefined local message type:
+	w := new(fitTestWriter)
+	w.message(3, binary.LittleEndian, uint8(1))
+	_, err := ParseFIT(bytes.NewReader(w.bytes()))
+	assertTrue(t, "undefined local message", err != nil)
+}
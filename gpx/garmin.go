@@ -0,0 +1,497 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Garmin extension namespaces
+const (
+	GarminGpxExtensionsV3       = "http://www.garmin.com/xmlschemas/GpxExtensions/v3"
+	GarminTrackPointExtensionV1 = "http://www.garmin.com/xmlschemas/TrackPointExtension/v1"
+	GarminTrackPointExtensionV2 = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+	GarminPowerExtensionV1      = "http://www.garmin.com/xmlschemas/PowerExtension/v1"
+)
+
+// Child elements of the Garmin extensions, in schema order
+var (
+	trackPointExtensionOrder  = []string{"atemp", "wtemp", "depth", "hr", "cad", "speed", "course", "bearing", "Extensions"}
+	gpxxWaypointOrder         = []string{"Proximity", "Temperature", "Depth", "DisplayMode", "Categories", "Address", "PhoneNumber", "Samples", "Extensions"}
+	gpxxRoutePointOrder       = []string{"Subclass", "rpt", "Extensions"}
+	gpxxRouteOrder            = []string{"IsAutoNamed", "DisplayColor", "Extensions"}
+	gpxxTrackOrder            = []string{"DisplayColor", "Extensions"}
+	trackPointExtensionSpaces = []string{GarminTrackPointExtensionV1, GarminTrackPointExtensionV2}
+	gpxxSpaces                = []string{GarminGpxExtensionsV3}
+)
+
+//GPXAddress is a postal address (from the Garmin WaypointExtension)
+type GPXAddress struct {
+	StreetAddress []string
+	City          string
+	State         string
+	Country       string
+	PostalCode    string
+}
+
+//Empty checks if no address field is set
+func (a *GPXAddress) Empty() bool {
+	return len(a.StreetAddress) == 0 && len(a.City) == 0 && len(a.State) == 0 && len(a.Country) == 0 && len(a.PostalCode) == 0
+}
+
+//GPXPhoneNumber is a phone number with an optional category (from the Garmin WaypointExtension)
+type GPXPhoneNumber struct {
+	Number   string
+	Category string
+}
+
+//GPXShapingPoint is a point of the path calculated by a Garmin device between
+//two route points (from the Garmin RoutePointExtension)
+type GPXShapingPoint struct {
+	Point
+	// Subclass is the hex encoded Garmin map data, optional
+	Subclass string
+}
+
+// ----------------------------------------------------------------------------------------------------
+// Helpers
+// ----------------------------------------------------------------------------------------------------
+
+func inNamespaces(space string, namespaces []string) bool {
+	for _, ns := range namespaces {
+		if space == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func isExtensionNode(node *ExtensionNode, namespaces []string, name string) bool {
+	return node.XMLName.Local == name && inNamespaces(node.XMLName.Space, namespaces)
+}
+
+// isSimpleNode checks if the node has only text content
+func isSimpleNode(node *ExtensionNode) bool {
+	return len(node.Nodes) == 0 && len(node.Attrs) == 0
+}
+
+// readExtensionNode calls read with the children of the first node with the
+// given name, read returns the children it doesn't understand. Nodes left
+// without children are removed from the extensions.
+func readExtensionNode(ext *Extension, namespaces []string, name string, read func(children []ExtensionNode) []ExtensionNode) {
+	nodes := ext.Nodes[:0]
+	found := false
+	for _, node := range ext.Nodes {
+		if !found && isExtensionNode(&node, namespaces, name) {
+			found = true
+			node.Nodes = read(node.Nodes)
+			if len(node.Nodes) == 0 && len(node.Attrs) == 0 {
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		nodes = nil
+	}
+	ext.Nodes = nodes
+}
+
+// mergeExtensionNode returns a copy of ext where the typed children are added
+// to the first node with the given name (or a new node if none exists). The
+// children are sorted by the schema order.
+func mergeExtensionNode(ext *Extension, namespaces []string, name string, typed []ExtensionNode, order []string) *Extension {
+	if len(typed) == 0 {
+		return ext
+	}
+	result := &Extension{Nodes: make([]ExtensionNode, len(ext.Nodes))}
+	copy(result.Nodes, ext.Nodes)
+
+	var node *ExtensionNode
+	for nodeNo := range result.Nodes {
+		if isExtensionNode(&result.Nodes[nodeNo], namespaces, name) {
+			node = &result.Nodes[nodeNo]
+			break
+		}
+	}
+	if node == nil {
+		result.Nodes = append(result.Nodes, ExtensionNode{XMLName: xml.Name{Space: namespaces[0], Local: name}})
+		node = &result.Nodes[len(result.Nodes)-1]
+	}
+
+	children := make([]ExtensionNode, 0, len(typed)+len(node.Nodes))
+	children = append(children, typed...)
+	children = append(children, node.Nodes...)
+	rank := func(child *ExtensionNode) int {
+		for i, name := range order {
+			if name == child.XMLName.Local {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return rank(&children[i]) < rank(&children[j])
+	})
+	node.Nodes = children
+	return result
+}
+
+func simpleExtensionNode(space, name, value string) ExtensionNode {
+	return ExtensionNode{XMLName: xml.Name{Space: space, Local: name}, Data: value}
+}
+
+func formatExtensionFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// ----------------------------------------------------------------------------------------------------
+// TrackPointExtension (v1 and v2)
+// ----------------------------------------------------------------------------------------------------
+
+// trackPointExtensionField is a simple element of the Garmin TrackPointExtension
+type trackPointExtensionField struct {
+	name string
+	// only in TrackPointExtension v2
+	v2    bool
+	float func(pt *GPXPoint) *NullableFloat64
+	int   func(pt *GPXPoint) *NullableInt
+}
+
+var trackPointExtensionFields = []trackPointExtensionField{
+	{name: "atemp", float: func(pt *GPXPoint) *NullableFloat64 { return &pt.Temperature }},
+	{name: "wtemp", float: func(pt *GPXPoint) *NullableFloat64 { return &pt.WaterTemperature }},
+	{name: "depth", float: func(pt *GPXPoint) *NullableFloat64 { return &pt.Depth }},
+	{name: "hr", int: func(pt *GPXPoint) *NullableInt { return &pt.HeartRate }},
+	{name: "cad", int: func(pt *GPXPoint) *NullableInt { return &pt.Cadence }},
+	{name: "speed", v2: true, float: func(pt *GPXPoint) *NullableFloat64 { return &pt.Speed }},
+	{name: "course", v2: true, float: func(pt *GPXPoint) *NullableFloat64 { return &pt.Course }},
+}
+
+func readTrackPointExtensionFields(pt *GPXPoint, children []ExtensionNode) []ExtensionNode {
+	var remaining []ExtensionNode
+	for _, child := range children {
+		if !setTrackPointExtensionField(pt, &child) {
+			remaining = append(remaining, child)
+		}
+	}
+	return remaining
+}
+
+func setTrackPointExtensionField(pt *GPXPoint, child *ExtensionNode) bool {
+	if !inNamespaces(child.XMLName.Space, trackPointExtensionSpaces) || !isSimpleNode(child) {
+		return false
+	}
+	value := strings.TrimSpace(child.Data)
+	for _, field := range trackPointExtensionFields {
+		if field.name != child.XMLName.Local {
+			continue
+		}
+		if field.int != nil {
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return false
+			}
+			field.int(pt).SetValue(i)
+		} else {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false
+			}
+			field.float(pt).SetValue(f)
+		}
+		if pt.trackPointExtensionSpace != GarminTrackPointExtensionV2 {
+			pt.trackPointExtensionSpace = child.XMLName.Space
+		}
+		return true
+	}
+	return false
+}
+
+func mergeTrackPointExtension(pt *GPXPoint, ext *Extension) *Extension {
+	var typed []ExtensionNode
+	v2 := false
+	for _, field := range trackPointExtensionFields {
+		var value string
+		if field.int != nil && field.int(pt).NotNull() {
+			value = strconv.Itoa(field.int(pt).Value())
+		} else if field.float != nil && field.float(pt).NotNull() {
+			value = formatExtensionFloat(field.float(pt).Value())
+		} else {
+			continue
+		}
+		v2 = v2 || field.v2
+		typed = append(typed, simpleExtensionNode(GarminTrackPointExtensionV1, field.name, value))
+	}
+	result := mergeExtensionNode(ext, trackPointExtensionSpaces, "TrackPointExtension", typed, trackPointExtensionOrder)
+	if len(typed) == 0 {
+		return result
+	}
+
+	// All the elements must use the namespace of the TrackPointExtension
+	// element, speed and course exist only in v2 (v2 is a superset of v1).
+	// Values parsed from v2 are written as v2.
+	for nodeNo := range result.Nodes {
+		node := &result.Nodes[nodeNo]
+		if !isExtensionNode(node, trackPointExtensionSpaces, "TrackPointExtension") {
+			continue
+		}
+		if v2 || pt.trackPointExtensionSpace == GarminTrackPointExtensionV2 {
+			node.XMLName.Space = GarminTrackPointExtensionV2
+		}
+		for childNo := range node.Nodes {
+			if inNamespaces(node.Nodes[childNo].XMLName.Space, trackPointExtensionSpaces) {
+				node.Nodes[childNo].XMLName.Space = node.XMLName.Space
+			}
+		}
+		break
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------------------------------
+// GpxExtensions v3
+// ----------------------------------------------------------------------------------------------------
+
+func readGpxxWaypointExtension(pt *GPXPoint, children []ExtensionNode) []ExtensionNode {
+	var remaining []ExtensionNode
+	for _, child := range children {
+		if child.XMLName.Space != GarminGpxExtensionsV3 || !readGpxxWaypointField(pt, &child) {
+			remaining = append(remaining, child)
+		}
+	}
+	return remaining
+}
+
+func readGpxxWaypointField(pt *GPXPoint, child *ExtensionNode) bool {
+	switch child.XMLName.Local {
+	case "Proximity":
+		if !isSimpleNode(child) {
+			return false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(child.Data), 64)
+		if err != nil {
+			return false
+		}
+		pt.Proximity.SetValue(f)
+		return true
+	case "Categories":
+		var categories []string
+		for _, category := range child.Nodes {
+			if !isExtensionNode(&category, gpxxSpaces, "Category") || !isSimpleNode(&category) {
+				return false
+			}
+			categories = append(categories, category.Data)
+		}
+		pt.Categories = append(pt.Categories, categories...)
+		return true
+	case "Address":
+		var address GPXAddress
+		for _, field := range child.Nodes {
+			if field.XMLName.Space != GarminGpxExtensionsV3 || !isSimpleNode(&field) {
+				return false
+			}
+			switch field.XMLName.Local {
+			case "StreetAddress":
+				address.StreetAddress = append(address.StreetAddress, field.Data)
+			case "City":
+				address.City = field.Data
+			case "State":
+				address.State = field.Data
+			case "Country":
+				address.Country = field.Data
+			case "PostalCode":
+				address.PostalCode = field.Data
+			default:
+				return false
+			}
+		}
+		pt.Address = address
+		return true
+	case "PhoneNumber":
+		if len(child.Nodes) > 0 {
+			return false
+		}
+		phoneNumber := GPXPhoneNumber{Number: child.Data}
+		for _, attr := range child.Attrs {
+			if attr.Name.Local != "Category" {
+				return false
+			}
+			phoneNumber.Category = attr.Value
+		}
+		pt.PhoneNumbers = append(pt.PhoneNumbers, phoneNumber)
+		return true
+	}
+	return false
+}
+
+func mergeGpxxWaypointExtension(pt *GPXPoint, ext *Extension) *Extension {
+	var typed []ExtensionNode
+	if pt.Proximity.NotNull() {
+		typed = append(typed, simpleExtensionNode(GarminGpxExtensionsV3, "Proximity", formatExtensionFloat(pt.Proximity.Value())))
+	}
+	if len(pt.Categories) > 0 {
+		categories := ExtensionNode{XMLName: xml.Name{Space: GarminGpxExtensionsV3, Local: "Categories"}}
+		for _, category := range pt.Categories {
+			categories.Nodes = append(categories.Nodes, simpleExtensionNode(GarminGpxExtensionsV3, "Category", category))
+		}
+		typed = append(typed, categories)
+	}
+	if !pt.Address.Empty() {
+		address := ExtensionNode{XMLName: xml.Name{Space: GarminGpxExtensionsV3, Local: "Address"}}
+		for _, street := range pt.Address.StreetAddress {
+			address.Nodes = append(address.Nodes, simpleExtensionNode(GarminGpxExtensionsV3, "StreetAddress", street))
+		}
+		for _, field := range [][2]string{{"City", pt.Address.City}, {"State", pt.Address.State}, {"Country", pt.Address.Country}, {"PostalCode", pt.Address.PostalCode}} {
+			if len(field[1]) > 0 {
+				address.Nodes = append(address.Nodes, simpleExtensionNode(GarminGpxExtensionsV3, field[0], field[1]))
+			}
+		}
+		typed = append(typed, address)
+	}
+	for _, phoneNumber := range pt.PhoneNumbers {
+		node := simpleExtensionNode(GarminGpxExtensionsV3, "PhoneNumber", phoneNumber.Number)
+		if len(phoneNumber.Category) > 0 {
+			node.Attrs = []xml.Attr{{Name: xml.Name{Local: "Category"}, Value: phoneNumber.Category}}
+		}
+		typed = append(typed, node)
+	}
+	return mergeExtensionNode(ext, gpxxSpaces, "WaypointExtension", typed, gpxxWaypointOrder)
+}
+
+func readGpxxRoutePointExtension(pt *GPXPoint, children []ExtensionNode) []ExtensionNode {
+	var remaining []ExtensionNode
+	var shapingPoints []GPXShapingPoint
+	for _, child := range children {
+		if !isExtensionNode(&child, gpxxSpaces, "rpt") {
+			remaining = append(remaining, child)
+			continue
+		}
+		point, ok := readGpxxShapingPoint(&child)
+		if !ok {
+			// Keep all the shaping points in the tree, to preserve their order
+			return children
+		}
+		shapingPoints = append(shapingPoints, point)
+	}
+	pt.ShapingPoints = shapingPoints
+	return remaining
+}
+
+func readGpxxShapingPoint(node *ExtensionNode) (GPXShapingPoint, bool) {
+	var point GPXShapingPoint
+	if len(node.Attrs) != 2 || len(node.Nodes) > 1 {
+		return point, false
+	}
+	for _, subclass := range node.Nodes {
+		if !isExtensionNode(&subclass, gpxxSpaces, "Subclass") || !isSimpleNode(&subclass) {
+			return point, false
+		}
+		point.Subclass = strings.TrimSpace(subclass.Data)
+	}
+	var latFound, lonFound bool
+	for _, attr := range node.Attrs {
+		var err error
+		switch attr.Name.Local {
+		case "lat":
+			point.Latitude, err = strconv.ParseFloat(attr.Value, 64)
+			latFound = true
+		case "lon":
+			point.Longitude, err = strconv.ParseFloat(attr.Value, 64)
+			lonFound = true
+		}
+		if err != nil {
+			return point, false
+		}
+	}
+	return point, latFound && lonFound
+}
+
+func mergeGpxxRoutePointExtension(pt *GPXPoint, ext *Extension) *Extension {
+	var typed []ExtensionNode
+	for _, point := range pt.ShapingPoints {
+		node := ExtensionNode{
+			XMLName: xml.Name{Space: GarminGpxExtensionsV3, Local: "rpt"},
+			Attrs: []xml.Attr{
+				{Name: xml.Name{Local: "lat"}, Value: formatExtensionFloat(point.Latitude)},
+				{Name: xml.Name{Local: "lon"}, Value: formatExtensionFloat(point.Longitude)},
+			},
+		}
+		if len(point.Subclass) > 0 {
+			node.Nodes = []ExtensionNode{simpleExtensionNode(GarminGpxExtensionsV3, "Subclass", point.Subclass)}
+		}
+		typed = append(typed, node)
+	}
+	return mergeExtensionNode(ext, gpxxSpaces, "RoutePointExtension", typed, gpxxRoutePointOrder)
+}
+
+// readDisplayColor reads the DisplayColor element of a route or track extension
+func readDisplayColor(displayColor *string, children []ExtensionNode) []ExtensionNode {
+	var remaining []ExtensionNode
+	for _, child := range children {
+		if isExtensionNode(&child, gpxxSpaces, "DisplayColor") && isSimpleNode(&child) {
+			*displayColor = strings.TrimSpace(child.Data)
+		} else {
+			remaining = append(remaining, child)
+		}
+	}
+	return remaining
+}
+
+func mergeDisplayColor(displayColor string, ext *Extension, name string, order []string) *Extension {
+	if len(displayColor) == 0 {
+		return ext
+	}
+	typed := []ExtensionNode{simpleExtensionNode(GarminGpxExtensionsV3, "DisplayColor", displayColor)}
+	return mergeExtensionNode(ext, gpxxSpaces, name, typed, order)
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// readTypedExtensions moves the known Garmin extension values to the typed
+// point fields, unknown or invalid elements are left in the extension tree
+func (pt *GPXPoint) readTypedExtensions() {
+	readExtensionNode(&pt.Extensions, trackPointExtensionSpaces, "TrackPointExtension", func(children []ExtensionNode) []ExtensionNode {
+		return readTrackPointExtensionFields(pt, children)
+	})
+	readExtensionNode(&pt.Extensions, gpxxSpaces, "WaypointExtension", func(children []ExtensionNode) []ExtensionNode {
+		return readGpxxWaypointExtension(pt, children)
+	})
+	readExtensionNode(&pt.Extensions, gpxxSpaces, "RoutePointExtension", func(children []ExtensionNode) []ExtensionNode {
+		return readGpxxRoutePointExtension(pt, children)
+	})
+}
+
+// allExtensions returns the point extensions including the ones built from
+// the typed fields
+func (pt *GPXPoint) allExtensions() *Extension {
+	result := mergeTrackPointExtension(pt, &pt.Extensions)
+	result = mergeGpxxWaypointExtension(pt, result)
+	return mergeGpxxRoutePointExtension(pt, result)
+}
+
+func (rte *GPXRoute) readTypedExtensions() {
+	readExtensionNode(&rte.Extensions, gpxxSpaces, "RouteExtension", func(children []ExtensionNode) []ExtensionNode {
+		return readDisplayColor(&rte.DisplayColor, children)
+	})
+}
+
+func (rte *GPXRoute) allExtensions() *Extension {
+	return mergeDisplayColor(rte.DisplayColor, &rte.Extensions, "RouteExtension", gpxxRouteOrder)
+}
+
+func (trk *GPXTrack) readTypedExtensions() {
+	readExtensionNode(&trk.Extensions, gpxxSpaces, "TrackExtension", func(children []ExtensionNode) []ExtensionNode {
+		return readDisplayColor(&trk.DisplayColor, children)
+	})
+}
+
+func (trk *GPXTrack) allExtensions() *Extension {
+	return mergeDisplayColor(trk.DisplayColor, &trk.Extensions, "TrackExtension", gpxxTrackOrder)
+}
@@ -0,0 +1,230 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"strings"
+	"testing"
+)
+
+const trackPointExtensionGpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2" version="1.1" creator="test">
+	<trk>
+		<trkseg>
+			<trkpt lat="1" lon="1">
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:atemp>21.5</gpxtpx:atemp>
+						<gpxtpx:hr>120</gpxtpx:hr>
+						<gpxtpx:cad>80</gpxtpx:cad>
+						<gpxtpx:speed>3.2</gpxtpx:speed>
+						<gpxtpx:course>90</gpxtpx:course>
+						<gpxtpx:bearing>45</gpxtpx:bearing>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
+			</trkpt>
+			<trkpt lat="1.001" lon="1.001">
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:hr>140</gpxtpx:hr>
+						<gpxtpx:cad>aaa</gpxtpx:cad>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
+			</trkpt>
+			<trkpt lat="1.002" lon="1.002"></trkpt>
+		</trkseg>
+	</trk>
+</gpx>`
+
+func TestTrackPointExtension(t *testing.T) {
+	g, err := ParseString(trackPointExtensionGpx)
+	assertNil(t, err)
+
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, points[0].Temperature.Value(), 21.5)
+	assertEquals(t, points[0].HeartRate.Value(), 120)
+	assertEquals(t, points[0].Cadence.Value(), 80)
+	assertEquals(t, points[0].Speed.Value(), 3.2)
+	assertEquals(t, points[0].Course.Value(), 90.0)
+	assertTrue(t, "no water temperature", points[0].WaterTemperature.Null())
+	assertTrue(t, "no depth", points[0].Depth.Null())
+
+	// Unknown and invalid elements stay in the extension tree:
+	assertEquals(t, points[0].Extensions.GetNode(GarminTrackPointExtensionV2, "TrackPointExtension").GetNode("", "bearing").Data, "45")
+	assertEquals(t, points[1].HeartRate.Value(), 140)
+	assertTrue(t, "invalid cadence", points[1].Cadence.Null())
+	assertEquals(t, points[1].Extensions.GetNode("", "TrackPointExtension").GetNode("", "cad").Data, "aaa")
+	assertTrue(t, "no extensions", points[2].Extensions.Empty())
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	output := string(xmlBytes)
+	assertTrue(t, "fields in schema order", strings.Contains(output, "<gpxtpx:TrackPointExtension><gpxtpx:atemp>21.5</gpxtpx:atemp><gpxtpx:hr>120</gpxtpx:hr><gpxtpx:cad>80</gpxtpx:cad><gpxtpx:speed>3.2</gpxtpx:speed><gpxtpx:course>90</gpxtpx:course><gpxtpx:bearing>45</gpxtpx:bearing></gpxtpx:TrackPointExtension>"))
+
+	reparsed, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, reparsed.Tracks[0].Segments[0].Points[0].Speed.Value(), 3.2)
+	assertEquals(t, reparsed.Tracks[0].Segments[0].Points[1].HeartRate.Value(), 140)
+}
+
+func TestTrackPointExtensionNamespace(t *testing.T) {
+	g := new(GPX)
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 1}, HeartRate: *NewNullableInt(100)})
+	xmlBytes, _ := g.ToXml(ToXmlParams{Version: "1.1"})
+	output := string(xmlBytes)
+	assertTrue(t, "v1 is enough for heart rate", strings.Contains(output, `xmlns:gpxtpx="`+GarminTrackPointExtensionV1+`"`))
+	assertTrue(t, "heart rate", strings.Contains(output, "<extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>100</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>"))
+
+	g.Tracks[0].Segments[0].Points[0].Speed.SetValue(2)
+	xmlBytes, _ = g.ToXml(ToXmlParams{Version: "1.1"})
+	output = string(xmlBytes)
+	assertTrue(t, "speed requires v2", strings.Contains(output, `xmlns:gpxtpx="`+GarminTrackPointExtensionV2+`"`))
+	assertTrue(t, "no v1", !strings.Contains(output, GarminTrackPointExtensionV1))
+
+	// Parsed v2 values stay in v2 even without speed and course:
+	g, err := ParseString(`<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="` + GarminTrackPointExtensionV2 + `" version="1.1"><trk><trkseg><trkpt lat="1" lon="1"><extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>100</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt></trkseg></trk></gpx>`)
+	assertNil(t, err)
+	assertTrue(t, "parsed", g.Tracks[0].Segments[0].Points[0].Extensions.Empty())
+	xmlBytes, _ = g.ToXml(ToXmlParams{Version: "1.1"})
+	output = string(xmlBytes)
+	assertTrue(t, "v2 kept", strings.Contains(output, `xmlns:gpxtpx="`+GarminTrackPointExtensionV2+`"`))
+	assertTrue(t, "no v1", !strings.Contains(output, GarminTrackPointExtensionV1))
+}
+
+func TestSensorData(t *testing.T) {
+	g, err := ParseString(trackPointExtensionGpx)
+	assertNil(t, err)
+
+	sd := g.Tracks[0].Segments[0].SensorData()
+	assertEquals(t, sd.AvgHeartRate.Value(), 130.0)
+	assertEquals(t, sd.MaxHeartRate.Value(), 140)
+	assertEquals(t, sd.AvgCadence.Value(), 80.0)
+	assertTrue(t, "track", g.Tracks[0].SensorData().Equals(sd))
+	assertTrue(t, "gpx", g.SensorData().Equals(sd))
+
+	empty := new(GPX).SensorData()
+	assertTrue(t, "no heart rate", empty.AvgHeartRate.Null())
+	assertTrue(t, "no max heart rate", empty.MaxHeartRate.Null())
+	assertTrue(t, "no cadence", empty.AvgCadence.Null())
+}
+
+const gpxxGpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" version="1.1" creator="test">
+	<wpt lat="46.1" lon="14.1">
+		<name>Shop</name>
+		<extensions>
+			<gpxx:WaypointExtension>
+				<gpxx:Proximity>25.5</gpxx:Proximity>
+				<gpxx:DisplayMode>SymbolAndName</gpxx:DisplayMode>
+				<gpxx:Categories>
+					<gpxx:Category>Shopping</gpxx:Category>
+					<gpxx:Category>Food</gpxx:Category>
+				</gpxx:Categories>
+				<gpxx:Address>
+					<gpxx:StreetAddress>Main street 1</gpxx:StreetAddress>
+					<gpxx:City>Ljubljana</gpxx:City>
+					<gpxx:Country>Slovenia</gpxx:Country>
+					<gpxx:PostalCode>1000</gpxx:PostalCode>
+				</gpxx:Address>
+				<gpxx:PhoneNumber Category="Work">+386 1 234</gpxx:PhoneNumber>
+			</gpxx:WaypointExtension>
+		</extensions>
+	</wpt>
+	<rte>
+		<name>route</name>
+		<extensions>
+			<gpxx:RouteExtension>
+				<gpxx:IsAutoNamed>false</gpxx:IsAutoNamed>
+				<gpxx:DisplayColor>Magenta</gpxx:DisplayColor>
+			</gpxx:RouteExtension>
+		</extensions>
+		<rtept lat="46" lon="14">
+			<extensions>
+				<gpxx:RoutePointExtension>
+					<gpxx:Subclass>000000000000FFFFFFFFFFFFFFFFFFFFFFFF</gpxx:Subclass>
+					<gpxx:rpt lat="46.01" lon="14.01"/>
+					<gpxx:rpt lat="46.015" lon="14.015">
+						<gpxx:Subclass>0000A0F5000040D70100000000000000</gpxx:Subclass>
+					</gpxx:rpt>
+					<gpxx:rpt lat="46.02" lon="14.02"/>
+				</gpxx:RoutePointExtension>
+			</extensions>
+		</rtept>
+		<rtept lat="46.03" lon="14.03"></rtept>
+	</rte>
+</gpx>`
+
+func TestGpxxExtensions(t *testing.T) {
+	g, err := ParseString(gpxxGpx)
+	assertNil(t, err)
+
+	wpt := g.Waypoints[0]
+	assertEquals(t, wpt.Proximity.Value(), 25.5)
+	assertEquals(t, strings.Join(wpt.Categories, ","), "Shopping,Food")
+	assertEquals(t, len(wpt.Address.StreetAddress), 1)
+	assertEquals(t, wpt.Address.StreetAddress[0], "Main street 1")
+	assertEquals(t, wpt.Address.City, "Ljubljana")
+	assertEquals(t, wpt.Address.State, "")
+	assertEquals(t, wpt.Address.Country, "Slovenia")
+	assertEquals(t, wpt.Address.PostalCode, "1000")
+	assertEquals(t, len(wpt.PhoneNumbers), 1)
+	assertEquals(t, wpt.PhoneNumbers[0], GPXPhoneNumber{Number: "+386 1 234", Category: "Work"})
+	assertEquals(t, wpt.Extensions.GetNode(GarminGpxExtensionsV3, "WaypointExtension").GetNode("", "DisplayMode").Data, "SymbolAndName")
+
+	rte := g.Routes[0]
+	assertEquals(t, rte.DisplayColor, "Magenta")
+	assertEquals(t, rte.Extensions.GetNode("", "RouteExtension").GetNode("", "IsAutoNamed").Data, "false")
+	assertEquals(t, len(rte.Points[0].ShapingPoints), 3)
+	assertEquals(t, rte.Points[0].ShapingPoints[1].Latitude, 46.015)
+	assertEquals(t, rte.Points[0].ShapingPoints[1].Subclass, "0000A0F5000040D70100000000000000")
+	assertEquals(t, rte.Points[0].ShapingPoints[2].Latitude, 46.02)
+	assertEquals(t, rte.Points[0].ShapingPoints[2].Subclass, "")
+	path := rte.PathPoints()
+	assertEquals(t, len(path), 5)
+	assertEquals(t, path[1].Longitude, 14.01)
+	assertEquals(t, path[4].Latitude, 46.03)
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	output := string(xmlBytes)
+	assertTrue(t, "waypoint extension in schema order", strings.Contains(output, `<gpxx:WaypointExtension><gpxx:Proximity>25.5</gpxx:Proximity><gpxx:DisplayMode>SymbolAndName</gpxx:DisplayMode><gpxx:Categories><gpxx:Category>Shopping</gpxx:Category><gpxx:Category>Food</gpxx:Category></gpxx:Categories><gpxx:Address><gpxx:StreetAddress>Main street 1</gpxx:StreetAddress><gpxx:City>Ljubljana</gpxx:City><gpxx:Country>Slovenia</gpxx:Country><gpxx:PostalCode>1000</gpxx:PostalCode></gpxx:Address><gpxx:PhoneNumber Category="Work">+386 1 234</gpxx:PhoneNumber></gpxx:WaypointExtension>`))
+	assertTrue(t, "route extension", strings.Contains(output, `<gpxx:RouteExtension><gpxx:IsAutoNamed>false</gpxx:IsAutoNamed><gpxx:DisplayColor>Magenta</gpxx:DisplayColor></gpxx:RouteExtension>`))
+	assertTrue(t, "shaping points", strings.Contains(output, `<gpxx:RoutePointExtension><gpxx:Subclass>000000000000FFFFFFFFFFFFFFFFFFFFFFFF</gpxx:Subclass><gpxx:rpt lat="46.01" lon="14.01"></gpxx:rpt><gpxx:rpt lat="46.015" lon="14.015"><gpxx:Subclass>0000A0F5000040D70100000000000000</gpxx:Subclass></gpxx:rpt><gpxx:rpt lat="46.02" lon="14.02"></gpxx:rpt></gpxx:RoutePointExtension>`))
+
+	reparsed, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, reparsed.Waypoints[0].Address.City, "Ljubljana")
+	assertEquals(t, len(reparsed.Routes[0].PathPoints()), 5)
+	assertEquals(t, reparsed.Routes[0].Points[0].ShapingPoints[1].Subclass, "0000A0F5000040D70100000000000000")
+}
+
+func TestGpxxShapingPointsNotSplit(t *testing.T) {
+	// The second shaping point has an unknown element, so all of them stay in the tree
+	g, err := ParseString(`<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" version="1.1"><rte><rtept lat="46" lon="14"><extensions><gpxx:RoutePointExtension>` +
+		`<gpxx:rpt lat="46.01" lon="14.01"/><gpxx:rpt lat="46.02" lon="14.02"><gpxx:Other>x</gpxx:Other></gpxx:rpt><gpxx:rpt lat="46.03" lon="14.03"/>` +
+		`</gpxx:RoutePointExtension></extensions></rtept></rte></gpx>`)
+	assertNil(t, err)
+	pt := g.Routes[0].Points[0]
+	assertEquals(t, len(pt.ShapingPoints), 0)
+	assertEquals(t, len(pt.Extensions.GetNode(GarminGpxExtensionsV3, "RoutePointExtension").Nodes), 3)
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	assertTrue(t, "order kept", strings.Contains(string(xmlBytes), `<gpxx:rpt lat="46.01" lon="14.01"></gpxx:rpt><gpxx:rpt lat="46.02" lon="14.02"><gpxx:Other>x</gpxx:Other></gpxx:rpt><gpxx:rpt lat="46.03" lon="14.03"></gpxx:rpt>`))
+}
+
+func TestDisplayColorWithoutNamespace(t *testing.T) {
+	g := new(GPX)
+	g.AppendTrack(&GPXTrack{Name: "t", DisplayColor: "Red"})
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	output := string(xmlBytes)
+	assertTrue(t, "namespace", strings.Contains(output, `xmlns:gpxx="`+GarminGpxExtensionsV3+`"`))
+	assertTrue(t, "color", strings.Contains(output, `<trk><name>t</name><extensions><gpxx:TrackExtension><gpxx:DisplayColor>Red</gpxx:DisplayColor></gpxx:TrackExtension></extensions></trk>`))
+
+	xmlBytes, _ = g.ToXml(ToXmlParams{Version: "1.0"})
+	assertTrue(t, "no color in 1.0", !strings.Contains(string(xmlBytes), "Red"))
+}
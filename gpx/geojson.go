@@ -0,0 +1,407 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GeoJSONOptions contains settings for GPX.ToGeoJSON
+type GeoJSONOptions struct {
+	// Precision is the number of decimals of the coordinates, all needed
+	// decimals are written if zero
+	Precision int
+	// Elevations adds the elevations as properties, "ele" for waypoints and
+	// "coordElevations" (an array with an element per coordinate, null for
+	// points without elevation) for routes and tracks
+	Elevations bool
+	// Times adds the times as properties, "time" for waypoints and
+	// "coordTimes" for routes and tracks
+	Times bool
+	// Indent writes indented JSON
+	Indent bool
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ToGeoJSON converts the GPX to a GeoJSON FeatureCollection. Waypoints are
+// Point features, routes LineString features and tracks MultiLineString
+// features (with a line for each segment). The name, desc, cmt and type
+// properties are written if not empty.
+func (g *GPX) ToGeoJSON(opts GeoJSONOptions) ([]byte, error) {
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for waypointNo := range g.Waypoints {
+		waypoint := &g.Waypoints[waypointNo]
+		properties := geoJSONProperties(waypoint.Name, waypoint.Description, waypoint.Comment, waypoint.Type)
+		if len(waypoint.Symbol) > 0 {
+			properties["sym"] = waypoint.Symbol
+		}
+		if opts.Elevations && waypoint.Elevation.NotNull() {
+			properties["ele"] = waypoint.Elevation.Value()
+		}
+		if opts.Times && !waypoint.Timestamp.IsZero() {
+			properties["time"] = formatGPXTime(&waypoint.Timestamp, ToXmlParams{})
+		}
+		feature, err := newGeoJSONFeature("Point", opts.position(&waypoint.Point), properties)
+		if err != nil {
+			return nil, err
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+
+	for routeNo := range g.Routes {
+		route := &g.Routes[routeNo]
+		properties := geoJSONProperties(route.Name, route.Description, route.Comment, route.Type)
+		elevations, times := geoJSONPointValues(route.Points)
+		opts.addPointProperties(properties, elevations, times)
+		feature, err := newGeoJSONFeature("LineString", opts.line(route.Points), properties)
+		if err != nil {
+			return nil, err
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		properties := geoJSONProperties(track.Name, track.Description, track.Comment, track.Type)
+		lines := make([][][]json.Number, len(track.Segments))
+		for segmentNo, segment := range track.Segments {
+			lines[segmentNo] = opts.line(segment.Points)
+		}
+		elevations := make([][]interface{}, len(track.Segments))
+		times := make([][]interface{}, len(track.Segments))
+		for segmentNo, segment := range track.Segments {
+			elevations[segmentNo], times[segmentNo] = geoJSONPointValues(segment.Points)
+		}
+		opts.addPointProperties(properties, elevations, times)
+		feature, err := newGeoJSONFeature("MultiLineString", lines, properties)
+		if err != nil {
+			return nil, err
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+
+	if opts.Indent {
+		return json.MarshalIndent(collection, "", "	")
+	}
+	return json.Marshal(collection)
+}
+
+func newGeoJSONFeature(geometryType string, coordinates interface{}, properties map[string]interface{}) (geoJSONFeature, error) {
+	bytes, err := json.Marshal(coordinates)
+	if err != nil {
+		return geoJSONFeature{}, err
+	}
+	return geoJSONFeature{
+		Type:       "Feature",
+		Geometry:   &geoJSONGeometry{Type: geometryType, Coordinates: bytes},
+		Properties: properties,
+	}, nil
+}
+
+func geoJSONProperties(name, description, comment, typ string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, property := range [][2]string{{"name", name}, {"desc", description}, {"cmt", comment}, {"type", typ}} {
+		if len(property[1]) > 0 {
+			result[property[0]] = property[1]
+		}
+	}
+	return result
+}
+
+// addPointProperties adds the coordElevations and coordTimes properties of
+// a route or track, if enabled
+func (opts GeoJSONOptions) addPointProperties(properties map[string]interface{}, elevations, times interface{}) {
+	if opts.Elevations {
+		properties["coordElevations"] = elevations
+	}
+	if opts.Times {
+		properties["coordTimes"] = times
+	}
+}
+
+// geoJSONPointValues returns the elevations and times of points, nil for
+// missing values
+func geoJSONPointValues(points []GPXPoint) ([]interface{}, []interface{}) {
+	elevations := make([]interface{}, len(points))
+	times := make([]interface{}, len(points))
+	for pointNo := range points {
+		point := &points[pointNo]
+		if point.Elevation.NotNull() {
+			elevations[pointNo] = point.Elevation.Value()
+		}
+		if !point.Timestamp.IsZero() {
+			times[pointNo] = formatGPXTime(&point.Timestamp, ToXmlParams{})
+		}
+	}
+	return elevations, times
+}
+
+func (opts GeoJSONOptions) line(points []GPXPoint) [][]json.Number {
+	result := make([][]json.Number, len(points))
+	for pointNo := range points {
+		result[pointNo] = opts.position(&points[pointNo].Point)
+	}
+	return result
+}
+
+// position returns the GeoJSON position (longitude first)
+func (opts GeoJSONOptions) position(point *Point) []json.Number {
+	return []json.Number{opts.coordinate(point.Longitude), opts.coordinate(point.Latitude)}
+}
+
+func (opts GeoJSONOptions) coordinate(value float64) json.Number {
+	if opts.Precision <= 0 {
+		return json.Number(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	formatted := strconv.FormatFloat(value, 'f', opts.Precision, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "-0" {
+		return "0"
+	}
+	return json.Number(formatted)
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// GeoJSONImportOptions contains settings for FromGeoJSONWithOptions
+type GeoJSONImportOptions struct {
+	// LineStringsAsTracks converts LineString features to single segment
+	// tracks instead of routes
+	LineStringsAsTracks bool
+}
+
+type geoJSONObject struct {
+	Type        string                     `json:"type"`
+	Features    []geoJSONObject            `json:"features"`
+	Geometry    *geoJSONObject             `json:"geometry"`
+	Geometries  []geoJSONObject            `json:"geometries"`
+	Properties  map[string]json.RawMessage `json:"properties"`
+	Coordinates json.RawMessage            `json:"coordinates"`
+}
+
+// FromGeoJSON converts a GeoJSON FeatureCollection, Feature or geometry to
+// GPX, see FromGeoJSONWithOptions
+func FromGeoJSON(data []byte) (*GPX, error) {
+	return FromGeoJSONWithOptions(data, GeoJSONImportOptions{})
+}
+
+// FromGeoJSONWithOptions converts a GeoJSON FeatureCollection, Feature or
+// geometry to GPX. Point and MultiPoint features are converted to waypoints,
+// LineString features to routes (or tracks, see
+// GeoJSONImportOptions.LineStringsAsTracks) and MultiLineString features to
+// tracks with a segment for each line. Other geometries are ignored.
+//
+// The name, desc (or description), cmt and type properties are used for
+// waypoints, routes and tracks. Elevations are read from the third value of
+// the coordinates or from the ele and coordElevations properties, times from
+// the time and coordTimes properties (as written by GPX.ToGeoJSON).
+func FromGeoJSONWithOptions(data []byte, opts GeoJSONImportOptions) (*GPX, error) {
+	var object geoJSONObject
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	g := &GPX{Version: "1.1"}
+	switch object.Type {
+	case "FeatureCollection":
+		for _, feature := range object.Features {
+			if err := g.addGeoJSONFeature(&feature, opts); err != nil {
+				return nil, err
+			}
+		}
+	case "Feature":
+		if err := g.addGeoJSONFeature(&object, opts); err != nil {
+			return nil, err
+		}
+	default:
+		if err := g.addGeoJSONGeometry(&object, geoJSONPropertyValues{}, opts); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *GPX) addGeoJSONFeature(feature *geoJSONObject, opts GeoJSONImportOptions) error {
+	if feature.Type != "Feature" {
+		return fmt.Errorf("invalid GeoJSON feature type %q", feature.Type)
+	}
+	if feature.Geometry == nil {
+		return nil
+	}
+	return g.addGeoJSONGeometry(feature.Geometry, geoJSONPropertyValues(feature.Properties), opts)
+}
+
+func (g *GPX) addGeoJSONGeometry(geometry *geoJSONObject, properties geoJSONPropertyValues, opts GeoJSONImportOptions) error {
+	switch geometry.Type {
+	case "Point":
+		var position []float64
+		if err := json.Unmarshal(geometry.Coordinates, &position); err != nil {
+			return fmt.Errorf("invalid GeoJSON Point: %s", err.Error())
+		}
+		point, err := geoJSONPoint(position)
+		if err != nil {
+			return err
+		}
+		properties.setPoint(&point)
+		point.Name, point.Description, point.Comment, point.Type = properties.description()
+		point.Symbol = properties.string("sym")
+		g.AppendWaypoint(&point)
+	case "MultiPoint":
+		points, err := geoJSONLine(geometry.Coordinates, properties.raw("coordElevations"), properties.raw("coordTimes"))
+		if err != nil {
+			return err
+		}
+		for pointNo := range points {
+			points[pointNo].Name, points[pointNo].Description, points[pointNo].Comment, points[pointNo].Type = properties.description()
+			g.AppendWaypoint(&points[pointNo])
+		}
+	case "LineString":
+		points, err := geoJSONLine(geometry.Coordinates, properties.raw("coordElevations"), properties.raw("coordTimes"))
+		if err != nil {
+			return err
+		}
+		if opts.LineStringsAsTracks {
+			track := GPXTrack{Segments: []GPXTrackSegment{{Points: points}}}
+			track.Name, track.Description, track.Comment, track.Type = properties.description()
+			g.AppendTrack(&track)
+		} else {
+			route := GPXRoute{Points: points}
+			route.Name, route.Description, route.Comment, route.Type = properties.description()
+			g.AppendRoute(&route)
+		}
+	case "MultiLineString":
+		var lines []json.RawMessage
+		if err := json.Unmarshal(geometry.Coordinates, &lines); err != nil {
+			return fmt.Errorf("invalid GeoJSON MultiLineString: %s", err.Error())
+		}
+		var elevations, times []json.RawMessage
+		json.Unmarshal(properties.raw("coordElevations"), &elevations)
+		json.Unmarshal(properties.raw("coordTimes"), &times)
+		track := GPXTrack{}
+		track.Name, track.Description, track.Comment, track.Type = properties.description()
+		for lineNo, line := range lines {
+			points, err := geoJSONLine(line, geoJSONRawItem(elevations, lineNo), geoJSONRawItem(times, lineNo))
+			if err != nil {
+				return err
+			}
+			track.Segments = append(track.Segments, GPXTrackSegment{Points: points})
+		}
+		g.AppendTrack(&track)
+	case "GeometryCollection":
+		for _, child := range geometry.Geometries {
+			if err := g.addGeoJSONGeometry(&child, properties, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func geoJSONRawItem(items []json.RawMessage, index int) json.RawMessage {
+	if index < len(items) {
+		return items[index]
+	}
+	return nil
+}
+
+// geoJSONPoint converts a GeoJSON position (longitude, latitude and
+// optionally elevation)
+func geoJSONPoint(position []float64) (GPXPoint, error) {
+	if len(position) < 2 {
+		return GPXPoint{}, fmt.Errorf("invalid GeoJSON position %v", position)
+	}
+	point := GPXPoint{Point: Point{Latitude: position[1], Longitude: position[0]}}
+	if len(position) > 2 {
+		point.Elevation.SetValue(position[2])
+	}
+	return point, nil
+}
+
+// geoJSONLine converts an array of positions, rawElevations and rawTimes are
+// the optional arrays of the values for each point
+func geoJSONLine(coordinates, rawElevations, rawTimes json.RawMessage) ([]GPXPoint, error) {
+	var positions [][]float64
+	if err := json.Unmarshal(coordinates, &positions); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON line: %s", err.Error())
+	}
+	var elevations []*float64
+	var times []*string
+	json.Unmarshal(rawElevations, &elevations)
+	json.Unmarshal(rawTimes, &times)
+
+	points := make([]GPXPoint, len(positions))
+	for positionNo, position := range positions {
+		point, err := geoJSONPoint(position)
+		if err != nil {
+			return nil, err
+		}
+		if positionNo < len(elevations) && elevations[positionNo] != nil {
+			point.Elevation.SetValue(*elevations[positionNo])
+		}
+		if positionNo < len(times) && times[positionNo] != nil {
+			if t, err := parseGPXTime(*times[positionNo], nil); err == nil {
+				point.Timestamp = *t
+			}
+		}
+		points[positionNo] = point
+	}
+	return points, nil
+}
+
+// geoJSONPropertyValues are the properties of a feature, values of
+// unexpected types are ignored
+type geoJSONPropertyValues map[string]json.RawMessage
+
+func (p geoJSONPropertyValues) raw(name string) json.RawMessage {
+	return p[name]
+}
+
+func (p geoJSONPropertyValues) string(name string) string {
+	var result string
+	json.Unmarshal(p[name], &result)
+	return result
+}
+
+// description returns the name, description, comment and type
+func (p geoJSONPropertyValues) description() (string, string, string, string) {
+	description := p.string("desc")
+	if len(description) == 0 {
+		description = p.string("description")
+	}
+	return p.string("name"), description, p.string("cmt"), p.string("type")
+}
+
+// setPoint sets the ele and time properties of a waypoint
+func (p geoJSONPropertyValues) setPoint(point *GPXPoint) {
+	var elevation *float64
+	if json.Unmarshal(p["ele"], &elevation); elevation != nil {
+		point.Elevation.SetValue(*elevation)
+	}
+	if timeStr := p.string("time"); len(timeStr) > 0 {
+		if t, err := parseGPXTime(timeStr, nil); err == nil {
+			point.Timestamp = *t
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func geoJSONTestGPX() *GPX {
+	g := new(GPX)
+	waypoint := GPXPoint{Point: Point{Latitude: 46.123456789, Longitude: 13.5}, Name: "wpt", Symbol: "Flag", Timestamp: time.Date(2014, 1, 1, 12, 0, 0, 0, time.UTC)}
+	waypoint.Elevation.SetValue(1000)
+	g.AppendWaypoint(&waypoint)
+	g.AppendRoute(&GPXRoute{Name: "route", Description: "route desc", Points: []GPXPoint{
+		{Point: Point{Latitude: 46, Longitude: 13}},
+		{Point: Point{Latitude: 46.5, Longitude: -13.25}},
+	}})
+	g.AppendTrack(&GPXTrack{Name: "track", Type: "hiking"})
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 2, Elevation: *NewNullableFloat64(10)}, Timestamp: time.Date(2014, 1, 1, 12, 0, 0, 500000000, time.UTC)})
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 3, Longitude: 4}})
+	g.Tracks[0].AppendSegment(new(GPXTrackSegment))
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: -5, Longitude: 6}})
+	return g
+}
+
+func TestToGeoJSON(t *testing.T) {
+	bytes, err := geoJSONTestGPX().ToGeoJSON(GeoJSONOptions{Precision: 5})
+	assertNil(t, err)
+	assertEquals(t, string(bytes), `{"type":"FeatureCollection","features":[`+
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[13.5,46.12346]},"properties":{"name":"wpt","sym":"Flag"}},`+
+		`{"type":"Feature","geometry":{"type":"LineString","coordinates":[[13,46],[-13.25,46.5]]},"properties":{"desc":"route desc","name":"route"}},`+
+		`{"type":"Feature","geometry":{"type":"MultiLineString","coordinates":[[[2,1],[4,3]],[[6,-5]]]},"properties":{"name":"track","type":"hiking"}}]}`)
+
+	bytes, err = geoJSONTestGPX().ToGeoJSON(GeoJSONOptions{Elevations: true, Times: true})
+	assertNil(t, err)
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates json.RawMessage
+			}
+			Properties map[string]interface{}
+		}
+	}
+	assertNil(t, json.Unmarshal(bytes, &collection))
+	assertEquals(t, len(collection.Features), 3)
+	assertEquals(t, string(collection.Features[0].Geometry.Coordinates), "[13.5,46.123456789]")
+	assertEquals(t, collection.Features[0].Properties["ele"], 1000.0)
+	assertEquals(t, collection.Features[0].Properties["time"], "2014-01-01T12:00:00Z")
+	routeTimes, _ := json.Marshal(collection.Features[1].Properties["coordTimes"])
+	assertEquals(t, string(routeTimes), "[null,null]")
+	trackElevations, _ := json.Marshal(collection.Features[2].Properties["coordElevations"])
+	assertEquals(t, string(trackElevations), "[[10,null],[null]]")
+	trackTimes, _ := json.Marshal(collection.Features[2].Properties["coordTimes"])
+	assertEquals(t, string(trackTimes), `[["2014-01-01T12:00:00.5Z",null],[null]]`)
+}
+
+func TestToGeoJSONEmpty(t *testing.T) {
+	bytes, err := new(GPX).ToGeoJSON(GeoJSONOptions{})
+	assertNil(t, err)
+	assertEquals(t, string(bytes), `{"type":"FeatureCollection","features":[]}`)
+}
+
+func TestFromGeoJSONRoundTrip(t *testing.T) {
+	bytes, err := geoJSONTestGPX().ToGeoJSON(GeoJSONOptions{Elevations: true, Times: true})
+	assertNil(t, err)
+	g, err := FromGeoJSON(bytes)
+	assertNil(t, err)
+
+	assertEquals(t, len(g.Waypoints), 1)
+	assertEquals(t, g.Waypoints[0].Name, "wpt")
+	assertEquals(t, g.Waypoints[0].Symbol, "Flag")
+	assertEquals(t, g.Waypoints[0].Latitude, 46.123456789)
+	assertEquals(t, g.Waypoints[0].Elevation.Value(), 1000.0)
+	assertTrue(t, "waypoint time", g.Waypoints[0].Timestamp.Equal(time.Date(2014, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	assertEquals(t, len(g.Routes), 1)
+	assertEquals(t, g.Routes[0].Name, "route")
+	assertEquals(t, g.Routes[0].Description, "route desc")
+	assertEquals(t, len(g.Routes[0].Points), 2)
+	assertEquals(t, g.Routes[0].Points[1].Longitude, -13.25)
+	assertTrue(t, "route point without time", g.Routes[0].Points[1].Timestamp.IsZero())
+
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, g.Tracks[0].Type, "hiking")
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 2)
+	assertEquals(t, len(g.Tracks[0].Segments[1].Points), 1)
+	point := g.Tracks[0].Segments[0].Points[0]
+	assertEquals(t, point.Elevation.Value(), 10.0)
+	assertTrue(t, "track point time", point.Timestamp.Equal(time.Date(2014, 1, 1, 12, 0, 0, 500000000, time.UTC)))
+	assertTrue(t, "track point without elevation", g.Tracks[0].Segments[0].Points[1].Elevation.Null())
+}
+
+func TestFromGeoJSONLineStrings(t *testing.T) {
+	feature := `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[13,46,100],[14,47]]},` +
+		`"properties":{"name":"planned","description":"drawn in an editor","coordTimes":["2014-01-01T12:00:00Z","invalid"]}}`
+
+	g, err := FromGeoJSON([]byte(feature))
+	assertNil(t, err)
+	assertEquals(t, len(g.Routes), 1)
+	assertEquals(t, len(g.Tracks), 0)
+	assertEquals(t, g.Routes[0].Name, "planned")
+	assertEquals(t, g.Routes[0].Description, "drawn in an editor")
+	assertEquals(t, g.Routes[0].Points[0].Elevation.Value(), 100.0)
+	assertTrue(t, "no elevation", g.Routes[0].Points[1].Elevation.Null())
+	assertTrue(t, "time", g.Routes[0].Points[0].Timestamp.Equal(time.Date(2014, 1, 1, 12, 0, 0, 0, time.UTC)))
+	assertTrue(t, "invalid time", g.Routes[0].Points[1].Timestamp.IsZero())
+
+	g, err = FromGeoJSONWithOptions([]byte(feature), GeoJSONImportOptions{LineStringsAsTracks: true})
+	assertNil(t, err)
+	assertEquals(t, len(g.Routes), 0)
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, g.Tracks[0].Name, "planned")
+	assertEquals(t, len(g.Tracks[0].Segments), 1)
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 2)
+	assertEquals(t, g.Tracks[0].Segments[0].Points[1].Latitude, 47.0)
+}
+
+func TestFromGeoJSONGeometries(t *testing.T) {
+	g, err := FromGeoJSON([]byte(`{"type":"GeometryCollection","geometries":[` +
+		`{"type":"Point","coordinates":[1,2]},{"type":"MultiPoint","coordinates":[[3,4],[5,6]]},{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}]}`))
+	assertNil(t, err)
+	assertEquals(t, len(g.Waypoints), 3)
+	assertEquals(t, g.Waypoints[2].Latitude, 6.0)
+	assertEquals(t, len(g.Routes)+len(g.Tracks), 0)
+
+	g, err = FromGeoJSON([]byte(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":null,"properties":{}}]}`))
+	assertNil(t, err)
+	assertEquals(t, len(g.Waypoints), 0)
+
+	_, err = FromGeoJSON([]byte(`{"type":"Point","coordinates":[1]}`))
+	assertTrue(t, "invalid position", err != nil)
+	_, err = FromGeoJSON([]byte(`{"type":"LineString","coordinates":"x"}`))
+	assertTrue(t, "invalid coordinates", err != nil)
+	_, err = FromGeoJSON([]byte(`not json`))
+	assertTrue(t, "invalid json", err != nil)
+}
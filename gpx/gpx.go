@@ -6,8 +6,10 @@
 package gpx
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 )
 
@@ -65,29 +67,25 @@ type GPX struct {
 	XmlNsXsi     string
 	XmlSchemaLoc string
 
-	Version          string
-	Creator          string
-	Name             string
-	Description      string
-	AuthorName       string
-	AuthorEmail      string
-	AuthorLink       string
-	AuthorLinkText   string
-	AuthorLinkType   string
-	Copyright        string
-	CopyrightYear    string
-	CopyrightLicense string
-	Link             string
-	LinkText         string
-	LinkType         string
-	Time             *time.Time
-	Keywords         string
+	Version string
+	Creator string
+
+	// Metadata fields are promoted (g.Name, g.Author, g.DeclaredBounds...)
+	Metadata
+
+	// Namespaces contains the extension namespaces declared in the root
+	// element (prefix -> URL), used to keep the same prefixes when writing
+	Namespaces map[string]string
+	// Extensions are the root element extensions (GPX 1.1 only)
+	Extensions Extension
 
-	// TODO
-	//Extensions []byte
 	Waypoints []GPXPoint
 	Routes    []GPXRoute
 	Tracks    []GPXTrack
+
+	// ParseErrors are the errors of the elements skipped when parsing with
+	// ParseOptions.Lenient
+	ParseErrors []*ParseError
 }
 
 // ToXml converts the object to xml.
@@ -102,8 +100,8 @@ func (g *GPX) GetGpxInfo() string {
 	result += fmt.Sprint("GPX name: ", g.Name, "\n")
 	result += fmt.Sprint("GPX desctiption: ", g.Description, "\n")
 	result += fmt.Sprint("GPX version: ", g.Version, "\n")
-	result += fmt.Sprint("Author: ", g.AuthorName, "\n")
-	result += fmt.Sprint("Email: ", g.AuthorEmail, "\n\n")
+	result += fmt.Sprint("Author: ", g.Author.getName(), "\n")
+	result += fmt.Sprint("Email: ", g.Author.getEmail(), "\n\n")
 
 	result += fmt.Sprint("\nGlobal stats:", "\n")
 	result += GetGpxElementInfo("", g)
@@ -217,6 +215,15 @@ func (g *GPX) MovingData() MovingData {
 	}
 }
 
+// SensorData returns heart rate and cadence statistics for all tracks in a Gpx.
+func (g *GPX) SensorData() SensorData {
+	var segments []GPXTrackSegment
+	for _, trk := range g.Tracks {
+		segments = append(segments, trk.Segments...)
+	}
+	return calcSensorData(segments)
+}
+
 //ReduceTrackPoints reduces the number of track points of all tracks
 func (g *GPX) ReduceTrackPoints(maxPointsNo int, minDistanceBetween float64) {
 	pointsNo := g.GetTrackPointsNo()
@@ -710,6 +717,204 @@ func (ud UphillDownhill) Equals(ud2 UphillDownhill) bool {
 
 // ----------------------------------------------------------------------------------------------------
 
+//SensorData contains heart rate and cadence statistics, values are null if
+//no point has them
+type SensorData struct {
+	AvgHeartRate NullableFloat64
+	MaxHeartRate NullableInt
+	AvgCadence   NullableFloat64
+}
+
+//Equals compares to another SensorData struct
+func (sd SensorData) Equals(sd2 SensorData) bool {
+	return sd.AvgHeartRate == sd2.AvgHeartRate && sd.MaxHeartRate == sd2.MaxHeartRate && sd.AvgCadence == sd2.AvgCadence
+}
+
+func calcSensorData(segments []GPXTrackSegment) SensorData {
+	var (
+		heartRateSum float64
+		heartRateNo  int
+		cadenceSum   float64
+		cadenceNo    int
+		result       SensorData
+	)
+	for _, seg := range segments {
+		for _, pt := range seg.Points {
+			if pt.HeartRate.NotNull() {
+				heartRateSum += float64(pt.HeartRate.Value())
+				heartRateNo++
+				if result.MaxHeartRate.Null() || pt.HeartRate.Value() > result.MaxHeartRate.Value() {
+					result.MaxHeartRate.SetValue(pt.HeartRate.Value())
+				}
+			}
+			if pt.Cadence.NotNull() {
+				cadenceSum += float64(pt.Cadence.Value())
+				cadenceNo++
+			}
+		}
+	}
+	if heartRateNo > 0 {
+		result.AvgHeartRate.SetValue(heartRateSum / float64(heartRateNo))
+	}
+	if cadenceNo > 0 {
+		result.AvgCadence.SetValue(cadenceSum / float64(cadenceNo))
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+//GPXLink is a link to an external resource, Text and Type are optional
+type GPXLink struct {
+	Href string
+	Text string
+	Type string
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// Metadata contains the information about the GPX document, in GPX 1.1 it
+// is the metadata element, in GPX 1.0 the elements before the waypoints
+type Metadata struct {
+	Name        string
+	Description string
+	Author      *Person
+	Copyright   *Copyright
+	// Links of the document, Link(), LinkText() and LinkType() return the
+	// first one
+	Links    []GPXLink
+	Time     *time.Time
+	Keywords string
+	// DeclaredBounds are the bounds declared in the document (nil if
+	// missing), they aren't updated when points change. See GPX.Bounds() and
+	// ToXmlParams.WriteBounds.
+	DeclaredBounds *GpxBounds
+	// MetadataExtensions are the extensions of the metadata element (GPX 1.1
+	// only), GPX.Extensions are the root element extensions
+	MetadataExtensions Extension
+}
+
+// firstLink returns the first of the links, empty if there are none
+func (m *Metadata) firstLink() GPXLink {
+	if len(m.Links) == 0 {
+		return GPXLink{}
+	}
+	return m.Links[0]
+}
+
+// Link returns the URL of the first link
+func (m *Metadata) Link() string {
+	return m.firstLink().Href
+}
+
+// LinkText returns the text of the first link
+func (m *Metadata) LinkText() string {
+	return m.firstLink().Text
+}
+
+// LinkType returns the MIME type of the first link
+func (m *Metadata) LinkType() string {
+	return m.firstLink().Type
+}
+
+// Person is a person or organization, in GPX 1.0 only Name and Email are
+// used
+type Person struct {
+	Name  string
+	Email *Email
+	Link  *GPXLink
+}
+
+func (p *Person) getName() string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
+func (p *Person) getEmail() string {
+	if p == nil || p.Email == nil {
+		return ""
+	}
+	return p.Email.String()
+}
+
+// Email is an email address split into ID and domain (as in GPX 1.1)
+type Email struct {
+	ID     string
+	Domain string
+}
+
+// ParseEmail splits an email address on the last "@", nil if address is
+// empty
+func ParseEmail(address string) *Email {
+	if len(address) == 0 {
+		return nil
+	}
+	index := strings.LastIndex(address, "@")
+	if index < 0 {
+		return &Email{ID: address}
+	}
+	return &Email{ID: address[:index], Domain: address[index+1:]}
+}
+
+// String returns the email address
+func (e Email) String() string {
+	if len(e.Domain) == 0 {
+		return e.ID
+	}
+	return e.ID + "@" + e.Domain
+}
+
+// Copyright is the copyright holder and license of a document (GPX 1.1 only)
+type Copyright struct {
+	Author string
+	// Year as written in the document (xsd:gYear, usually four digits)
+	Year    string
+	License string
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// FixType is the type of GPS fix of a point
+type FixType int
+
+const (
+	// FixUnknown is a point without a fix element
+	FixUnknown FixType = iota
+	// FixNone means that the GPS had no fix
+	FixNone
+	Fix2D
+	Fix3D
+	FixDGPS
+	// FixPPS is a military signal fix
+	FixPPS
+)
+
+var fixTypeNames = []string{"", "none", "2d", "3d", "dgps", "pps"}
+
+// String returns the GPX fix value, empty for FixUnknown
+func (f FixType) String() string {
+	if f < 0 || int(f) >= len(fixTypeNames) {
+		return ""
+	}
+	return fixTypeNames[f]
+}
+
+// ParseFixType parses a GPX fix value (none, 2d, 3d, dgps or pps), an empty
+// string is FixUnknown
+func ParseFixType(value string) (FixType, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for fixType, name := range fixTypeNames {
+		if name == value {
+			return FixType(fixType), nil
+		}
+	}
+	return FixUnknown, fmt.Errorf("invalid fix type %q", value)
+}
+
+// ----------------------------------------------------------------------------------------------------
+
 // TrackPosition implements the position of a point on the track
 type TrackPosition struct {
 	Point
@@ -725,27 +930,54 @@ type GPXPoint struct {
 	Point
 	// TODO
 	Timestamp time.Time
-	// TODO: Type
-	MagneticVariation string
-	// TODO: Type
-	GeoidHeight string
+	// Speed (m/s) and Course (degrees) recorded by the device, GPX 1.0
+	// speed/course elements or the Garmin TrackPointExtension v2 in GPX 1.1
+	Speed  NullableFloat64
+	Course NullableFloat64
+	// MagneticVariation in degrees, from 0 (inclusive) to 360 (exclusive)
+	MagneticVariation NullableFloat64
+	// GeoidHeight is the height in meters of the geoid (mean sea level)
+	// above the WGS84 ellipsoid
+	GeoidHeight NullableFloat64
 	// Description info
 	Name        string
 	Comment     string
 	Description string
 	Source      string
-	// TODO
-	// Links       []GpxLink
+	// Links are written as url/urlname in GPX 1.0, where only one link is possible
+	Links  []GPXLink
 	Symbol string
 	Type   string
 	// Accuracy info
-	TypeOfGpsFix       string
+	TypeOfGpsFix       FixType
 	Satellites         NullableInt
 	HorizontalDilution NullableFloat64
 	VerticalDilution   NullableFloat64
 	PositionalDilution NullableFloat64
 	AgeOfDGpsData      NullableFloat64
 	DGpsId             NullableInt
+	// Garmin TrackPointExtension values (GPX 1.1 only). Temperatures are in
+	// degrees Celsius and depth in meters.
+	Temperature      NullableFloat64
+	WaterTemperature NullableFloat64
+	Depth            NullableFloat64
+	HeartRate        NullableInt
+	Cadence          NullableInt
+	// Garmin GpxExtensions v3 WaypointExtension values (GPX 1.1 only)
+	Proximity    NullableFloat64
+	Categories   []string
+	Address      GPXAddress
+	PhoneNumbers []GPXPhoneNumber
+	// ShapingPoints are the Garmin autorouted points between this route point
+	// and the next one (GPX 1.1 only)
+	ShapingPoints []GPXShapingPoint
+	// Extensions are read and written only in GPX 1.1, the Garmin extension
+	// values are in the typed fields above and not in this tree
+	Extensions Extension
+
+	// trackPointExtensionSpace is the TrackPointExtension namespace of the
+	// parsed typed values, so that they are written with the same version
+	trackPointExtensionSpace string
 }
 
 // SpeedBetween calculates the speed between two GpxWpts.
@@ -761,6 +993,26 @@ func (pt *GPXPoint) SpeedBetween(pt2 *GPXPoint, threeD bool) float64 {
 	return distLen / seconds
 }
 
+// EllipsoidalHeight returns the height above the WGS84 ellipsoid. Elevation
+// is the height above the mean sea level, both Elevation and GeoidHeight are
+// needed.
+func (pt *GPXPoint) EllipsoidalHeight() NullableFloat64 {
+	if pt.Elevation.Null() || pt.GeoidHeight.Null() {
+		return NullableFloat64{}
+	}
+	return *NewNullableFloat64(pt.Elevation.Value() + pt.GeoidHeight.Value())
+}
+
+// SetEllipsoidalHeight sets Elevation from a height above the WGS84
+// ellipsoid, GeoidHeight is needed.
+func (pt *GPXPoint) SetEllipsoidalHeight(height float64) error {
+	if pt.GeoidHeight.Null() {
+		return errors.New("no geoid height")
+	}
+	pt.Elevation.SetValue(height - pt.GeoidHeight.Value())
+	return nil
+}
+
 // TimeDiff returns the time difference of two GpxWpts in seconds.
 func (pt *GPXPoint) TimeDiff(pt2 *GPXPoint) float64 {
 	t1 := pt.Timestamp
@@ -793,10 +1045,12 @@ type GPXRoute struct {
 	Comment     string
 	Description string
 	Source      string
-	// TODO
-	//Links       []Link
-	Number NullableInt
-	Type   string
+	Links       []GPXLink
+	Number      NullableInt
+	Type        string
+	// DisplayColor is the Garmin route color (GPX 1.1 only)
+	DisplayColor string
+	Extensions   Extension
 	// TODO
 	Points []GPXPoint
 }
@@ -811,6 +1065,19 @@ func (rte *GPXRoute) Length() float64 {
 	return Length2D(points)
 }
 
+// PathPoints returns the route points with the Garmin shaping points between
+// them, i.e. the path calculated by the device.
+func (rte *GPXRoute) PathPoints() []Point {
+	var result []Point
+	for _, pt := range rte.Points {
+		result = append(result, pt.Point)
+		for _, shapingPoint := range pt.ShapingPoints {
+			result = append(result, shapingPoint.Point)
+		}
+	}
+	return result
+}
+
 // Center returns the center of a GPX route.
 func (rte *GPXRoute) Center() (float64, float64) {
 	lenRtePts := len(rte.Points)
@@ -843,8 +1110,8 @@ func (rte *GPXRoute) ExecuteOnPoints(executor func(*GPXPoint)) {
 
 //GPXTrackSegment represents a segment of a track
 type GPXTrackSegment struct {
-	Points []GPXPoint
-	// TODO extensions
+	Points     []GPXPoint
+	Extensions Extension
 }
 
 // Length2D returns the 2D length of a GPX segment.
@@ -930,7 +1197,9 @@ func (seg *GPXTrackSegment) HasTimes() bool {
 	*/
 }
 
-// Speed returns the speed at point number in a GPX segment.
+// Speed returns the speed at point number in a GPX segment. The speed
+// recorded by the device (GPXPoint.Speed) is used if available, otherwise
+// it's calculated from the neighbour points.
 func (seg *GPXTrackSegment) Speed(pointIdx int) float64 {
 	trkptsLen := len(seg.Points)
 	if pointIdx >= trkptsLen {
@@ -938,6 +1207,9 @@ func (seg *GPXTrackSegment) Speed(pointIdx int) float64 {
 	}
 
 	point := seg.Points[pointIdx]
+	if point.Speed.NotNull() {
+		return point.Speed.Value()
+	}
 
 	var prevPt *GPXPoint
 	var nextPt *GPXPoint
@@ -1182,6 +1454,11 @@ func (seg *GPXTrackSegment) MovingData() MovingData {
 	}
 }
 
+// SensorData returns heart rate and cadence statistics of a GPX segment.
+func (seg *GPXTrackSegment) SensorData() SensorData {
+	return calcSensorData([]GPXTrackSegment{*seg})
+}
+
 //AppendPoint adds a point to the segment
 func (seg *GPXTrackSegment) AppendPoint(p *GPXPoint) {
 	seg.Points = append(seg.Points, *p)
@@ -1334,11 +1611,13 @@ type GPXTrack struct {
 	Comment     string
 	Description string
 	Source      string
-	// TODO
-	//Links    []Link
-	Number   NullableInt
-	Type     string
-	Segments []GPXTrackSegment
+	Links       []GPXLink
+	Number      NullableInt
+	Type        string
+	// DisplayColor is the Garmin track color (GPX 1.1 only)
+	DisplayColor string
+	Extensions   Extension
+	Segments     []GPXTrackSegment
 }
 
 // Length2D returns the 2D length of a GPX track.
@@ -1525,6 +1804,11 @@ func (trk *GPXTrack) MovingData() MovingData {
 	}
 }
 
+// SensorData returns heart rate and cadence statistics of a GPX track.
+func (trk *GPXTrack) SensorData() SensorData {
+	return calcSensorData(trk.Segments)
+}
+
 // Duration returns the duration of a GPX track.
 func (trk *GPXTrack) Duration() float64 {
 	if len(trk.Segments) == 0 {
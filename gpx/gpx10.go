@@ -128,19 +128,18 @@ type gpx10Gpx struct {
 	UrlName   string           `xml:"urlname,omitempty"`
 	Time      string           `xml:"time,omitempty"`
 	Keywords  string           `xml:"keywords,omitempty"`
-	Bounds    *GpxBounds       `xml:"bounds"`
+	Bounds    *gpx10GpxBounds  `xml:"bounds"`
 	Waypoints []*gpx10GpxPoint `xml:"wpt"`
 	Routes    []*gpx10GpxRte   `xml:"rte"`
 	Tracks    []*gpx10GpxTrk   `xml:"trk"`
 }
 
-//type gpx10GpxBounds struct {
-//	//XMLName xml.Name `xml:"bounds"`
-//	MinLat float64 `xml:"minlat,attr"`
-//	MaxLat float64 `xml:"maxlat,attr"`
-//	MinLon float64 `xml:"minlon,attr"`
-//	MaxLon float64 `xml:"maxlon,attr"`
-//}
+type gpx10GpxBounds struct {
+	MinLat float64 `xml:"minlat,attr"`
+	MaxLat float64 `xml:"maxlat,attr"`
+	MinLon float64 `xml:"minlon,attr"`
+	MaxLon float64 `xml:"maxlon,attr"`
+}
 
 //type gpx10GpxAuthor struct {
 //	Name  string        `xml:"name,omitempty"`
@@ -153,12 +152,6 @@ type gpx10Gpx struct {
 //	Domain string `xml:"domain,attr"`
 //}
 
-type gpx10GpxLink struct {
-	Href string `xml:"href,attr"`
-	Text string `xml:"text,omitempty"`
-	Type string `xml:"type,omitempty"`
-}
-
 //type gpx10GpxMetadata struct {
 //	XMLName xml.Name        `xml:"metadata"`
 //	Name    string          `xml:"name,omitempty"`
@@ -183,16 +176,19 @@ type gpx10GpxPoint struct {
 	// Position info
 	Ele         NullableFloat64 `xml:"ele,omitempty"`
 	Timestamp   string          `xml:"time,omitempty"`
-	MagVar      string          `xml:"magvar,omitempty"`
-	GeoIdHeight string          `xml:"geoidheight,omitempty"`
+	Course      NullableFloat64 `xml:"course,omitempty"`
+	Speed       NullableFloat64 `xml:"speed,omitempty"`
+	MagVar      NullableFloat64 `xml:"magvar,omitempty"`
+	GeoIdHeight NullableFloat64 `xml:"geoidheight,omitempty"`
 	// Description info
-	Name  string         `xml:"name,omitempty"`
-	Cmt   string         `xml:"cmt,omitempty"`
-	Desc  string         `xml:"desc,omitempty"`
-	Src   string         `xml:"src,omitempty"`
-	Links []gpx10GpxLink `xml:"link"`
-	Sym   string         `xml:"sym,omitempty"`
-	Type  string         `xml:"type,omitempty"`
+	Name    string `xml:"name,omitempty"`
+	Cmt     string `xml:"cmt,omitempty"`
+	Desc    string `xml:"desc,omitempty"`
+	Src     string `xml:"src,omitempty"`
+	Url     string `xml:"url,omitempty"`
+	UrlName string `xml:"urlname,omitempty"`
+	Sym     string `xml:"sym,omitempty"`
+	Type    string `xml:"type,omitempty"`
 	// Accuracy info
 	Fix           string   `xml:"fix,omitempty"`
 	Sat           *int     `xml:"sat,omitempty"`
@@ -201,23 +197,19 @@ type gpx10GpxPoint struct {
 	Pdop          *float64 `xml:"pdop,omitempty"`
 	AgeOfDGpsData *float64 `xml:"ageofdgpsdata,omitempty"`
 	DGpsId        *int     `xml:"dgpsid,omitempty"`
-
-	// Those two values are here for simplicity, but they are available only when this is part of a track segment (not route or waypoint)!
-	Course string `xml:"course,omitempty"`
-	Speed  string `speed:"speed,omitempty"`
 }
 
 type gpx10GpxRte struct {
-	XMLName xml.Name `xml:"rte"`
-	Name    string   `xml:"name,omitempty"`
-	Cmt     string   `xml:"cmt,omitempty"`
-	Desc    string   `xml:"desc,omitempty"`
-	Src     string   `xml:"src,omitempty"`
-	// TODO
-	//Links       []Link   `xml:"link"`
-	Number NullableInt      `xml:"number,omitempty"`
-	Type   string           `xml:"type,omitempty"`
-	Points []*gpx10GpxPoint `xml:"rtept"`
+	XMLName xml.Name         `xml:"rte"`
+	Name    string           `xml:"name,omitempty"`
+	Cmt     string           `xml:"cmt,omitempty"`
+	Desc    string           `xml:"desc,omitempty"`
+	Src     string           `xml:"src,omitempty"`
+	Url     string           `xml:"url,omitempty"`
+	UrlName string           `xml:"urlname,omitempty"`
+	Number  NullableInt      `xml:"number,omitempty"`
+	Type    string           `xml:"type,omitempty"`
+	Points  []*gpx10GpxPoint `xml:"rtept"`
 }
 
 type gpx10GpxTrkSeg struct {
@@ -227,13 +219,13 @@ type gpx10GpxTrkSeg struct {
 
 // Trk is a GPX track
 type gpx10GpxTrk struct {
-	XMLName xml.Name `xml:"trk"`
-	Name    string   `xml:"name,omitempty"`
-	Cmt     string   `xml:"cmt,omitempty"`
-	Desc    string   `xml:"desc,omitempty"`
-	Src     string   `xml:"src,omitempty"`
-	// TODO
-	//Links    []Link   `xml:"link"`
+	XMLName  xml.Name          `xml:"trk"`
+	Name     string            `xml:"name,omitempty"`
+	Cmt      string            `xml:"cmt,omitempty"`
+	Desc     string            `xml:"desc,omitempty"`
+	Src      string            `xml:"src,omitempty"`
+	Url      string            `xml:"url,omitempty"`
+	UrlName  string            `xml:"urlname,omitempty"`
 	Number   NullableInt       `xml:"number,omitempty"`
 	Type     string            `xml:"type,omitempty"`
 	Segments []*gpx10GpxTrkSeg `xml:"trkseg,omitempty"`
@@ -154,19 +154,12 @@ type gpx11Gpx struct {
 	XmlNsXsi     string   `xml:"xmlns:xsi,attr,omitempty"`
 	XmlSchemaLoc string   `xml:"xsi:schemaLocation,attr,omitempty"`
 
-	Version     string         `xml:"version,attr"`
-	Creator     string         `xml:"creator,attr"`
-	Name        string         `xml:"metadata>name,omitempty"`
-	Desc        string         `xml:"metadata>desc,omitempty"`
-	AuthorName  string         `xml:"metadata>author>name,omitempty"`
-	AuthorEmail *gpx11GpxEmail `xml:"metadata>author>email,omitempty"`
-	// TODO: There can be more than one link?
-	AuthorLink *gpx11GpxLink       `xml:"metadata>author>link,omitempty"`
-	Copyright  *gpx11GpxCopyright  `xml:"metadata>copyright,omitempty"`
-	Link       *gpx11GpxLink       `xml:"metadata>link,omitempty"`
-	Timestamp  string              `xml:"metadata>time,omitempty"`
-	Keywords   string              `xml:"metadata>keywords,omitempty"`
-	Bounds     *gpx11GpxBounds     `xml:"bounds"`
+	// Other root attributes, used for the extension namespace declarations
+	Attrs []xml.Attr `xml:",any,attr"`
+
+	Version    string              `xml:"version,attr"`
+	Creator    string              `xml:"creator,attr"`
+	Metadata   gpx11GpxMetadata    `xml:"metadata"`
 	Extensions *gpx11GpxExtensions `xml:"extensions"`
 	Waypoints  []*gpx11GpxPoint    `xml:"wpt"`
 	Routes     []*gpx11GpxRte      `xml:"rte"`
@@ -174,7 +167,6 @@ type gpx11Gpx struct {
 }
 
 type gpx11GpxBounds struct {
-	//XMLName xml.Name `xml:"bounds"`
 	MinLat float64 `xml:"minlat,attr"`
 	MaxLat float64 `xml:"maxlat,attr"`
 	MinLon float64 `xml:"minlon,attr"`
@@ -188,11 +180,11 @@ type gpx11GpxCopyright struct {
 	License string   `xml:"license,omitempty"`
 }
 
-//type gpx11GpxAuthor struct {
-//	Name  string        `xml:"name,omitempty"`
-//	Email string        `xml:"email,omitempty"`
-//	Link  *gpx11GpxLink `xml:"link"`
-//}
+type gpx11GpxPerson struct {
+	Name  string         `xml:"name,omitempty"`
+	Email *gpx11GpxEmail `xml:"email,omitempty"`
+	Link  *gpx11GpxLink  `xml:"link,omitempty"`
+}
 
 type gpx11GpxEmail struct {
 	Id     string `xml:"id,attr"`
@@ -205,20 +197,21 @@ type gpx11GpxLink struct {
 	Type string `xml:"type,omitempty"`
 }
 
-//type gpx11GpxMetadata struct {
-//	XMLName xml.Name        `xml:"metadata"`
-//	Name    string          `xml:"name,omitempty"`
-//	Desc    string          `xml:"desc,omitempty"`
-//	Author  *gpx11GpxAuthor `xml:"author,omitempty"`
-//	//	Copyright *GpxCopyright `xml:"copyright,omitempty"`
-//	//	Links     []GpxLink     `xml:"link"`
-//	Timestamp string `xml:"time,omitempty"`
-//	Keywords  string `xml:"keywords,omitempty"`
-//	//	Bounds    *GpxBounds    `xml:"bounds"`
-//}
+type gpx11GpxMetadata struct {
+	XMLName    xml.Name            `xml:"metadata"`
+	Name       string              `xml:"name,omitempty"`
+	Desc       string              `xml:"desc,omitempty"`
+	Author     *gpx11GpxPerson     `xml:"author,omitempty"`
+	Copyright  *gpx11GpxCopyright  `xml:"copyright,omitempty"`
+	Links      []gpx11GpxLink      `xml:"link"`
+	Timestamp  string              `xml:"time,omitempty"`
+	Keywords   string              `xml:"keywords,omitempty"`
+	Bounds     *gpx11GpxBounds     `xml:"bounds,omitempty"`
+	Extensions *gpx11GpxExtensions `xml:"extensions,omitempty"`
+}
 
 type gpx11GpxExtensions struct {
-	Bytes []byte `xml:",innerxml"`
+	Nodes []ExtensionNode `xml:",any"`
 }
 
 /**
@@ -230,8 +223,8 @@ type gpx11GpxPoint struct {
 	// Position info
 	Ele         NullableFloat64 `xml:"ele,omitempty"`
 	Timestamp   string          `xml:"time,omitempty"`
-	MagVar      string          `xml:"magvar,omitempty"`
-	GeoIdHeight string          `xml:"geoidheight,omitempty"`
+	MagVar      NullableFloat64 `xml:"magvar,omitempty"`
+	GeoIdHeight NullableFloat64 `xml:"geoidheight,omitempty"`
 	// Description info
 	Name  string         `xml:"name,omitempty"`
 	Cmt   string         `xml:"cmt,omitempty"`
@@ -241,43 +234,45 @@ type gpx11GpxPoint struct {
 	Sym   string         `xml:"sym,omitempty"`
 	Type  string         `xml:"type,omitempty"`
 	// Accuracy info
-	Fix           string   `xml:"fix,omitempty"`
-	Sat           *int     `xml:"sat,omitempty"`
-	Hdop          *float64 `xml:"hdop,omitempty"`
-	Vdop          *float64 `xml:"vdop,omitempty"`
-	Pdop          *float64 `xml:"pdop,omitempty"`
-	AgeOfDGpsData *float64 `xml:"ageofdgpsdata,omitempty"`
-	DGpsId        *int     `xml:"dgpsid,omitempty"`
+	Fix           string              `xml:"fix,omitempty"`
+	Sat           *int                `xml:"sat,omitempty"`
+	Hdop          *float64            `xml:"hdop,omitempty"`
+	Vdop          *float64            `xml:"vdop,omitempty"`
+	Pdop          *float64            `xml:"pdop,omitempty"`
+	AgeOfDGpsData *float64            `xml:"ageofdgpsdata,omitempty"`
+	DGpsId        *int                `xml:"dgpsid,omitempty"`
+	Extensions    *gpx11GpxExtensions `xml:"extensions,omitempty"`
 }
 
 type gpx11GpxRte struct {
-	XMLName xml.Name `xml:"rte"`
-	Name    string   `xml:"name,omitempty"`
-	Cmt     string   `xml:"cmt,omitempty"`
-	Desc    string   `xml:"desc,omitempty"`
-	Src     string   `xml:"src,omitempty"`
-	// TODO
-	//Links       []Link   `xml:"link"`
-	Number NullableInt      `xml:"number,omitempty"`
-	Type   string           `xml:"type,omitempty"`
-	Points []*gpx11GpxPoint `xml:"rtept"`
+	XMLName    xml.Name            `xml:"rte"`
+	Name       string              `xml:"name,omitempty"`
+	Cmt        string              `xml:"cmt,omitempty"`
+	Desc       string              `xml:"desc,omitempty"`
+	Src        string              `xml:"src,omitempty"`
+	Links      []gpx11GpxLink      `xml:"link"`
+	Number     NullableInt         `xml:"number,omitempty"`
+	Type       string              `xml:"type,omitempty"`
+	Extensions *gpx11GpxExtensions `xml:"extensions,omitempty"`
+	Points     []*gpx11GpxPoint    `xml:"rtept"`
 }
 
 type gpx11GpxTrkSeg struct {
-	XMLName xml.Name         `xml:"trkseg"`
-	Points  []*gpx11GpxPoint `xml:"trkpt"`
+	XMLName    xml.Name            `xml:"trkseg"`
+	Points     []*gpx11GpxPoint    `xml:"trkpt"`
+	Extensions *gpx11GpxExtensions `xml:"extensions,omitempty"`
 }
 
 // Trk is a GPX track
 type gpx11GpxTrk struct {
-	XMLName xml.Name `xml:"trk"`
-	Name    string   `xml:"name,omitempty"`
-	Cmt     string   `xml:"cmt,omitempty"`
-	Desc    string   `xml:"desc,omitempty"`
-	Src     string   `xml:"src,omitempty"`
-	// TODO
-	//Links    []Link   `xml:"link"`
-	Number   NullableInt       `xml:"number,omitempty"`
-	Type     string            `xml:"type,omitempty"`
-	Segments []*gpx11GpxTrkSeg `xml:"trkseg,omitempty"`
+	XMLName    xml.Name            `xml:"trk"`
+	Name       string              `xml:"name,omitempty"`
+	Cmt        string              `xml:"cmt,omitempty"`
+	Desc       string              `xml:"desc,omitempty"`
+	Src        string              `xml:"src,omitempty"`
+	Links      []gpx11GpxLink      `xml:"link"`
+	Number     NullableInt         `xml:"number,omitempty"`
+	Type       string              `xml:"type,omitempty"`
+	Extensions *gpx11GpxExtensions `xml:"extensions,omitempty"`
+	Segments   []*gpx11GpxTrkSeg   `xml:"trkseg,omitempty"`
 }
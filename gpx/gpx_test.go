@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"math"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -62,6 +63,18 @@ func assertLinesEquals(t *testing.T, string1, string2 string) {
 	}
 }
 
+// assertStringers checks the String() values of a slice of fmt.Stringer
+// values (for example issues or changes)
+func assertStringers(t *testing.T, values interface{}, expected ...string) {
+	slice := reflect.ValueOf(values)
+	if slice.Len() != len(expected) {
+		t.Fatalf("Expected %d values, found %d: %v", len(expected), slice.Len(), values)
+	}
+	for i := 0; i < slice.Len(); i++ {
+		assertEquals(t, slice.Index(i).Interface().(fmt.Stringer).String(), expected[i])
+	}
+}
+
 func assertNil(t *testing.T, var1 interface{}) {
 	if var1 != nil {
 		fmt.Println(var1)
@@ -125,7 +138,7 @@ func TestParseGPXTimes(t *testing.T) {
 	}
 	for _, value := range datetimes {
 		fmt.Println("datetime:", value)
-		parsedTime, err := parseGPXTime(value)
+		parsedTime, err := parseGPXTime(value, nil)
 		fmt.Println(parsedTime)
 		assertNil(t, err)
 		assertNotNil(t, parsedTime)
@@ -140,15 +153,15 @@ func TestParseGPXTimes(t *testing.T) {
 
 func testDetectVersion(t *testing.T, fileName, expectedVersion string) {
 	f, err := os.Open(fileName)
-	fmt.Println("err=", err)
-	contents, _ := ioutil.ReadAll(f)
-	version, err := guessGPXVersion(contents)
-	fmt.Println("Version=", version)
+	assertNil(t, err)
+	defer f.Close()
+	decoder := NewDecoder(f)
+	_, err = decoder.Next()
 	if err != nil {
-		t.Error("Can't detect 1.1 GPX, error=" + err.Error())
+		t.Error("Can't detect GPX version, error=" + err.Error())
 	}
-	if version != expectedVersion {
-		t.Error("Can't detect 1.1 GPX")
+	if decoder.Version() != expectedVersion {
+		t.Error("Can't detect " + expectedVersion + " GPX")
 	}
 }
 
@@ -202,20 +215,24 @@ func executeSample11GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Version, "1.1")
 	assertEquals(t, gpxDoc.Creator, "...")
 	assertEquals(t, gpxDoc.Name, "example name")
-	assertEquals(t, gpxDoc.AuthorName, "author name")
-	assertEquals(t, gpxDoc.AuthorEmail, "aaa@bbb.com")
+	assertEquals(t, gpxDoc.Author.Name, "author name")
+	assertEquals(t, *gpxDoc.Author.Email, Email{ID: "aaa", Domain: "bbb.com"})
+	assertEquals(t, gpxDoc.Author.Email.String(), "aaa@bbb.com")
 	assertEquals(t, gpxDoc.Description, "example description")
-	assertEquals(t, gpxDoc.AuthorLink, "http://link")
-	assertEquals(t, gpxDoc.AuthorLinkText, "link text")
-	assertEquals(t, gpxDoc.AuthorLinkType, "link type")
-	assertEquals(t, gpxDoc.Copyright, "gpxauth")
-	assertEquals(t, gpxDoc.CopyrightYear, "2013")
-	assertEquals(t, gpxDoc.CopyrightLicense, "lic")
-	assertEquals(t, gpxDoc.Link, "http://link2")
-	assertEquals(t, gpxDoc.LinkText, "link text2")
-	assertEquals(t, gpxDoc.LinkType, "link type2")
+	assertEquals(t, *gpxDoc.Author.Link, GPXLink{Href: "http://link", Text: "link text", Type: "link type"})
+	assertEquals(t, *gpxDoc.Copyright, Copyright{Author: "gpxauth", Year: "2013", License: "lic"})
+	assertEquals(t, gpxDoc.Link(), "http://link2")
+	assertEquals(t, gpxDoc.LinkText(), "link text2")
+	assertEquals(t, gpxDoc.LinkType(), "link type2")
+	assertEquals(t, len(gpxDoc.Links), 1)
+	assertEquals(t, gpxDoc.Links[0], GPXLink{Href: "http://link2", Text: "link text2", Type: "link type2"})
 	assertEquals(t, gpxDoc.Time.Format(TimeFormat), time.Date(2013, time.January, 01, 12, 0, 0, 0, time.UTC).Format(TimeFormat))
 	assertEquals(t, gpxDoc.Keywords, "example keywords")
+	assertEquals(t, *gpxDoc.DeclaredBounds, GpxBounds{MinLatitude: 1.2, MaxLatitude: 5.6, MinLongitude: 3.4, MaxLongitude: 7.8})
+	assertEquals(t, len(gpxDoc.MetadataExtensions.Nodes), 3)
+	assertEquals(t, gpxDoc.MetadataExtensions.GetNode("", "bbb").Data, "ccc")
+	assertEquals(t, len(gpxDoc.Extensions.Nodes), 1)
+	assertEquals(t, gpxDoc.Extensions.GetNode("", "gpxext").Data, "...")
 
 	// Waypoints:
 	assertEquals(t, len(gpxDoc.Waypoints), 2)
@@ -223,24 +240,26 @@ func executeSample11GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Waypoints[0].Longitude, 45.6)
 	assertEquals(t, gpxDoc.Waypoints[0].Elevation.Value(), 75.1)
 	assertEquals(t, gpxDoc.Waypoints[0].Timestamp.Format(TimeFormat), "2013-01-02T02:03:00Z")
-	assertEquals(t, gpxDoc.Waypoints[0].MagneticVariation, "1.1")
-	assertEquals(t, gpxDoc.Waypoints[0].GeoidHeight, "2.0")
+	assertEquals(t, gpxDoc.Waypoints[0].MagneticVariation.Value(), 1.1)
+	assertEquals(t, gpxDoc.Waypoints[0].GeoidHeight.Value(), 2.0)
 	assertEquals(t, gpxDoc.Waypoints[0].Name, "example name")
 	assertEquals(t, gpxDoc.Waypoints[0].Comment, "example cmt")
 	assertEquals(t, gpxDoc.Waypoints[0].Description, "example desc")
 	assertEquals(t, gpxDoc.Waypoints[0].Source, "example src")
-	// TODO
-	// Links       []GpxLink
+	assertEquals(t, len(gpxDoc.Waypoints[0].Links), 1)
+	assertEquals(t, gpxDoc.Waypoints[0].Links[0], GPXLink{Href: "http://link3", Text: "link text3", Type: "link type3"})
 	assertEquals(t, gpxDoc.Waypoints[0].Symbol, "example sym")
 	assertEquals(t, gpxDoc.Waypoints[0].Type, "example type")
-	assertEquals(t, gpxDoc.Waypoints[0].TypeOfGpsFix, "2d")
+	assertEquals(t, gpxDoc.Waypoints[0].TypeOfGpsFix, Fix2D)
 	assertEquals(t, gpxDoc.Waypoints[0].Satellites.Value(), 5)
 	assertEquals(t, gpxDoc.Waypoints[0].HorizontalDilution.Value(), 6.0)
 	assertEquals(t, gpxDoc.Waypoints[0].VerticalDilution.Value(), 7.0)
 	assertEquals(t, gpxDoc.Waypoints[0].PositionalDilution.Value(), 8.0)
 	assertEquals(t, gpxDoc.Waypoints[0].AgeOfDGpsData.Value(), 9.0)
 	assertEquals(t, gpxDoc.Waypoints[0].DGpsId.Value(), 45)
-	// TODO: Extensions
+	assertEquals(t, len(gpxDoc.Waypoints[0].Extensions.Nodes), 2)
+	assertEquals(t, gpxDoc.Waypoints[0].Extensions.GetNode("http://www.topografix.com/GPX/1/1", "ccc").Data, "ddd")
+	assertTrue(t, "no extensions", gpxDoc.Waypoints[1].Extensions.Empty())
 
 	assertEquals(t, gpxDoc.Waypoints[1].Latitude, 13.4)
 	assertEquals(t, gpxDoc.Waypoints[1].Longitude, 46.7)
@@ -254,31 +273,33 @@ func executeSample11GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Routes[0].Number.Value(), 7)
 	assertEquals(t, gpxDoc.Routes[0].Type, "rte type")
 	assertEquals(t, len(gpxDoc.Routes[0].Points), 3)
-	// TODO: Link
+	assertEquals(t, len(gpxDoc.Routes[0].Links), 1)
+	assertEquals(t, gpxDoc.Routes[0].Links[0], GPXLink{Href: "http://link3", Text: "link text3", Type: "link type3"})
 	// TODO: Points
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Elevation.Value(), 75.1)
 	fmt.Println("t=", gpxDoc.Routes[0].Points[0].Timestamp)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Timestamp.Format(TimeFormat), "2013-01-02T02:03:03Z")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].MagneticVariation, "1.2")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].GeoidHeight, "2.1")
+	assertEquals(t, gpxDoc.Routes[0].Points[0].MagneticVariation.Value(), 1.2)
+	assertEquals(t, gpxDoc.Routes[0].Points[0].GeoidHeight.Value(), 2.1)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Name, "example name r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Comment, "example cmt r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Description, "example desc r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Source, "example src r")
-	// TODO
-	//assertEquals(t, gpxDoc.Routes[0].Points[0].Link, "http://linkrtept")
-	//assertEquals(t, gpxDoc.Routes[0].Points[0].Text, "rtept link")
+	assertEquals(t, len(gpxDoc.Routes[0].Points[0].Links), 1)
+	assertEquals(t, gpxDoc.Routes[0].Points[0].Links[0], GPXLink{Href: "http://linkrtept", Text: "rtept link", Type: "rtept link type"})
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Type, "example type r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Symbol, "example sym r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Type, "example type r")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].TypeOfGpsFix, "3d")
+	assertEquals(t, gpxDoc.Routes[0].Points[0].TypeOfGpsFix, Fix3D)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Satellites.Value(), 6)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].HorizontalDilution.Value(), 7.0)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].VerticalDilution.Value(), 8.0)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].PositionalDilution.Value(), 9.0)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].AgeOfDGpsData.Value(), 10.0)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].DGpsId.Value(), 99)
-	// TODO: Extensions
+	assertEquals(t, gpxDoc.Routes[0].Points[0].Extensions.GetNode("", "rteepte").Data, "rtept")
+	assertEquals(t, len(gpxDoc.Routes[0].Extensions.Nodes), 2)
+	assertEquals(t, gpxDoc.Routes[0].Extensions.GetNode("", "rtee2").Data, "2")
 
 	assertEquals(t, gpxDoc.Routes[1].Name, "second route")
 	assertEquals(t, gpxDoc.Routes[1].Description, "example desc 2")
@@ -292,7 +313,8 @@ func executeSample11GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Tracks[0].Source, "example src t")
 	assertEquals(t, gpxDoc.Tracks[0].Number.Value(), 1)
 	assertEquals(t, gpxDoc.Tracks[0].Type, "t")
-	// TODO link
+	assertEquals(t, len(gpxDoc.Tracks[0].Links), 1)
+	assertEquals(t, gpxDoc.Tracks[0].Links[0], GPXLink{Href: "http://trk", Text: "trk link", Type: "trk link type"})
 
 	assertEquals(t, len(gpxDoc.Tracks[0].Segments), 2)
 
@@ -300,23 +322,25 @@ func executeSample11GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, len(gpxDoc.Tracks[0].Segments[1].Points), 0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Elevation.Value(), 11.1)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Timestamp.Format(TimeFormat), "2013-01-01T12:00:04Z")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].MagneticVariation, "12")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].GeoidHeight, "13")
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].MagneticVariation.Value(), 12.0)
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].GeoidHeight.Value(), 13.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Name, "example name t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Comment, "example cmt t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Description, "example desc t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Source, "example src t")
-	// TODO link
+	assertEquals(t, len(gpxDoc.Tracks[0].Segments[0].Points[0].Links), 1)
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Links[0], GPXLink{Href: "http://trkpt", Text: "trkpt link", Type: "trkpt link type"})
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Symbol, "example sym t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Type, "example type t")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].TypeOfGpsFix, "3d")
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].TypeOfGpsFix, Fix3D)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Satellites.Value(), 100)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].HorizontalDilution.Value(), 101.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].VerticalDilution.Value(), 102.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].PositionalDilution.Value(), 103.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].AgeOfDGpsData.Value(), 104.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].DGpsId.Value(), 99)
-	// TODO extensions
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Extensions.GetNode("", "last").Data, "true")
+	assertEquals(t, gpxDoc.Tracks[0].Extensions.GetNode("", "a1").Data, "2")
 }
 
 func TestParseAndReparseGPX10(t *testing.T) {
@@ -361,18 +385,17 @@ func executeSample10GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Version, "1.0")
 	assertEquals(t, gpxDoc.Creator, "...")
 	assertEquals(t, gpxDoc.Name, "example name")
-	assertEquals(t, gpxDoc.AuthorName, "example author")
-	assertEquals(t, gpxDoc.AuthorEmail, "example@email.com")
+	assertEquals(t, gpxDoc.Author.Name, "example author")
+	assertEquals(t, gpxDoc.Author.Email.String(), "example@email.com")
 	assertEquals(t, gpxDoc.Description, "example description")
-	assertEquals(t, gpxDoc.AuthorLink, "")
-	assertEquals(t, gpxDoc.AuthorLinkText, "")
-	assertEquals(t, gpxDoc.AuthorLinkType, "")
-	assertEquals(t, gpxDoc.Copyright, "")
-	assertEquals(t, gpxDoc.CopyrightYear, "")
-	assertEquals(t, gpxDoc.CopyrightLicense, "")
-	assertEquals(t, gpxDoc.Link, "http://example.url")
-	assertEquals(t, gpxDoc.LinkText, "example urlname")
-	assertEquals(t, gpxDoc.LinkType, "")
+	assertTrue(t, "no author link", gpxDoc.Author.Link == nil)
+	assertTrue(t, "no copyright", gpxDoc.Copyright == nil)
+	assertEquals(t, *gpxDoc.DeclaredBounds, GpxBounds{MinLatitude: 1.2, MaxLatitude: 5.6, MinLongitude: 3.4, MaxLongitude: 7.8})
+	assertEquals(t, gpxDoc.Link(), "http://example.url")
+	assertEquals(t, gpxDoc.LinkText(), "example urlname")
+	assertEquals(t, gpxDoc.LinkType(), "")
+	assertEquals(t, len(gpxDoc.Links), 1)
+	assertEquals(t, gpxDoc.Links[0], GPXLink{Href: "http://example.url", Text: "example urlname"})
 	assertEquals(t, gpxDoc.Time.Format(TimeFormat), time.Date(2013, time.January, 01, 12, 0, 0, 0, time.UTC).Format(TimeFormat))
 	assertEquals(t, gpxDoc.Keywords, "example keywords")
 
@@ -384,17 +407,17 @@ func executeSample10GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Waypoints[0].Longitude, 45.6)
 	assertEquals(t, gpxDoc.Waypoints[0].Elevation.Value(), 75.1)
 	assertEquals(t, gpxDoc.Waypoints[0].Timestamp.Format(TimeFormat), "2013-01-02T02:03:00Z")
-	assertEquals(t, gpxDoc.Waypoints[0].MagneticVariation, "1.1")
-	assertEquals(t, gpxDoc.Waypoints[0].GeoidHeight, "2.0")
+	assertEquals(t, gpxDoc.Waypoints[0].MagneticVariation.Value(), 1.1)
+	assertEquals(t, gpxDoc.Waypoints[0].GeoidHeight.Value(), 2.0)
 	assertEquals(t, gpxDoc.Waypoints[0].Name, "example name")
 	assertEquals(t, gpxDoc.Waypoints[0].Comment, "example cmt")
 	assertEquals(t, gpxDoc.Waypoints[0].Description, "example desc")
 	assertEquals(t, gpxDoc.Waypoints[0].Source, "example src")
-	// TODO
-	// Links       []GpxLink
+	assertEquals(t, len(gpxDoc.Waypoints[0].Links), 1)
+	assertEquals(t, gpxDoc.Waypoints[0].Links[0], GPXLink{Href: "example url", Text: "example urlname"})
 	assertEquals(t, gpxDoc.Waypoints[0].Symbol, "example sym")
 	assertEquals(t, gpxDoc.Waypoints[0].Type, "example type")
-	assertEquals(t, gpxDoc.Waypoints[0].TypeOfGpsFix, "2d")
+	assertEquals(t, gpxDoc.Waypoints[0].TypeOfGpsFix, Fix2D)
 	assertEquals(t, gpxDoc.Waypoints[0].Satellites.Value(), 5)
 	assertEquals(t, gpxDoc.Waypoints[0].HorizontalDilution.Value(), 6.0)
 	assertEquals(t, gpxDoc.Waypoints[0].VerticalDilution.Value(), 7.0)
@@ -415,24 +438,24 @@ func executeSample10GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Routes[0].Number.Value(), 7)
 	assertEquals(t, gpxDoc.Routes[0].Type, "")
 	assertEquals(t, len(gpxDoc.Routes[0].Points), 3)
-	// TODO: Link
+	assertEquals(t, len(gpxDoc.Routes[0].Links), 1)
+	assertEquals(t, gpxDoc.Routes[0].Links[0], GPXLink{Href: "example url", Text: "example urlname"})
 	// TODO: Points
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Elevation.Value(), 75.1)
 	fmt.Println("t=", gpxDoc.Routes[0].Points[0].Timestamp)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Timestamp.Format(TimeFormat), "2013-01-02T02:03:03Z")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].MagneticVariation, "1.2")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].GeoidHeight, "2.1")
+	assertEquals(t, gpxDoc.Routes[0].Points[0].MagneticVariation.Value(), 1.2)
+	assertEquals(t, gpxDoc.Routes[0].Points[0].GeoidHeight.Value(), 2.1)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Name, "example name r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Comment, "example cmt r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Description, "example desc r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Source, "example src r")
-	// TODO link
-	//assertEquals(t, gpxDoc.Routes[0].Points[0].Link, "http://linkrtept")
-	//assertEquals(t, gpxDoc.Routes[0].Points[0].Text, "rtept link")
+	assertEquals(t, len(gpxDoc.Routes[0].Points[0].Links), 1)
+	assertEquals(t, gpxDoc.Routes[0].Points[0].Links[0], GPXLink{Href: "example url r", Text: "example urlname r"})
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Type, "example type r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Symbol, "example sym r")
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Type, "example type r")
-	assertEquals(t, gpxDoc.Routes[0].Points[0].TypeOfGpsFix, "3d")
+	assertEquals(t, gpxDoc.Routes[0].Points[0].TypeOfGpsFix, Fix3D)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].Satellites.Value(), 6)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].HorizontalDilution.Value(), 7.0)
 	assertEquals(t, gpxDoc.Routes[0].Points[0].VerticalDilution.Value(), 8.0)
@@ -453,7 +476,8 @@ func executeSample10GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, gpxDoc.Tracks[0].Source, "example src t")
 	assertEquals(t, gpxDoc.Tracks[0].Number.Value(), 1)
 	assertEquals(t, gpxDoc.Tracks[0].Type, "")
-	// TODO link
+	assertEquals(t, len(gpxDoc.Tracks[0].Links), 1)
+	assertEquals(t, gpxDoc.Tracks[0].Links[0], GPXLink{Href: "example url t", Text: "example urlname t"})
 
 	assertEquals(t, len(gpxDoc.Tracks[0].Segments), 2)
 
@@ -461,16 +485,17 @@ func executeSample10GpxAsserts(t *testing.T, gpxDoc *GPX) {
 	assertEquals(t, len(gpxDoc.Tracks[0].Segments[1].Points), 0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Elevation.Value(), 11.1)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Timestamp.Format(TimeFormat), "2013-01-01T12:00:04Z")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].MagneticVariation, "12")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].GeoidHeight, "13")
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].MagneticVariation.Value(), 12.0)
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].GeoidHeight.Value(), 13.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Name, "example name t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Comment, "example cmt t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Description, "example desc t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Source, "example src t")
-	// TODO link
+	assertEquals(t, len(gpxDoc.Tracks[0].Segments[0].Points[0].Links), 1)
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Links[0], GPXLink{Href: "example url t", Text: "example urlname t"})
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Symbol, "example sym t")
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Type, "example type t")
-	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].TypeOfGpsFix, "3d")
+	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].TypeOfGpsFix, Fix3D)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].Satellites.Value(), 100)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].HorizontalDilution.Value(), 101.0)
 	assertEquals(t, gpxDoc.Tracks[0].Segments[0].Points[0].VerticalDilution.Value(), 102.0)
@@ -686,9 +711,8 @@ func TestToXml(t *testing.T) {
 	xml, _ := g.ToXml(ToXmlParams{Version: "1.1", Indent: true})
 	xmlA := string(xml)
 	xmlE := `<?xml version="1.0" encoding="UTF-8"?>
-<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="eTrex 10">
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" xmlns:wptx1="http://www.garmin.com/xmlschemas/WaypointExtension/v1" version="1.1" creator="eTrex 10">
 	<metadata>
-        <author></author>
 		<link href="http://www.garmin.com">
 			<text>Garmin International</text>
 		</link>
@@ -708,22 +732,47 @@ func TestToXml(t *testing.T) {
 	</wpt>
 	<trk>
 		<name>17-MRZ-12 16:44:12</name>
+		<extensions>
+			<gpxx:TrackExtension>
+				<gpxx:DisplayColor>Cyan</gpxx:DisplayColor>
+			</gpxx:TrackExtension>
+		</extensions>
 		<trkseg>
 			<trkpt lat="52.5113534275" lon="13.4571944922">
 				<ele>59.26</ele>
 				<time>2012-03-17T12:46:19Z</time>
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:cad>0</gpxtpx:cad>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
 			</trkpt>
 			<trkpt lat="52.5113568641" lon="13.4571697656">
 				<ele>65.51</ele>
 				<time>2012-03-17T12:46:44Z</time>
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:cad>0</gpxtpx:cad>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
 			</trkpt>
 			<trkpt lat="52.511710329" lon="13.456941694">
 				<ele>65.99</ele>
 				<time>2012-03-17T12:47:01Z</time>
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:cad>0</gpxtpx:cad>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
 			</trkpt>
 			<trkpt lat="52.5117189623" lon="13.4567520116">
 				<ele>63.58</ele>
 				<time>2012-03-17T12:47:23Z</time>
+				<extensions>
+					<gpxtpx:TrackPointExtension>
+						<gpxtpx:cad>0</gpxtpx:cad>
+					</gpxtpx:TrackPointExtension>
+				</extensions>
 			</trkpt>
 		</trkseg>
 	</trk>
@@ -750,9 +799,7 @@ func TestNewXml(t *testing.T) {
 	//expectedXml := `<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd" version="1.1" creator="https://github.com/ptrv/go-gpx">
 	expectedXml := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="https://github.com/tkrajina/gpxgo">
-	<metadata>
-			<author></author>
-	</metadata>
+	<metadata></metadata>
 	<trk>
 		<trkseg>
 			<trkpt lat="2.1234" lon="5.1234">
@@ -1326,3 +1373,172 @@ ERRgpx>
 		t.Error("gpxDoc should be empty, found:", gpxDoc)
 	}
 }
+
+func TestMultipleLinks(t *testing.T) {
+	links := []GPXLink{
+		GPXLink{Href: "http://first", Text: "first", Type: "text/html"},
+		GPXLink{Href: "http://second", Text: "second"},
+	}
+	original := &GPX{Metadata: Metadata{Links: links}}
+	original.Waypoints = append(original.Waypoints, GPXPoint{Links: links})
+	original.Tracks = append(original.Tracks, GPXTrack{Links: links})
+
+	xmlBytes, err := original.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	gpxDoc, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, len(gpxDoc.Links), 2)
+	assertEquals(t, gpxDoc.Links[1], links[1])
+	assertEquals(t, gpxDoc.Link(), "http://first")
+	assertEquals(t, len(gpxDoc.Waypoints[0].Links), 2)
+	assertEquals(t, gpxDoc.Waypoints[0].Links[0], links[0])
+	assertEquals(t, len(gpxDoc.Tracks[0].Links), 2)
+	assertEquals(t, gpxDoc.Tracks[0].Links[1], links[1])
+
+	// GPX 1.0 has only one url/urlname per element
+	xmlBytes, err = original.ToXml(ToXmlParams{Version: "1.0"})
+	assertNil(t, err)
+	gpxDoc, err = ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, len(gpxDoc.Waypoints[0].Links), 1)
+	assertEquals(t, gpxDoc.Waypoints[0].Links[0], GPXLink{Href: "http://first", Text: "first"})
+	assertEquals(t, len(gpxDoc.Tracks[0].Links), 1)
+}
+
+func TestGpx10SpeedAndCourse(t *testing.T) {
+	xml := `<gpx version="1.0"><trk><trkseg>
+<trkpt lat="1" lon="1"><time>2013-01-01T12:00:00Z</time><course>90.5</course><speed>3.5</speed></trkpt>
+<trkpt lat="1.1" lon="1"><time>2013-01-01T12:00:10Z</time></trkpt>
+<trkpt lat="1.2" lon="1"><time>2013-01-01T12:00:20Z</time></trkpt>
+</trkseg></trk></gpx>`
+	g, err := ParseString(xml)
+	assertNil(t, err)
+	segment := g.Tracks[0].Segments[0]
+	assertEquals(t, segment.Points[0].Course.Value(), 90.5)
+	assertEquals(t, segment.Points[0].Speed.Value(), 3.5)
+	assertTrue(t, "no speed", segment.Points[1].Speed.Null())
+
+	assertEquals(t, segment.Speed(0), 3.5)
+	assertTrue(t, "calculated speed", segment.Speed(1) > 1000)
+
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.0"})
+	assertNil(t, err)
+	assertTrue(t, "1.0 speed", strings.Contains(string(xmlBytes), "<time>2013-01-01T12:00:00Z</time><course>90.5</course><speed>3.5</speed>"))
+
+	xmlBytes, err = g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	assertTrue(t, "1.1 speed", strings.Contains(string(xmlBytes), "<gpxtpx:speed>3.5</gpxtpx:speed><gpxtpx:course>90.5</gpxtpx:course>"))
+	parsed, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, parsed.Tracks[0].Segments[0].Points[0].Speed.Value(), 3.5)
+	assertEquals(t, parsed.Tracks[0].Segments[0].Points[0].Course.Value(), 90.5)
+}
+
+func TestFixType(t *testing.T) {
+	for _, name := range []string{"none", "2d", "3d", "dgps", "pps", ""} {
+		fixType, err := ParseFixType(name)
+		assertNil(t, err)
+		assertEquals(t, fixType.String(), name)
+	}
+	fixType, err := ParseFixType(" DGPS ")
+	assertNil(t, err)
+	assertEquals(t, fixType, FixDGPS)
+	fixType, err = ParseFixType("4d")
+	assertTrue(t, "invalid fix", err != nil)
+	assertEquals(t, fixType, FixUnknown)
+}
+
+func TestMagneticVariationAndFix(t *testing.T) {
+	xml := `<gpx version="1.1">
+<wpt lat="1" lon="1"><magvar>359.5</magvar><geoidheight>-12.5</geoidheight><fix>pps</fix></wpt>
+<wpt lat="1" lon="1"><magvar>360</magvar><fix>4d</fix></wpt>
+</gpx>`
+	g, err := ParseString(xml)
+	assertNil(t, err)
+	assertEquals(t, g.Waypoints[0].MagneticVariation.Value(), 359.5)
+	assertEquals(t, g.Waypoints[0].GeoidHeight.Value(), -12.5)
+	assertEquals(t, g.Waypoints[0].TypeOfGpsFix, FixPPS)
+	assertTrue(t, "out of range", g.Waypoints[1].MagneticVariation.Null())
+	assertEquals(t, g.Waypoints[1].TypeOfGpsFix, FixUnknown)
+
+	g, err = ParseStringWithOptions(xml, ParseOptions{Lenient: true})
+	assertNil(t, err)
+	assertEquals(t, len(g.ParseErrors), 2)
+	assertEquals(t, g.ParseErrors[0].Path, "gpx/wpt[2]/magvar")
+	assertEquals(t, g.ParseErrors[1].Path, "gpx/wpt[2]/fix")
+
+	for _, version := range []string{"1.0", "1.1"} {
+		xmlBytes, err := g.ToXml(ToXmlParams{Version: version})
+		assertNil(t, err)
+		assertTrue(t, "written values", strings.Contains(string(xmlBytes), "<magvar>359.5</magvar><geoidheight>-12.5</geoidheight>"))
+		assertTrue(t, "written fix", strings.Contains(string(xmlBytes), "<fix>pps</fix>"))
+	}
+}
+
+func TestEllipsoidalHeight(t *testing.T) {
+	point := GPXPoint{}
+	height := point.EllipsoidalHeight()
+	assertTrue(t, "no height", height.Null())
+	assertTrue(t, "no geoid height", point.SetEllipsoidalHeight(100) != nil)
+
+	point.GeoidHeight.SetValue(47.5)
+	assertNil(t, point.SetEllipsoidalHeight(400))
+	assertEquals(t, point.Elevation.Value(), 352.5)
+	height = point.EllipsoidalHeight()
+	assertEquals(t, height.Value(), 400.0)
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	original := &GPX{Metadata: Metadata{
+		Name:           "name",
+		Author:         &Person{Name: "author", Email: ParseEmail("first.last@example.com"), Link: &GPXLink{Href: "http://author", Text: "home"}},
+		Copyright:      &Copyright{Author: "holder", Year: "2014", License: "http://license"},
+		DeclaredBounds: &GpxBounds{MinLatitude: -1.5, MaxLatitude: 2.5, MinLongitude: 10, MaxLongitude: 20.25},
+	}}
+
+	xmlBytes, err := original.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	assertTrue(t, "author", strings.Contains(string(xmlBytes), `<author><name>author</name><email id="first.last" domain="example.com"></email><link href="http://author"><text>home</text></link></author>`))
+	gpxDoc, err := ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, *gpxDoc.Author.Email, *original.Author.Email)
+	assertEquals(t, *gpxDoc.Author.Link, *original.Author.Link)
+	assertEquals(t, *gpxDoc.Copyright, *original.Copyright)
+	assertEquals(t, *gpxDoc.DeclaredBounds, *original.DeclaredBounds)
+
+	xmlBytes, err = original.ToXml(ToXmlParams{Version: "1.0"})
+	assertNil(t, err)
+	gpxDoc, err = ParseBytes(xmlBytes)
+	assertNil(t, err)
+	assertEquals(t, gpxDoc.Author.Name, "author")
+	assertEquals(t, gpxDoc.Author.Email.String(), "first.last@example.com")
+	assertTrue(t, "no copyright in 1.0", gpxDoc.Copyright == nil)
+	assertEquals(t, *gpxDoc.DeclaredBounds, *original.DeclaredBounds)
+}
+
+func TestParseEmail(t *testing.T) {
+	assertTrue(t, "empty", ParseEmail("") == nil)
+	assertEquals(t, *ParseEmail("a@b@example.com"), Email{ID: "a@b", Domain: "example.com"})
+	assertEquals(t, *ParseEmail("local"), Email{ID: "local"})
+	assertEquals(t, ParseEmail("local").String(), "local")
+}
+
+func TestWriteBounds(t *testing.T) {
+	g := &GPX{Metadata: Metadata{DeclaredBounds: &GpxBounds{MinLatitude: 50, MaxLatitude: 51, MinLongitude: 50, MaxLongitude: 51}}}
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 1, Longitude: 3}})
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 2, Longitude: -4}})
+
+	for _, version := range []string{"1.0", "1.1"} {
+		xmlBytes, err := g.ToXml(ToXmlParams{Version: version})
+		assertNil(t, err)
+		assertTrue(t, "declared bounds", strings.Contains(string(xmlBytes), `<bounds minlat="50" maxlat="51" minlon="50" maxlon="51"></bounds>`))
+
+		xmlBytes, err = g.ToXml(ToXmlParams{Version: version, WriteBounds: true})
+		assertNil(t, err)
+		assertTrue(t, "computed bounds", strings.Contains(string(xmlBytes), `<bounds minlat="1" maxlat="2" minlon="-4" maxlon="3"></bounds>`))
+	}
+
+	xmlBytes, err := new(GPX).ToXml(ToXmlParams{WriteBounds: true})
+	assertNil(t, err)
+	assertTrue(t, "no points, no bounds", !strings.Contains(string(xmlBytes), "bounds"))
+}
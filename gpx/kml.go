@@ -0,0 +1,555 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const kmlGxNamespace = "http://www.google.com/kml/ext/2.2"
+
+// KMLAltitudeMode is the interpretation of the elevations in KML
+type KMLAltitudeMode string
+
+const (
+	// KMLClampToGround ignores the elevations (the KML default)
+	KMLClampToGround KMLAltitudeMode = "clampToGround"
+	// KMLRelativeToGround uses the elevations as heights above the ground
+	KMLRelativeToGround KMLAltitudeMode = "relativeToGround"
+	// KMLAbsolute uses the elevations as heights above the sea level
+	KMLAbsolute KMLAltitudeMode = "absolute"
+)
+
+// KMLLineStyle is the style of a route or track line
+type KMLLineStyle struct {
+	// Color in the KML aabbggrr hex format (for example "ff0000ff" for
+	// opaque red), the default color if empty
+	Color string
+	// Width in pixels, the default width if zero
+	Width float64
+}
+
+func (s KMLLineStyle) isZero() bool {
+	return len(s.Color) == 0 && s.Width == 0
+}
+
+func (s KMLLineStyle) check() error {
+	if len(s.Color) == 0 {
+		return nil
+	}
+	if _, err := strconv.ParseUint(s.Color, 16, 32); err != nil || len(s.Color) != 8 {
+		return fmt.Errorf("invalid KML color %q, expected aabbggrr", s.Color)
+	}
+	return nil
+}
+
+// KMLOptions contains settings for GPX.ToKML and GPX.ToKMZ
+type KMLOptions struct {
+	// AltitudeMode of all geometries, not written (clampToGround) if empty
+	AltitudeMode KMLAltitudeMode
+	// LineStyle is used for routes and for tracks without a TrackStyles
+	// style
+	LineStyle KMLLineStyle
+	// TrackStyles are the styles of the tracks, TrackStyles[i] is used for
+	// the i-th track
+	TrackStyles []KMLLineStyle
+	// Indent writes indented XML
+	Indent bool
+}
+
+func (opts KMLOptions) trackStyle(trackNo int) KMLLineStyle {
+	if trackNo < len(opts.TrackStyles) && !opts.TrackStyles[trackNo].isZero() {
+		return opts.TrackStyles[trackNo]
+	}
+	return opts.LineStyle
+}
+
+type kmlDocument struct {
+	XMLName     xml.Name       `xml:"http://www.opengis.net/kml/2.2 kml"`
+	XmlnsGx     string         `xml:"xmlns:gx,attr"`
+	Name        string         `xml:"Document>name,omitempty"`
+	Description string         `xml:"Document>description,omitempty"`
+	Styles      []kmlStyle     `xml:"Document>Style"`
+	Placemarks  []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlStyle struct {
+	ID    string  `xml:"id,attr"`
+	Color string  `xml:"LineStyle>color,omitempty"`
+	Width float64 `xml:"LineStyle>width,omitempty"`
+}
+
+type kmlPlacemark struct {
+	Name        string            `xml:"name,omitempty"`
+	Description string            `xml:"description,omitempty"`
+	TimeStamp   *kmlTimeStamp     `xml:"TimeStamp"`
+	StyleURL    string            `xml:"styleUrl,omitempty"`
+	Point       *kmlPoint         `xml:"Point"`
+	LineString  *kmlLineString    `xml:"LineString"`
+	MultiTrack  *kmlMultiGeometry `xml:"gx:MultiTrack"`
+	Multi       *kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	AltitudeMode KMLAltitudeMode `xml:"altitudeMode,omitempty"`
+	Coordinates  string          `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	XMLName      xml.Name        `xml:"LineString"`
+	Tessellate   int             `xml:"tessellate,omitempty"`
+	AltitudeMode KMLAltitudeMode `xml:"altitudeMode,omitempty"`
+	Coordinates  string          `xml:"coordinates"`
+}
+
+type kmlTrack struct {
+	XMLName      xml.Name        `xml:"gx:Track"`
+	AltitudeMode KMLAltitudeMode `xml:"altitudeMode,omitempty"`
+	When         []string        `xml:"when"`
+	Coords       []string        `xml:"gx:coord"`
+}
+
+// kmlMultiGeometry contains kmlLineString and kmlTrack geometries
+type kmlMultiGeometry struct {
+	Interpolate *int          `xml:"gx:interpolate"`
+	Geometries  []interface{} `xml:",any"`
+}
+
+// ToKML converts the GPX to a KML document. Waypoints are Placemarks with a
+// Point, routes Placemarks with a LineString and tracks Placemarks with a
+// gx:MultiTrack (a gx:Track with the point times for each segment). Segments
+// with points without time are written as LineStrings (in a MultiGeometry
+// instead of the gx:MultiTrack).
+func (g *GPX) ToKML(opts KMLOptions) ([]byte, error) {
+	doc := kmlDocument{XmlnsGx: kmlGxNamespace, Name: g.Name, Description: g.Description}
+
+	if !opts.LineStyle.isZero() && len(g.Routes) > 0 {
+		if err := doc.addStyle("route", opts.LineStyle); err != nil {
+			return nil, err
+		}
+	}
+
+	for waypointNo := range g.Waypoints {
+		waypoint := &g.Waypoints[waypointNo]
+		placemark := kmlPlacemark{
+			Name:        waypoint.Name,
+			Description: kmlDescription(waypoint.Description, waypoint.Comment),
+			Point:       &kmlPoint{AltitudeMode: opts.AltitudeMode, Coordinates: kmlCoordinates(waypoint, ",")},
+		}
+		if !waypoint.Timestamp.IsZero() {
+			placemark.TimeStamp = &kmlTimeStamp{When: formatGPXTime(&waypoint.Timestamp, ToXmlParams{})}
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	for routeNo := range g.Routes {
+		route := &g.Routes[routeNo]
+		placemark := kmlPlacemark{
+			Name:        route.Name,
+			Description: kmlDescription(route.Description, route.Comment),
+			LineString:  opts.lineString(route.Points),
+		}
+		if !opts.LineStyle.isZero() {
+			placemark.StyleURL = "#route"
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		placemark := kmlPlacemark{
+			Name:        track.Name,
+			Description: kmlDescription(track.Description, track.Comment),
+		}
+		if style := opts.trackStyle(trackNo); !style.isZero() {
+			styleID := fmt.Sprintf("track%d", trackNo+1)
+			if err := doc.addStyle(styleID, style); err != nil {
+				return nil, err
+			}
+			placemark.StyleURL = "#" + styleID
+		}
+
+		geometries := make([]interface{}, len(track.Segments))
+		timed := true
+		for segmentNo := range track.Segments {
+			points := track.Segments[segmentNo].Points
+			if kmlTimed(points) {
+				geometries[segmentNo] = opts.track(points)
+			} else {
+				geometries[segmentNo] = opts.lineString(points)
+				timed = false
+			}
+		}
+		if timed {
+			interpolate := 0
+			placemark.MultiTrack = &kmlMultiGeometry{Interpolate: &interpolate, Geometries: geometries}
+		} else {
+			placemark.Multi = &kmlMultiGeometry{Geometries: geometries}
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buffer)
+	if opts.Indent {
+		enc.Indent("", "	")
+	}
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// ToKMZ returns a KMZ (zip) archive with the ToKML document
+func (g *GPX) ToKMZ(opts KMLOptions) ([]byte, error) {
+	kml, err := g.ToKML(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	w, err := archive.Create("doc.kml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(kml); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (doc *kmlDocument) addStyle(id string, style KMLLineStyle) error {
+	if err := style.check(); err != nil {
+		return err
+	}
+	doc.Styles = append(doc.Styles, kmlStyle{ID: id, Color: strings.ToLower(style.Color), Width: style.Width})
+	return nil
+}
+
+// kmlDescription joins the GPX description and comment
+func kmlDescription(description, comment string) string {
+	if len(description) == 0 {
+		return comment
+	}
+	if len(comment) == 0 {
+		return description
+	}
+	return description + "\n" + comment
+}
+
+// kmlTimed returns true if all points have a time (required for gx:Track)
+func kmlTimed(points []GPXPoint) bool {
+	if len(points) == 0 {
+		return false
+	}
+	for pointNo := range points {
+		if points[pointNo].Timestamp.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func (opts KMLOptions) lineString(points []GPXPoint) *kmlLineString {
+	coordinates := make([]string, len(points))
+	for pointNo := range points {
+		coordinates[pointNo] = kmlCoordinates(&points[pointNo], ",")
+	}
+	result := &kmlLineString{AltitudeMode: opts.AltitudeMode, Coordinates: strings.Join(coordinates, " ")}
+	if opts.AltitudeMode == "" || opts.AltitudeMode == KMLClampToGround {
+		result.Tessellate = 1
+	}
+	return result
+}
+
+func (opts KMLOptions) track(points []GPXPoint) *kmlTrack {
+	result := &kmlTrack{
+		AltitudeMode: opts.AltitudeMode,
+		When:         make([]string, len(points)),
+		Coords:       make([]string, len(points)),
+	}
+	for pointNo := range points {
+		result.When[pointNo] = formatGPXTime(&points[pointNo].Timestamp, ToXmlParams{})
+		result.Coords[pointNo] = kmlCoordinates(&points[pointNo], " ")
+	}
+	return result
+}
+
+// kmlCoordinates returns longitude, latitude and (if not null) elevation
+// separated with separator (a comma in coordinates, a space in gx:coord)
+func kmlCoordinates(point *GPXPoint, separator string) string {
+	result := strconv.FormatFloat(point.Longitude, 'f', -1, 64) + separator + strconv.FormatFloat(point.Latitude, 'f', -1, 64)
+	if point.Elevation.NotNull() {
+		result += separator + strconv.FormatFloat(point.Elevation.Value(), 'f', -1, 64)
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// KMLImportOptions contains settings for ParseKMLWithOptions
+type KMLImportOptions struct {
+	// LineStringsAsTracks converts Placemarks with a single LineString to
+	// single segment tracks instead of routes
+	LineStringsAsTracks bool
+}
+
+// ParseKML parses a KML or KMZ document, see ParseKMLWithOptions
+func ParseKML(r io.Reader) (*GPX, error) {
+	return ParseKMLWithOptions(r, KMLImportOptions{})
+}
+
+// ParseKMLWithOptions parses a KML document or a KMZ archive (with the first
+// .kml file in the archive). Placemarks with a Point are converted to
+// waypoints. Placemarks with gx:Track, gx:MultiTrack or more LineStrings (in a
+// MultiGeometry) are converted to tracks with a segment for each line, the
+// gx:Track point times are the <when> values. Placemarks with a single
+// LineString are converted to routes (or tracks, see
+// KMLImportOptions.LineStringsAsTracks). Other geometries are ignored.
+func ParseKMLWithOptions(r io.Reader, opts KMLImportOptions) (*GPX, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if data, err = kmzDocument(data); err != nil {
+			return nil, err
+		}
+	}
+
+	utf8Reader, err := newUTF8Reader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(utf8Reader)
+	d.CharsetReader = passCharsetReader
+
+	g := &GPX{Version: "1.1"}
+	var elements []string
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(elements) == 0 && t.Name.Local != "kml" {
+				return nil, fmt.Errorf("invalid root element %s, expected kml", t.Name.Local)
+			}
+			if t.Name.Local == "Placemark" {
+				var placemark ExtensionNode
+				if err := d.DecodeElement(&placemark, &t); err != nil {
+					return nil, err
+				}
+				if err := g.addKMLPlacemark(&placemark, opts); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			// Name and description of the main document:
+			if len(elements) == 2 && elements[1] == "Document" && (t.Name.Local == "name" || t.Name.Local == "description") {
+				var value string
+				if err := d.DecodeElement(&value, &t); err != nil {
+					return nil, err
+				}
+				if t.Name.Local == "name" {
+					g.Name = strings.TrimSpace(value)
+				} else {
+					g.Description = strings.TrimSpace(value)
+				}
+				continue
+			}
+			elements = append(elements, t.Name.Local)
+		case xml.EndElement:
+			elements = elements[:len(elements)-1]
+		}
+	}
+	return g, nil
+}
+
+// kmzDocument returns the main KML document of a KMZ archive
+func kmzDocument(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range archive.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".kml") {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, errors.New("no KML document in the KMZ archive")
+}
+
+func (g *GPX) addKMLPlacemark(placemark *ExtensionNode, opts KMLImportOptions) error {
+	name := kmlNodeText(placemark, "name")
+	description := kmlNodeText(placemark, "description")
+
+	var lines [][]GPXPoint
+	timed := false
+	err := walkKMLGeometries(placemark.Nodes, func(geometry *ExtensionNode) error {
+		switch geometry.XMLName.Local {
+		case "Point":
+			points, err := parseKMLCoordinates(kmlNodeText(geometry, "coordinates"))
+			if err != nil {
+				return err
+			}
+			if len(points) != 1 {
+				return fmt.Errorf("invalid KML point coordinates %q", kmlNodeText(geometry, "coordinates"))
+			}
+			waypoint := points[0]
+			waypoint.Name = name
+			waypoint.Description = description
+			if timeStamp := placemark.GetNode("", "TimeStamp"); timeStamp != nil {
+				waypoint.Timestamp = parseOptionalTime(kmlNodeText(timeStamp, "when"))
+			}
+			g.AppendWaypoint(&waypoint)
+		case "LineString":
+			points, err := parseKMLCoordinates(kmlNodeText(geometry, "coordinates"))
+			if err != nil {
+				return err
+			}
+			lines = append(lines, points)
+		case "Track":
+			points, err := parseKMLTrack(geometry)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, points)
+			timed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 1 && !timed && !opts.LineStringsAsTracks {
+		g.AppendRoute(&GPXRoute{Name: name, Description: description, Points: lines[0]})
+	} else if len(lines) > 0 {
+		track := GPXTrack{Name: name, Description: description}
+		for _, points := range lines {
+			track.Segments = append(track.Segments, GPXTrackSegment{Points: points})
+		}
+		g.AppendTrack(&track)
+	}
+	return nil
+}
+
+// walkKMLGeometries calls f for the Point, LineString and gx:Track geometries
+// in nodes, including the ones in MultiGeometry and gx:MultiTrack
+func walkKMLGeometries(nodes []ExtensionNode, f func(*ExtensionNode) error) error {
+	for nodeNo := range nodes {
+		node := &nodes[nodeNo]
+		switch node.XMLName.Local {
+		case "Point", "LineString", "Track":
+			if err := f(node); err != nil {
+				return err
+			}
+		case "MultiGeometry", "MultiTrack":
+			if err := walkKMLGeometries(node.Nodes, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func kmlNodeText(node *ExtensionNode, name string) string {
+	if child := node.GetNode("", name); child != nil {
+		return strings.TrimSpace(child.Data)
+	}
+	return ""
+}
+
+// parseKMLCoordinates parses a KML coordinates list ("lon,lat[,alt]" tuples
+// separated with whitespace)
+func parseKMLCoordinates(coordinates string) ([]GPXPoint, error) {
+	var result []GPXPoint
+	for _, tuple := range strings.Fields(coordinates) {
+		point, err := parseKMLPosition(strings.Split(tuple, ","))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, point)
+	}
+	return result, nil
+}
+
+// parseKMLTrack parses the points of a gx:Track, the <when> and <gx:coord>
+// elements are matched by their position
+func parseKMLTrack(track *ExtensionNode) ([]GPXPoint, error) {
+	var times []time.Time
+	var result []GPXPoint
+	for nodeNo := range track.Nodes {
+		node := &track.Nodes[nodeNo]
+		switch node.XMLName.Local {
+		case "when":
+			times = append(times, parseOptionalTime(node.Data))
+		case "coord":
+			point, err := parseKMLPosition(strings.Fields(node.Data))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, point)
+		}
+	}
+	if len(times) != len(result) {
+		return nil, fmt.Errorf("invalid gx:Track with %d when and %d gx:coord elements", len(times), len(result))
+	}
+	for pointNo := range result {
+		result[pointNo].Timestamp = times[pointNo]
+	}
+	return result, nil
+}
+
+// parseKMLPosition parses longitude, latitude and optional altitude
+func parseKMLPosition(values []string) (GPXPoint, error) {
+	if len(values) < 2 || len(values) > 3 {
+		return GPXPoint{}, fmt.Errorf("invalid KML position %q", strings.Join(values, ","))
+	}
+	var numbers []float64
+	for _, value := range values {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return GPXPoint{}, fmt.Errorf("invalid KML position %q", strings.Join(values, ","))
+		}
+		numbers = append(numbers, number)
+	}
+	point := GPXPoint{Point: Point{Latitude: numbers[1], Longitude: numbers[0]}}
+	if len(numbers) == 3 {
+		point.Elevation.SetValue(numbers[2])
+	}
+	return point, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func kmlTestGPX() *GPX {
+	g := geoJSONTestGPX()
+	g.Name = "Trip & co"
+	g.Waypoints[0].Comment = "comment"
+	g.Tracks[0].Segments[1].Points[0].Timestamp = time.Date(2014, 1, 1, 12, 0, 10, 0, time.UTC)
+	return g
+}
+
+func TestToKML(t *testing.T) {
+	bytes, err := kmlTestGPX().ToKML(KMLOptions{})
+	assertNil(t, err)
+	assertEquals(t, string(bytes), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2"><Document><name>Trip &amp; co</name>`+
+		`<Placemark><name>wpt</name><description>comment</description><TimeStamp><when>2014-01-01T12:00:00Z</when></TimeStamp>`+
+		`<Point><coordinates>13.5,46.123456789,1000</coordinates></Point></Placemark>`+
+		`<Placemark><name>route</name><description>route desc</description>`+
+		`<LineString><tessellate>1</tessellate><coordinates>13,46 -13.25,46.5</coordinates></LineString></Placemark>`+
+		`<Placemark><name>track</name><MultiGeometry>`+
+		`<LineString><tessellate>1</tessellate><coordinates>2,1,10 4,3</coordinates></LineString>`+
+		`<gx:Track><when>2014-01-01T12:00:10Z</when><gx:coord>6 -5</gx:coord></gx:Track>`+
+		`</MultiGeometry></Placemark></Document></kml>`)
+}
+
+func TestToKMLTimedTrack(t *testing.T) {
+	g := kmlTestGPX()
+	g.Waypoints, g.Routes = nil, nil
+	g.Tracks[0].Segments[0].Points[1].Timestamp = time.Date(2014, 1, 1, 12, 0, 1, 0, time.UTC)
+
+	bytes, err := g.ToKML(KMLOptions{
+		AltitudeMode: KMLAbsolute,
+		LineStyle:    KMLLineStyle{Width: 2},
+		TrackStyles:  []KMLLineStyle{{Color: "FF0000FF", Width: 4}},
+	})
+	assertNil(t, err)
+	kml := string(bytes)
+	assertTrue(t, "track style", strings.Contains(kml, `<Style id="track1"><LineStyle><color>ff0000ff</color><width>4</width></LineStyle></Style>`))
+	assertTrue(t, "no route style without routes", !strings.Contains(kml, `<Style id="route">`))
+	assertTrue(t, "multi track", strings.Contains(kml, `<styleUrl>#track1</styleUrl><gx:MultiTrack><gx:interpolate>0</gx:interpolate>`+
+		`<gx:Track><altitudeMode>absolute</altitudeMode><when>2014-01-01T12:00:00.5Z</when><when>2014-01-01T12:00:01Z</when>`+
+		`<gx:coord>2 1 10</gx:coord><gx:coord>4 3</gx:coord></gx:Track>`+
+		`<gx:Track><altitudeMode>absolute</altitudeMode><when>2014-01-01T12:00:10Z</when><gx:coord>6 -5</gx:coord></gx:Track></gx:MultiTrack>`))
+
+	g.AppendTrack(&GPXTrack{})
+	bytes, err = g.ToKML(KMLOptions{LineStyle: KMLLineStyle{Width: 2}, TrackStyles: []KMLLineStyle{{Color: "ff0000ff"}}})
+	assertNil(t, err)
+	assertTrue(t, "default style", strings.Contains(string(bytes), `<Style id="track2"><LineStyle><width>2</width></LineStyle></Style>`))
+
+	_, err = g.ToKML(KMLOptions{TrackStyles: []KMLLineStyle{{Color: "#ff0000"}}})
+	assertTrue(t, "invalid color", err != nil)
+}
+
+func TestToKMZ(t *testing.T) {
+	kml, err := kmlTestGPX().ToKML(KMLOptions{Indent: true})
+	assertNil(t, err)
+	kmz, err := kmlTestGPX().ToKMZ(KMLOptions{Indent: true})
+	assertNil(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(kmz), int64(len(kmz)))
+	assertNil(t, err)
+	assertEquals(t, len(archive.File), 1)
+	assertEquals(t, archive.File[0].Name, "doc.kml")
+	f, err := archive.File[0].Open()
+	assertNil(t, err)
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	assertNil(t, err)
+	assertEquals(t, string(content), string(kml))
+}
+
+func TestParseKMLRoundTrip(t *testing.T) {
+	g := kmlTestGPX()
+	g.Tracks[0].Segments[0].Points[1].Timestamp = time.Date(2014, 1, 1, 12, 0, 1, 0, time.UTC)
+	kml, err := g.ToKML(KMLOptions{Indent: true, AltitudeMode: KMLAbsolute, LineStyle: KMLLineStyle{Width: 2}})
+	assertNil(t, err)
+
+	parsed, err := ParseKML(bytes.NewReader(kml))
+	assertNil(t, err)
+	assertEquals(t, parsed.Name, "Trip & co")
+	assertEquals(t, len(parsed.Waypoints), 1)
+	assertEquals(t, parsed.Waypoints[0].Name, "wpt")
+	assertEquals(t, parsed.Waypoints[0].Description, "comment")
+	assertEquals(t, parsed.Waypoints[0].Latitude, 46.123456789)
+	assertEquals(t, parsed.Waypoints[0].Elevation.Value(), 1000.0)
+	assertTrue(t, "waypoint time", parsed.Waypoints[0].Timestamp.Equal(g.Waypoints[0].Timestamp))
+
+	assertEquals(t, len(parsed.Routes), 1)
+	assertEquals(t, parsed.Routes[0].Name, "route")
+	assertEquals(t, len(parsed.Routes[0].Points), 2)
+	assertEquals(t, parsed.Routes[0].Points[1].Longitude, -13.25)
+
+	assertEquals(t, len(parsed.Tracks), 1)
+	assertEquals(t, len(parsed.Tracks[0].Segments), 2)
+	for segmentNo, segment := range g.Tracks[0].Segments {
+		parsedSegment := parsed.Tracks[0].Segments[segmentNo]
+		assertEquals(t, len(parsedSegment.Points), len(segment.Points))
+		for pointNo, point := range segment.Points {
+			parsedPoint := parsedSegment.Points[pointNo]
+			assertTrue(t, "same point", sameGPXPoint(&point, &parsedPoint))
+		}
+	}
+}
+
+func TestParseKMZ(t *testing.T) {
+	kmz, err := kmlTestGPX().ToKMZ(KMLOptions{})
+	assertNil(t, err)
+	parsed, err := ParseKML(bytes.NewReader(kmz))
+	assertNil(t, err)
+	assertEquals(t, parsed.Name, "Trip & co")
+	assertEquals(t, len(parsed.Waypoints), 1)
+	assertEquals(t, len(parsed.Tracks), 1)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	_, err = archive.Create("images/photo.jpg")
+	assertNil(t, err)
+	assertNil(t, archive.Close())
+	_, err = ParseKML(&buffer)
+	assertTrue(t, "kmz without kml", err != nil)
+}
+
+func TestParseKMLGoogleEarth(t *testing.T) {
+	kml := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+<Document>
+	<name> Archive </name>
+	<Folder>
+		<name>Folder name</name>
+		<Placemark>
+			<name>Planned</name>
+			<LineString><coordinates>
+				13.0,46.0,1000 13.001,46.001,1010
+				13.002,46.002,1005
+			</coordinates></LineString>
+		</Placemark>
+		<Placemark>
+			<name>Recorded</name>
+			<gx:Track>
+				<when>2014-01-01T12:00:00Z</when>
+				<when>2014-01-01T12:01:00Z</when>
+				<when>2014-01-01T12:02:00Z</when>
+				<gx:coord>13.0 46.0 1000</gx:coord>
+				<gx:coord>13.001 46.001 1010</gx:coord>
+				<gx:coord>13.002 46.002 1005</gx:coord>
+			</gx:Track>
+		</Placemark>
+		<Placemark><Polygon><outerBoundaryIs><LinearRing><coordinates>0,0 1,0 1,1 0,0</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+	</Folder>
+</Document>
+</kml>`
+	g, err := ParseKML(strings.NewReader(kml))
+	assertNil(t, err)
+	assertEquals(t, g.Name, "Archive")
+	assertEquals(t, len(g.Waypoints), 0)
+	assertEquals(t, len(g.Routes), 1)
+	assertEquals(t, g.Routes[0].Name, "Planned")
+	assertEquals(t, len(g.Routes[0].Points), 3)
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, g.Tracks[0].Name, "Recorded")
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 3)
+
+	movingData := g.MovingData()
+	assertEquals(t, movingData.MovingTime, 120.0)
+	uphillDownhill := g.UphillDownhill()
+	assertTrue(t, "uphill", uphillDownhill.Uphill > 0)
+
+	g, err = ParseKMLWithOptions(strings.NewReader(kml), KMLImportOptions{LineStringsAsTracks: true})
+	assertNil(t, err)
+	assertEquals(t, len(g.Routes), 0)
+	assertEquals(t, len(g.Tracks), 2)
+	assertEquals(t, g.Tracks[0].Name, "Planned")
+	assertTrue(t, "linestring without times", g.Tracks[0].Segments[0].Points[0].Timestamp.IsZero())
+}
+
+func TestParseKMLErrors(t *testing.T) {
+	for _, kml := range []string{
+		`<gpx></gpx>`,
+		`<kml><Placemark><Point><coordinates>13</coordinates></Point></Placemark></kml>`,
+		`<kml><Placemark><LineString><coordinates>13,46 a,b</coordinates></LineString></Placemark></kml>`,
+		`<kml xmlns:gx="http://www.google.com/kml/ext/2.2"><Placemark><gx:Track><when>2014-01-01T12:00:00Z</when></gx:Track></Placemark></kml>`,
+		`<kml><Placemark>`,
+	} {
+		_, err := ParseKML(strings.NewReader(kml))
+		assertTrue(t, "error expected for "+kml, err != nil)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Lint defaults
+const (
+	defaultLintMaxSpeed          = 100.0
+	defaultLintMaxElevationSpike = 50.0
+	defaultLintMaxTimeGap        = time.Hour
+)
+
+// Severity of a lint Issue
+type Severity int
+
+const (
+	// SeverityInfo is something unusual, but possibly correct (for example a
+	// pause in the recording)
+	SeverityInfo Severity = iota
+	// SeverityWarning is a probable recording defect
+	SeverityWarning
+	// SeverityError is certainly invalid data
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// LintCheck is the kind of defect found by Lint
+type LintCheck int
+
+const (
+	// LintEmpty is a segment without points or a track without segments
+	LintEmpty LintCheck = iota
+	// LintZeroCoordinates is a point at latitude and longitude 0 (a device
+	// without a fix)
+	LintZeroCoordinates
+	// LintDuplicatePoint is a point equal to the previous one (position,
+	// elevation and time)
+	LintDuplicatePoint
+	// LintNonMonotonicTime is a point with a time before the previous point
+	LintNonMonotonicTime
+	// LintImpossibleSpeed is a point too far from the previous one for the
+	// time between them
+	LintImpossibleSpeed
+	// LintElevationSpike is a point much higher or lower than both neighbours
+	LintElevationSpike
+	// LintTimeGap is a long time without points
+	LintTimeGap
+)
+
+func (c LintCheck) String() string {
+	switch c {
+	case LintEmpty:
+		return "empty"
+	case LintZeroCoordinates:
+		return "zero coordinates"
+	case LintDuplicatePoint:
+		return "duplicate point"
+	case LintNonMonotonicTime:
+		return "non monotonic time"
+	case LintImpossibleSpeed:
+		return "impossible speed"
+	case LintElevationSpike:
+		return "elevation spike"
+	case LintTimeGap:
+		return "time gap"
+	}
+	return fmt.Sprintf("LintCheck(%d)", int(c))
+}
+
+// LintOptions contains the thresholds of Lint, zero values use the defaults
+// and negative values disable the check
+type LintOptions struct {
+	// MaxSpeed in m/s (2D) from the previous point, 100 by default
+	MaxSpeed float64
+	// MaxElevationSpike is the elevation difference in meters from both
+	// neighbours, 50 by default
+	MaxElevationSpike float64
+	// MaxTimeGap between consecutive points, one hour by default
+	MaxTimeGap time.Duration
+}
+
+func (o LintOptions) withDefaults() LintOptions {
+	if o.MaxSpeed == 0 {
+		o.MaxSpeed = defaultLintMaxSpeed
+	}
+	if o.MaxElevationSpike == 0 {
+		o.MaxElevationSpike = defaultLintMaxElevationSpike
+	}
+	if o.MaxTimeGap == 0 {
+		o.MaxTimeGap = defaultLintMaxTimeGap
+	}
+	return o
+}
+
+// Issue is a defect found by Lint. For empty tracks SegmentNo and PointNo
+// are -1, for empty segments PointNo is -1.
+type Issue struct {
+	TrackPosition
+	Check    LintCheck
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("track %d, segment %d, point %d: %s: %s: %s", i.TrackNo, i.SegmentNo, i.PointNo, i.Severity, i.Check, i.Message)
+}
+
+// Lint finds common recording defects in the tracks of g: empty segments and
+// tracks, (0,0) points, duplicate consecutive points, times going back,
+// impossible speeds, elevation spikes and long time gaps. Waypoints and
+// routes are not checked. Points at (0,0) are ignored by the other checks,
+// points without time by the time and speed checks.
+func Lint(g *GPX, options LintOptions) []Issue {
+	options = options.withDefaults()
+	var result []Issue
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		if len(track.Segments) == 0 {
+			result = append(result, Issue{
+				TrackPosition: TrackPosition{TrackNo: trackNo, SegmentNo: -1, PointNo: -1},
+				Check:         LintEmpty,
+				Severity:      SeverityWarning,
+				Message:       "track without segments",
+			})
+		}
+		for segmentNo := range track.Segments {
+			for _, issue := range lintSegment(&track.Segments[segmentNo], options) {
+				issue.TrackNo = trackNo
+				issue.SegmentNo = segmentNo
+				result = append(result, issue)
+			}
+		}
+	}
+	return result
+}
+
+func lintSegment(seg *GPXTrackSegment, options LintOptions) []Issue {
+	if len(seg.Points) == 0 {
+		return []Issue{{
+			TrackPosition: TrackPosition{PointNo: -1},
+			Check:         LintEmpty,
+			Severity:      SeverityWarning,
+			Message:       "segment without points",
+		}}
+	}
+
+	var result []Issue
+	add := func(pointNo int, check LintCheck, severity Severity, message string) {
+		result = append(result, Issue{
+			TrackPosition: TrackPosition{Point: seg.Points[pointNo].Point, PointNo: pointNo},
+			Check:         check,
+			Severity:      severity,
+			Message:       message,
+		})
+	}
+
+	// Previous point with coordinates, and previous point with coordinates and time:
+	previous, previousTimed := -1, -1
+	for pointNo := range seg.Points {
+		point := &seg.Points[pointNo]
+		if point.Latitude == 0 && point.Longitude == 0 {
+			add(pointNo, LintZeroCoordinates, SeverityError, "point at (0, 0)")
+			continue
+		}
+
+		if previous >= 0 && sameGPXPoint(point, &seg.Points[previous]) {
+			add(pointNo, LintDuplicatePoint, SeverityWarning, fmt.Sprintf("duplicate of point %d", previous))
+			continue
+		}
+		previous = pointNo
+
+		if point.Timestamp.IsZero() {
+			continue
+		}
+		if previousTimed >= 0 {
+			previousPoint := &seg.Points[previousTimed]
+			if point.Timestamp.Before(previousPoint.Timestamp) {
+				add(pointNo, LintNonMonotonicTime, SeverityError, fmt.Sprintf("time %s before the time of point %d (%s)", point.Timestamp.Format(time.RFC3339), previousTimed, previousPoint.Timestamp.Format(time.RFC3339)))
+				continue
+			}
+			gap := point.Timestamp.Sub(previousPoint.Timestamp)
+			if options.MaxTimeGap > 0 && gap > options.MaxTimeGap {
+				add(pointNo, LintTimeGap, SeverityInfo, fmt.Sprintf("%s without points", gap))
+			}
+			if options.MaxSpeed > 0 && gap > 0 {
+				if speed := point.SpeedBetween(previousPoint, false); speed > options.MaxSpeed {
+					add(pointNo, LintImpossibleSpeed, SeverityError, fmt.Sprintf("speed %.1fm/s from point %d", speed, previousTimed))
+				}
+			}
+		}
+		previousTimed = pointNo
+	}
+
+	if options.MaxElevationSpike > 0 {
+		for _, pointNo := range elevationSpikes(seg, options.MaxElevationSpike) {
+			add(pointNo, LintElevationSpike, SeverityWarning, fmt.Sprintf("elevation %.1fm", seg.Points[pointNo].Elevation.Value()))
+		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].PointNo < result[j].PointNo })
+	}
+
+	return result
+}
+
+func sameGPXPoint(pt1, pt2 *GPXPoint) bool {
+	return pt1.Latitude == pt2.Latitude && pt1.Longitude == pt2.Longitude &&
+		pt1.Elevation.Null() == pt2.Elevation.Null() && pt1.Elevation.Value() == pt2.Elevation.Value() &&
+		pt1.Timestamp.Equal(pt2.Timestamp)
+}
+
+// elevationSpikes returns the points with an elevation more than maxSpike
+// above or below both their neighbours (points without elevation or at
+// (0,0) are ignored)
+func elevationSpikes(seg *GPXTrackSegment, maxSpike float64) []int {
+	var withElevation []int
+	for pointNo, point := range seg.Points {
+		if point.Elevation.NotNull() && (point.Latitude != 0 || point.Longitude != 0) {
+			withElevation = append(withElevation, pointNo)
+		}
+	}
+
+	var result []int
+	for i := 1; i+1 < len(withElevation); i++ {
+		elevation := seg.Points[withElevation[i]].Elevation.Value()
+		before := elevation - seg.Points[withElevation[i-1]].Elevation.Value()
+		after := elevation - seg.Points[withElevation[i+1]].Elevation.Value()
+		if math.Abs(before) > maxSpike && math.Abs(after) > maxSpike && (before > 0) == (after > 0) {
+			result = append(result, withElevation[i])
+		}
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"testing"
+	"time"
+)
+
+func lintTestPoint(lat, lon, ele float64, seconds int) GPXPoint {
+	point := GPXPoint{Point: Point{Latitude: lat, Longitude: lon}}
+	point.Elevation.SetValue(ele)
+	if seconds >= 0 {
+		point.Timestamp = time.Date(2014, 1, 1, 12, 0, seconds, 0, time.UTC)
+	}
+	return point
+}
+
+func TestLintTestFile(t *testing.T) {
+	g, err := ParseFile("../test_files/file.gpx")
+	assertNil(t, err)
+	assertStringers(t, Lint(g, LintOptions{}))
+}
+
+func TestLint(t *testing.T) {
+	g := new(GPX)
+	g.Tracks = []GPXTrack{
+		{Segments: []GPXTrackSegment{{Points: []GPXPoint{
+			lintTestPoint(46, 13, 100, 0),
+			lintTestPoint(46.0001, 13, 101, 10),
+			lintTestPoint(46.0001, 13, 101, 10),
+			lintTestPoint(0, 0, 0, 20),
+			lintTestPoint(46.0002, 13, 300, 30),
+			lintTestPoint(46.0003, 13, 102, 25),
+			lintTestPoint(46.0004, 13, 103, 40),
+			lintTestPoint(46.1, 13, 104, 41),
+			lintTestPoint(46.1001, 13, 104, -1),
+		}}, {}}},
+		{},
+	}
+	g.Tracks[0].Segments[0].Points[8].Timestamp = g.Tracks[0].Segments[0].Points[7].Timestamp.Add(2 * time.Hour)
+
+	assertStringers(t, Lint(g, LintOptions{}),
+		"track 0, segment 0, point 2: warning: duplicate point: duplicate of point 1",
+		"track 0, segment 0, point 3: error: zero coordinates: point at (0, 0)",
+		"track 0, segment 0, point 4: warning: elevation spike: elevation 300.0m",
+		"track 0, segment 0, point 5: error: non monotonic time: time 2014-01-01T12:00:25Z before the time of point 4 (2014-01-01T12:00:30Z)",
+		"track 0, segment 0, point 7: error: impossible speed: speed 11067.6m/s from point 6",
+		"track 0, segment 0, point 8: info: time gap: 2h0m0s without points",
+		"track 0, segment 1, point -1: warning: empty: segment without points",
+		"track 1, segment -1, point -1: warning: empty: track without segments",
+	)
+
+	assertStringers(t, Lint(g, LintOptions{MaxSpeed: 20000, MaxElevationSpike: -1, MaxTimeGap: -1}),
+		"track 0, segment 0, point 2: warning: duplicate point: duplicate of point 1",
+		"track 0, segment 0, point 3: error: zero coordinates: point at (0, 0)",
+		"track 0, segment 0, point 5: error: non monotonic time: time 2014-01-01T12:00:25Z before the time of point 4 (2014-01-01T12:00:30Z)",
+		"track 0, segment 1, point -1: warning: empty: segment without points",
+		"track 1, segment -1, point -1: warning: empty: track without segments",
+	)
+
+	issues := Lint(g, LintOptions{})
+	assertEquals(t, issues[1].Latitude, 0.0)
+	assertEquals(t, issues[4].Latitude, 46.1)
+}
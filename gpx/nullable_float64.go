@@ -61,17 +61,22 @@ func (n *NullableFloat64) UnmarshalXML(d *xml.Decoder, start xml.StartElement) e
 		n.SetNull()
 		return nil
 	}
+	if _, ok := t.(xml.EndElement); ok {
+		// Empty element, there is nothing left to skip
+		n.SetNull()
+		return nil
+	}
 	if charData, ok := t.(xml.CharData); ok {
 		strData := strings.Trim(string(charData), " ")
 		value, err := strconv.ParseFloat(strData, 64)
 		if err != nil {
+			// Invalid values are ignored, the rest of the element is skipped
 			n.SetNull()
-			return nil
+			return d.Skip()
 		}
 		n.SetValue(value)
 	}
-	d.Skip()
-	return nil
+	return d.Skip()
 }
 
 //UnmarshalXMLAttr implements xml attribute unmarshalling
@@ -115,3 +120,11 @@ func (n NullableFloat64) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
 			Value: fmt.Sprintf("%g", n.Value())},
 		nil
 }
+
+// formatNullableFloat64 formats the value without exponent, empty if null
+func formatNullableFloat64(n NullableFloat64) string {
+	if n.Null() {
+		return ""
+	}
+	return strconv.FormatFloat(n.Value(), 'f', -1, 64)
+}
@@ -61,17 +61,22 @@ func (n *NullableInt) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 		n.SetNull()
 		return nil
 	}
+	if _, ok := t.(xml.EndElement); ok {
+		// Empty element, there is nothing left to skip
+		n.SetNull()
+		return nil
+	}
 	if charData, ok := t.(xml.CharData); ok {
 		strData := strings.Trim(string(charData), " ")
 		value, err := strconv.ParseFloat(strData, 64)
 		if err != nil {
+			// Invalid values are ignored, the rest of the element is skipped
 			n.SetNull()
-			return nil
+			return d.Skip()
 		}
 		n.SetValue(int(value))
 	}
-	d.Skip()
-	return nil
+	return d.Skip()
 }
 
 //UnmarshalXMLAttr implements xml attribute unmarshalling
@@ -111,3 +116,11 @@ func (n NullableInt) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
 			Value: fmt.Sprintf("%d", n.Value())},
 		nil
 }
+
+// formatNullableInt formats the value, empty if null
+func formatNullableInt(n NullableInt) string {
+	if n.Null() {
+		return ""
+	}
+	return strconv.Itoa(n.Value())
+}
@@ -0,0 +1,375 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// OutOfOrderRepair is how Repair handles points with a time before the
+// previous point
+type OutOfOrderRepair int
+
+const (
+	// OutOfOrderKeep leaves the points as they are
+	OutOfOrderKeep OutOfOrderRepair = iota
+	// OutOfOrderSort sorts the points with times by time, points without time
+	// keep their position
+	OutOfOrderSort
+	// OutOfOrderSplit starts a new segment at every point with a time before
+	// the previous one
+	OutOfOrderSplit
+)
+
+// RepairOptions selects the Repair steps, the zero value changes nothing.
+// Steps are applied in the order of the fields.
+type RepairOptions struct {
+	// RemoveZeroCoordinates removes the points at (0,0)
+	RemoveZeroCoordinates bool
+	// RemoveDuplicates removes the points equal (position, elevation and
+	// time) to the previous point
+	RemoveDuplicates bool
+	OutOfOrder       OutOfOrderRepair
+	// MaxTimeGap splits segments where the time between consecutive points
+	// is longer (0 for no splitting)
+	MaxTimeGap time.Duration
+	// MaxDistanceGap splits segments where the distance (2D, meters) between
+	// consecutive points is longer (0 for no splitting)
+	MaxDistanceGap float64
+	// InterpolateTimes adds the missing times between points with times
+	// (see GPXTrackSegment.AddMissingTime)
+	InterpolateTimes bool
+	// InterpolateElevations adds the missing elevations between points with
+	// elevations, proportionally to the distance
+	InterpolateElevations bool
+	// RemoveEmpty removes the segments without points and the tracks without
+	// segments (see GPX.RemoveEmpty)
+	RemoveEmpty bool
+}
+
+// RepairAction is the kind of change made by Repair
+type RepairAction int
+
+const (
+	// RepairRemovedZeroCoordinates is a removed (0,0) point
+	RepairRemovedZeroCoordinates RepairAction = iota
+	// RepairRemovedDuplicate is a removed duplicate point
+	RepairRemovedDuplicate
+	// RepairSortedPoints is a segment with points sorted by time
+	RepairSortedPoints
+	// RepairSplitSegment is a segment split, the position is the first point
+	// of the new segment. All the new segments have (deep) copies of the
+	// extensions of the split segment.
+	RepairSplitSegment
+	// RepairInterpolatedTime is a point with an interpolated time
+	RepairInterpolatedTime
+	// RepairInterpolatedElevation is a point with an interpolated elevation
+	RepairInterpolatedElevation
+	// RepairRemovedEmpty is a removed segment or track
+	RepairRemovedEmpty
+)
+
+func (a RepairAction) String() string {
+	switch a {
+	case RepairRemovedZeroCoordinates:
+		return "removed zero coordinates"
+	case RepairRemovedDuplicate:
+		return "removed duplicate"
+	case RepairSortedPoints:
+		return "sorted points"
+	case RepairSplitSegment:
+		return "split segment"
+	case RepairInterpolatedTime:
+		return "interpolated time"
+	case RepairInterpolatedElevation:
+		return "interpolated elevation"
+	case RepairRemovedEmpty:
+		return "removed empty"
+	}
+	return fmt.Sprintf("RepairAction(%d)", int(a))
+}
+
+// RepairChange is a change made by Repair. The position is the one in the
+// GPX as it was before the step which made the change (but after the
+// previous steps), -1 for the segment or point of changes to whole tracks or
+// segments.
+type RepairChange struct {
+	TrackPosition
+	Action  RepairAction
+	Message string
+}
+
+func (c RepairChange) String() string {
+	return fmt.Sprintf("track %d, segment %d, point %d: %s: %s", c.TrackNo, c.SegmentNo, c.PointNo, c.Action, c.Message)
+}
+
+// RepairReport lists the changes made by Repair, in the order they were made
+type RepairReport struct {
+	Changes []RepairChange
+}
+
+// Count returns the number of changes of the given action
+func (r *RepairReport) Count(action RepairAction) int {
+	result := 0
+	for _, change := range r.Changes {
+		if change.Action == action {
+			result++
+		}
+	}
+	return result
+}
+
+func (r *RepairReport) add(action RepairAction, trackNo, segmentNo, pointNo int, point Point, message string) {
+	r.Changes = append(r.Changes, RepairChange{
+		TrackPosition: TrackPosition{Point: point, TrackNo: trackNo, SegmentNo: segmentNo, PointNo: pointNo},
+		Action:        action,
+		Message:       message,
+	})
+}
+
+// Repair fixes the common recording defects found by Lint in the tracks of g,
+// the steps are selected with options. The result is deterministic, the
+// report lists every change.
+func Repair(g *GPX, options RepairOptions) RepairReport {
+	var report RepairReport
+
+	if options.RemoveZeroCoordinates {
+		g.repairPoints(func(seg *GPXTrackSegment, trackNo, segmentNo int) {
+			seg.removePoints(func(pointNo int) bool {
+				point := &seg.Points[pointNo]
+				if point.Latitude != 0 || point.Longitude != 0 {
+					return false
+				}
+				report.add(RepairRemovedZeroCoordinates, trackNo, segmentNo, pointNo, point.Point, "point at (0, 0)")
+				return true
+			})
+		})
+	}
+	if options.RemoveDuplicates {
+		g.repairPoints(func(seg *GPXTrackSegment, trackNo, segmentNo int) {
+			seg.removePoints(func(pointNo int) bool {
+				if pointNo == 0 || !sameGPXPoint(&seg.Points[pointNo], &seg.Points[pointNo-1]) {
+					return false
+				}
+				report.add(RepairRemovedDuplicate, trackNo, segmentNo, pointNo, seg.Points[pointNo].Point, fmt.Sprintf("duplicate of point %d", pointNo-1))
+				return true
+			})
+		})
+	}
+
+	switch options.OutOfOrder {
+	case OutOfOrderSort:
+		g.repairPoints(func(seg *GPXTrackSegment, trackNo, segmentNo int) {
+			if moved := seg.sortByTime(); moved > 0 {
+				report.add(RepairSortedPoints, trackNo, segmentNo, -1, Point{}, fmt.Sprintf("%d points moved", moved))
+			}
+		})
+	case OutOfOrderSplit:
+		g.splitSegments(&report, func(seg *GPXTrackSegment, previous, previousTimed, pointNo int) string {
+			point := &seg.Points[pointNo]
+			if previousTimed >= 0 && !point.Timestamp.IsZero() && point.Timestamp.Before(seg.Points[previousTimed].Timestamp) {
+				return "time before the previous point"
+			}
+			return ""
+		})
+	}
+
+	if options.MaxTimeGap > 0 || options.MaxDistanceGap > 0 {
+		g.splitSegments(&report, func(seg *GPXTrackSegment, previous, previousTimed, pointNo int) string {
+			point := &seg.Points[pointNo]
+			if options.MaxTimeGap > 0 && previousTimed >= 0 && !point.Timestamp.IsZero() {
+				if gap := point.Timestamp.Sub(seg.Points[previousTimed].Timestamp); gap > options.MaxTimeGap {
+					return fmt.Sprintf("%s without points", gap)
+				}
+			}
+			if distance := point.Distance2D(&seg.Points[previous]); options.MaxDistanceGap > 0 && distance > options.MaxDistanceGap {
+				return fmt.Sprintf("%.1fm from the previous point", distance)
+			}
+			return ""
+		})
+	}
+
+	if options.InterpolateTimes {
+		g.repairPoints(func(seg *GPXTrackSegment, trackNo, segmentNo int) {
+			missing := make([]bool, len(seg.Points))
+			for pointNo, point := range seg.Points {
+				missing[pointNo] = point.Timestamp.Year() <= 1
+			}
+			seg.AddMissingTime()
+			for pointNo, point := range seg.Points {
+				if missing[pointNo] && point.Timestamp.Year() > 1 {
+					report.add(RepairInterpolatedTime, trackNo, segmentNo, pointNo, point.Point, point.Timestamp.Format(time.RFC3339Nano))
+				}
+			}
+		})
+	}
+	if options.InterpolateElevations {
+		g.repairPoints(func(seg *GPXTrackSegment, trackNo, segmentNo int) {
+			for _, pointNo := range seg.interpolateElevations() {
+				point := &seg.Points[pointNo]
+				report.add(RepairInterpolatedElevation, trackNo, segmentNo, pointNo, point.Point, fmt.Sprintf("%.1fm", point.Elevation.Value()))
+			}
+		})
+	}
+
+	if options.RemoveEmpty {
+		for trackNo, track := range g.Tracks {
+			if len(track.Segments) == 0 {
+				report.add(RepairRemovedEmpty, trackNo, -1, -1, Point{}, "track without segments")
+				continue
+			}
+			segments := 0
+			for segmentNo, segment := range track.Segments {
+				if len(segment.Points) == 0 {
+					report.add(RepairRemovedEmpty, trackNo, segmentNo, -1, Point{}, "segment without points")
+				} else {
+					segments++
+				}
+			}
+			if segments == 0 {
+				report.add(RepairRemovedEmpty, trackNo, -1, -1, Point{}, "track without points")
+			}
+		}
+		g.RemoveEmpty()
+	}
+
+	return report
+}
+
+func (g *GPX) repairPoints(repair func(seg *GPXTrackSegment, trackNo, segmentNo int)) {
+	for trackNo := range g.Tracks {
+		for segmentNo := range g.Tracks[trackNo].Segments {
+			repair(&g.Tracks[trackNo].Segments[segmentNo], trackNo, segmentNo)
+		}
+	}
+}
+
+// splitSegments starts a new segment before every point for which split
+// returns a reason. Split is called for all points except the first one of
+// each segment, previousTimed is the previous point with time (-1 if none).
+// The segment extensions are copied to every new segment.
+func (g *GPX) splitSegments(report *RepairReport, split func(seg *GPXTrackSegment, previous, previousTimed, pointNo int) string) {
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		var segments []GPXTrackSegment
+		for segmentNo := range track.Segments {
+			seg := &track.Segments[segmentNo]
+			start, previousTimed := 0, -1
+			for pointNo := range seg.Points {
+				if pointNo > 0 {
+					if reason := split(seg, pointNo-1, previousTimed, pointNo); len(reason) > 0 {
+						report.add(RepairSplitSegment, trackNo, segmentNo, pointNo, seg.Points[pointNo].Point, reason)
+						segments = append(segments, GPXTrackSegment{Points: seg.Points[start:pointNo:pointNo], Extensions: copyExtension(seg.Extensions)})
+						start = pointNo
+					}
+				}
+				if !seg.Points[pointNo].Timestamp.IsZero() {
+					previousTimed = pointNo
+				}
+			}
+			if start == 0 {
+				segments = append(segments, *seg)
+			} else {
+				segments = append(segments, GPXTrackSegment{Points: seg.Points[start:], Extensions: copyExtension(seg.Extensions)})
+			}
+		}
+		track.Segments = segments
+	}
+}
+
+// copyExtension returns a deep copy of the extension, the copy doesn't share
+// nodes or attributes with the original
+func copyExtension(ext Extension) Extension {
+	return Extension{Nodes: copyExtensionNodes(ext.Nodes)}
+}
+
+func copyExtensionNodes(nodes []ExtensionNode) []ExtensionNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	result := make([]ExtensionNode, len(nodes))
+	for i, node := range nodes {
+		result[i] = ExtensionNode{XMLName: node.XMLName, Data: node.Data, Nodes: copyExtensionNodes(node.Nodes)}
+		if len(node.Attrs) > 0 {
+			result[i].Attrs = append([]xml.Attr(nil), node.Attrs...)
+		}
+	}
+	return result
+}
+
+// removePoints removes the points for which remove returns true, it is
+// called with the indexes of the original points
+func (seg *GPXTrackSegment) removePoints(remove func(pointNo int) bool) {
+	points := make([]GPXPoint, 0, len(seg.Points))
+	for pointNo := range seg.Points {
+		if !remove(pointNo) {
+			points = append(points, seg.Points[pointNo])
+		}
+	}
+	seg.Points = points
+}
+
+// sortByTime sorts the points with times, points without time keep their
+// indexes. Returns the number of moved points.
+func (seg *GPXTrackSegment) sortByTime() int {
+	var indexes []int
+	for pointNo, point := range seg.Points {
+		if !point.Timestamp.IsZero() {
+			indexes = append(indexes, pointNo)
+		}
+	}
+	sorted := make([]int, len(indexes))
+	copy(sorted, indexes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return seg.Points[sorted[i]].Timestamp.Before(seg.Points[sorted[j]].Timestamp)
+	})
+
+	moved := 0
+	points := make([]GPXPoint, len(seg.Points))
+	copy(points, seg.Points)
+	for i, pointNo := range indexes {
+		if sorted[i] != pointNo {
+			points[pointNo] = seg.Points[sorted[i]]
+			moved++
+		}
+	}
+	seg.Points = points
+	return moved
+}
+
+// interpolateElevations adds the missing elevations between points with
+// elevations, proportionally to the 2D distance. Returns the indexes of the
+// changed points.
+func (seg *GPXTrackSegment) interpolateElevations() []int {
+	var result []int
+	previous := -1
+	for pointNo, point := range seg.Points {
+		if point.Elevation.Null() {
+			continue
+		}
+		if previous >= 0 && pointNo-previous > 1 {
+			distances := make([]float64, pointNo-previous+1)
+			for i := previous + 1; i <= pointNo; i++ {
+				distances[i-previous] = distances[i-previous-1] + seg.Points[i].Distance2D(&seg.Points[i-1])
+			}
+			startElevation, endElevation := seg.Points[previous].Elevation.Value(), point.Elevation.Value()
+			length := distances[len(distances)-1]
+			for i := previous + 1; i < pointNo; i++ {
+				ratio := float64(i-previous) / float64(pointNo-previous)
+				if length > 0 {
+					ratio = distances[i-previous] / length
+				}
+				seg.Points[i].Elevation.SetValue(startElevation + ratio*(endElevation-startElevation))
+				result = append(result, i)
+			}
+		}
+		previous = pointNo
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func repairTestGPX() *GPX {
+	g := new(GPX)
+	g.Tracks = []GPXTrack{
+		{Segments: []GPXTrackSegment{{Points: []GPXPoint{
+			lintTestPoint(46, 13, 100, 0),
+			lintTestPoint(0, 0, 0, 5),
+			lintTestPoint(46.0001, 13, 101, 10),
+			lintTestPoint(46.0001, 13, 101, 10),
+			lintTestPoint(46.0003, 13, 103, 30),
+			lintTestPoint(46.0002, 13, 102, 20),
+			lintTestPoint(46.0004, 13, 104, 40),
+		}}, {}}},
+		{},
+	}
+	return g
+}
+
+func TestRepairNothing(t *testing.T) {
+	g := repairTestGPX()
+	assertStringers(t, Repair(g, RepairOptions{}).Changes)
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 7)
+}
+
+func TestRepairSort(t *testing.T) {
+	g := repairTestGPX()
+	report := Repair(g, RepairOptions{RemoveZeroCoordinates: true, RemoveDuplicates: true, OutOfOrder: OutOfOrderSort, RemoveEmpty: true})
+	assertStringers(t, report.Changes,
+		"track 0, segment 0, point 1: removed zero coordinates: point at (0, 0)",
+		"track 0, segment 0, point 2: removed duplicate: duplicate of point 1",
+		"track 0, segment 0, point -1: sorted points: 2 points moved",
+		"track 0, segment 1, point -1: removed empty: segment without points",
+		"track 1, segment -1, point -1: removed empty: track without segments",
+	)
+	assertEquals(t, report.Count(RepairRemovedEmpty), 2)
+
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, len(g.Tracks[0].Segments), 1)
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 5)
+	for pointNo := 1; pointNo < len(points); pointNo++ {
+		assertTrue(t, "sorted", points[pointNo].Timestamp.After(points[pointNo-1].Timestamp))
+	}
+	assertStringers(t, Lint(g, LintOptions{}))
+}
+
+func TestRepairSplit(t *testing.T) {
+	g := repairTestGPX()
+	report := Repair(g, RepairOptions{OutOfOrder: OutOfOrderSplit, MaxDistanceGap: 1000})
+	assertStringers(t, report.Changes,
+		"track 0, segment 0, point 5: split segment: time before the previous point",
+		"track 0, segment 0, point 1: split segment: 5270826.9m from the previous point",
+		"track 0, segment 0, point 2: split segment: 5270837.5m from the previous point",
+	)
+	assertEquals(t, len(g.Tracks[0].Segments), 5)
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 1)
+	assertEquals(t, len(g.Tracks[0].Segments[1].Points), 1)
+	assertEquals(t, len(g.Tracks[0].Segments[2].Points), 3)
+	assertEquals(t, len(g.Tracks[0].Segments[3].Points), 2)
+	assertEquals(t, len(g.Tracks[0].Segments[4].Points), 0)
+
+	// Every piece keeps the segment extensions
+	g = repairTestGPX()
+	g.Tracks[0].Segments[0].Extensions.Nodes = []ExtensionNode{simpleExtensionNode("http://example.com", "color", "red")}
+	report = Repair(g, RepairOptions{MaxDistanceGap: 1000})
+	assertEquals(t, report.Count(RepairSplitSegment), 2)
+	for segmentNo := 0; segmentNo < 3; segmentNo++ {
+		assertEquals(t, g.Tracks[0].Segments[segmentNo].Extensions.GetNode("http://example.com", "color").Data, "red")
+	}
+	assertTrue(t, "no extensions", g.Tracks[0].Segments[3].Extensions.Empty())
+
+	// The copies don't share nested nodes or attributes
+	g = repairTestGPX()
+	parent := simpleExtensionNode("http://example.com", "line", "")
+	parent.Attrs = []xml.Attr{{Name: xml.Name{Local: "id"}, Value: "1"}}
+	parent.Nodes = []ExtensionNode{simpleExtensionNode("http://example.com", "color", "red")}
+	g.Tracks[0].Segments[0].Extensions.Nodes = []ExtensionNode{parent}
+	Repair(g, RepairOptions{MaxDistanceGap: 1000})
+	changed := g.Tracks[0].Segments[0].Extensions.GetNode("http://example.com", "line")
+	changed.Nodes[0].Data = "blue"
+	changed.Attrs[0].Value = "2"
+	for segmentNo := 1; segmentNo < 3; segmentNo++ {
+		line := g.Tracks[0].Segments[segmentNo].Extensions.GetNode("http://example.com", "line")
+		assertEquals(t, line.Nodes[0].Data, "red")
+		assertEquals(t, line.Attrs[0].Value, "1")
+	}
+
+	g = repairTestGPX()
+	report = Repair(g, RepairOptions{RemoveZeroCoordinates: true, MaxTimeGap: 15 * time.Second})
+	assertEquals(t, report.Changes[1].String(), "track 0, segment 0, point 3: split segment: 20s without points")
+	assertEquals(t, report.Count(RepairSplitSegment), 2)
+	assertEquals(t, len(g.Tracks[0].Segments), 4)
+}
+
+func TestRepairInterpolate(t *testing.T) {
+	g := new(GPX)
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 46, Longitude: 13}, Timestamp: time.Date(2014, 1, 1, 12, 0, 0, 0, time.UTC)})
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 46.001, Longitude: 13}})
+	g.AppendPoint(&GPXPoint{Point: Point{Latitude: 46.003, Longitude: 13}, Timestamp: time.Date(2014, 1, 1, 12, 0, 30, 0, time.UTC)})
+	points := g.Tracks[0].Segments[0].Points
+	points[0].Elevation.SetValue(100)
+	points[2].Elevation.SetValue(130)
+
+	report := Repair(g, RepairOptions{InterpolateTimes: true, InterpolateElevations: true})
+	assertEquals(t, len(report.Changes), 2)
+	assertEquals(t, report.Changes[0].Action, RepairInterpolatedTime)
+	assertEquals(t, report.Changes[1].String(), "track 0, segment 0, point 1: interpolated elevation: 110.0m")
+	assertTrue(t, "interpolated time", cca(points[1].Timestamp.Sub(points[0].Timestamp).Seconds(), 10))
+	assertTrue(t, "interpolated elevation", cca(points[1].Elevation.Value(), 110))
+}
@@ -0,0 +1,366 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tcxNamespace = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	// ClueTrustGpxData is the namespace of the ClueTrust gpxdata extensions,
+	// ParseTCX keeps the point distances in its distance elements
+	ClueTrustGpxData = "http://www.cluetrust.com/XML/GPXDATA/1/0"
+
+	defaultTCXSpeed = 5.0
+	// tcxCourseMaxName is the maximal length of course names
+	tcxCourseMaxName = 15
+)
+
+// tcxStartTime is the time of the first course point if the course points
+// have no times
+var tcxStartTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type tcxDatabase struct {
+	XMLName    xml.Name       `xml:"TrainingCenterDatabase"`
+	Xmlns      string         `xml:"xmlns,attr,omitempty"`
+	Activities *tcxActivities `xml:"Activities"`
+	Courses    *tcxCourses    `xml:"Courses"`
+}
+
+type tcxActivities struct {
+	Activities []tcxActivity `xml:"Activity"`
+}
+
+type tcxCourses struct {
+	Courses []tcxCourse `xml:"Course"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	ID    string   `xml:"Id"`
+	Laps  []tcxLap `xml:"Lap"`
+	Notes string   `xml:"Notes"`
+}
+
+// tcxLap is a lap of an activity or a course (which has no tracks)
+type tcxLap struct {
+	TotalTimeSeconds    string       `xml:"TotalTimeSeconds"`
+	DistanceMeters      string       `xml:"DistanceMeters"`
+	BeginPosition       *tcxPosition `xml:"BeginPosition"`
+	BeginAltitudeMeters string       `xml:"BeginAltitudeMeters,omitempty"`
+	EndPosition         *tcxPosition `xml:"EndPosition"`
+	EndAltitudeMeters   string       `xml:"EndAltitudeMeters,omitempty"`
+	Intensity           string       `xml:"Intensity"`
+	Tracks              []tcxTrack   `xml:"Track"`
+}
+
+type tcxCourse struct {
+	Name         string           `xml:"Name"`
+	Laps         []tcxLap         `xml:"Lap"`
+	Tracks       []tcxTrack       `xml:"Track"`
+	CoursePoints []tcxCoursePoint `xml:"CoursePoint"`
+}
+
+type tcxTrack struct {
+	Trackpoints []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+type tcxTrackpoint struct {
+	Time           string                  `xml:"Time"`
+	Position       *tcxPosition            `xml:"Position"`
+	AltitudeMeters string                  `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters string                  `xml:"DistanceMeters,omitempty"`
+	HeartRateBpm   *tcxHeartRate           `xml:"HeartRateBpm"`
+	Cadence        string                  `xml:"Cadence,omitempty"`
+	Extensions     *tcxTrackpointExtension `xml:"Extensions>TPX"`
+}
+
+// tcxTrackpointExtension is the Garmin ActivityExtension TPX element (only
+// read)
+type tcxTrackpointExtension struct {
+	Speed      string `xml:"Speed"`
+	RunCadence string `xml:"RunCadence"`
+}
+
+type tcxPosition struct {
+	LatitudeDegrees  string `xml:"LatitudeDegrees"`
+	LongitudeDegrees string `xml:"LongitudeDegrees"`
+}
+
+type tcxHeartRate struct {
+	Value string `xml:"Value"`
+}
+
+type tcxCoursePoint struct {
+	Name           string      `xml:"Name"`
+	Time           string      `xml:"Time"`
+	Position       tcxPosition `xml:"Position"`
+	AltitudeMeters string      `xml:"AltitudeMeters,omitempty"`
+	PointType      string      `xml:"PointType"`
+	Notes          string      `xml:"Notes,omitempty"`
+}
+
+// ParseTCX parses a Garmin Training Center (TCX) document. Activities are
+// converted to tracks (with the Id as name, the Sport as type and the Notes
+// as description) with a segment for each lap. Courses are converted to
+// tracks with a segment for each course track and the course points to
+// waypoints. Trackpoints without position are ignored. Heart rates and
+// cadences are kept in GPXPoint.HeartRate and GPXPoint.Cadence, the
+// DistanceMeters values in the point extensions as ClueTrustGpxData distance
+// elements.
+func ParseTCX(r io.Reader) (*GPX, error) {
+	utf8Reader, err := newUTF8Reader(r)
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(utf8Reader)
+	d.CharsetReader = passCharsetReader
+
+	var doc tcxDatabase
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Activities == nil {
+		doc.Activities = new(tcxActivities)
+	}
+	if doc.Courses == nil {
+		doc.Courses = new(tcxCourses)
+	}
+
+	g := &GPX{Version: "1.1"}
+	for _, activity := range doc.Activities.Activities {
+		track := GPXTrack{Name: strings.TrimSpace(activity.ID), Type: activity.Sport, Description: strings.TrimSpace(activity.Notes)}
+		for _, lap := range activity.Laps {
+			var segment GPXTrackSegment
+			for _, tcxTrack := range lap.Tracks {
+				points, err := tcxTrack.points()
+				if err != nil {
+					return nil, err
+				}
+				segment.Points = append(segment.Points, points...)
+			}
+			track.Segments = append(track.Segments, segment)
+		}
+		g.AppendTrack(&track)
+	}
+
+	for _, course := range doc.Courses.Courses {
+		track := GPXTrack{Name: strings.TrimSpace(course.Name)}
+		for _, tcxTrack := range course.Tracks {
+			points, err := tcxTrack.points()
+			if err != nil {
+				return nil, err
+			}
+			track.Segments = append(track.Segments, GPXTrackSegment{Points: points})
+		}
+		g.AppendTrack(&track)
+
+		for _, coursePoint := range course.CoursePoints {
+			lat, lon, err := coursePoint.Position.parse()
+			if err != nil {
+				return nil, err
+			}
+			waypoint := GPXPoint{
+				Point:       Point{Latitude: lat, Longitude: lon},
+				Timestamp:   parseOptionalTime(coursePoint.Time),
+				Name:        strings.TrimSpace(coursePoint.Name),
+				Description: strings.TrimSpace(coursePoint.Notes),
+				Type:        strings.TrimSpace(coursePoint.PointType),
+			}
+			setTCXFloat(&waypoint.Elevation, coursePoint.AltitudeMeters)
+			g.AppendWaypoint(&waypoint)
+		}
+	}
+	return g, nil
+}
+
+func (t *tcxTrack) points() ([]GPXPoint, error) {
+	var result []GPXPoint
+	for _, trackpoint := range t.Trackpoints {
+		if trackpoint.Position == nil {
+			continue
+		}
+		lat, lon, err := trackpoint.Position.parse()
+		if err != nil {
+			return nil, err
+		}
+		point := GPXPoint{Point: Point{Latitude: lat, Longitude: lon}, Timestamp: parseOptionalTime(trackpoint.Time)}
+		setTCXFloat(&point.Elevation, trackpoint.AltitudeMeters)
+		if trackpoint.HeartRateBpm != nil {
+			setTCXInt(&point.HeartRate, trackpoint.HeartRateBpm.Value)
+		}
+		setTCXInt(&point.Cadence, trackpoint.Cadence)
+		if trackpoint.Extensions != nil {
+			setTCXFloat(&point.Speed, trackpoint.Extensions.Speed)
+			if point.Cadence.Null() {
+				setTCXInt(&point.Cadence, trackpoint.Extensions.RunCadence)
+			}
+		}
+		var distance NullableFloat64
+		setTCXFloat(&distance, trackpoint.DistanceMeters)
+		if distance.NotNull() {
+			point.Extensions.Nodes = append(point.Extensions.Nodes, simpleExtensionNode(ClueTrustGpxData, "distance", formatExtensionFloat(distance.Value())))
+		}
+		result = append(result, point)
+	}
+	return result, nil
+}
+
+func (p *tcxPosition) parse() (float64, float64, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(p.LatitudeDegrees), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid TCX latitude %q", p.LatitudeDegrees)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(p.LongitudeDegrees), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid TCX longitude %q", p.LongitudeDegrees)
+	}
+	return lat, lon, nil
+}
+
+// setTCXFloat sets n if value is a valid number, invalid values are ignored
+// (as in GPX)
+func setTCXFloat(n *NullableFloat64, value string) {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		n.SetValue(f)
+	}
+}
+
+func setTCXInt(n *NullableInt, value string) {
+	if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		n.SetValue(i)
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// TCXOptions contains settings for GPX.ToTCX
+type TCXOptions struct {
+	// Speed in m/s used to compute the times of points without time (TCX
+	// requires times), 5 by default
+	Speed float64
+	// Indent writes indented XML
+	Indent bool
+}
+
+// ToTCX converts the routes and tracks to Garmin Training Center (TCX)
+// courses, with a lap for each track segment. Course names are truncated to
+// 15 characters (the TCX limit), courses without name are named "Course 1",
+// "Course 2"... Points without time get a time computed from the distance
+// from the previous point and TCXOptions.Speed. Waypoints are not written.
+func (g *GPX) ToTCX(opts TCXOptions) ([]byte, error) {
+	if opts.Speed <= 0 {
+		opts.Speed = defaultTCXSpeed
+	}
+
+	var courses tcxCourses
+	for routeNo := range g.Routes {
+		route := &g.Routes[routeNo]
+		courses.Courses = append(courses.Courses, opts.course(route.Name, len(courses.Courses), [][]GPXPoint{route.Points}))
+	}
+	for trackNo := range g.Tracks {
+		track := &g.Tracks[trackNo]
+		laps := make([][]GPXPoint, len(track.Segments))
+		for segmentNo := range track.Segments {
+			laps[segmentNo] = track.Segments[segmentNo].Points
+		}
+		courses.Courses = append(courses.Courses, opts.course(track.Name, len(courses.Courses), laps))
+	}
+
+	doc := tcxDatabase{Xmlns: tcxNamespace}
+	if len(courses.Courses) > 0 {
+		doc.Courses = &courses
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buffer)
+	if opts.Indent {
+		enc.Indent("", "	")
+	}
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (opts TCXOptions) course(name string, courseNo int, laps [][]GPXPoint) tcxCourse {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		name = fmt.Sprintf("Course %d", courseNo+1)
+	}
+	if runes := []rune(name); len(runes) > tcxCourseMaxName {
+		name = strings.TrimSpace(string(runes[:tcxCourseMaxName]))
+	}
+	result := tcxCourse{Name: name}
+
+	var previous *GPXPoint
+	var previousTime time.Time
+	var distance float64
+	for _, points := range laps {
+		if len(points) == 0 {
+			continue
+		}
+		lap := tcxLap{Intensity: "Active"}
+		var track tcxTrack
+		var lapStartTime time.Time
+		lapStartDistance := distance
+		for pointNo := range points {
+			point := &points[pointNo]
+			pointTime := point.Timestamp
+			if previous != nil {
+				step := point.Distance2D(previous)
+				distance += step
+				if pointTime.IsZero() {
+					pointTime = previousTime.Add(time.Duration(math.Round(step/opts.Speed*1000)) * time.Millisecond)
+				}
+			} else if pointTime.IsZero() {
+				pointTime = tcxStartTime
+			}
+			if pointNo == 0 {
+				lapStartTime = pointTime
+			}
+			previous, previousTime = point, pointTime
+
+			trackpoint := tcxTrackpoint{
+				Time:           formatGPXTime(&pointTime, ToXmlParams{}),
+				Position:       newTCXPosition(point),
+				AltitudeMeters: formatNullableFloat64(point.Elevation),
+				DistanceMeters: strconv.FormatFloat(distance, 'f', 2, 64),
+				Cadence:        formatNullableInt(point.Cadence),
+			}
+			if point.HeartRate.NotNull() {
+				trackpoint.HeartRateBpm = &tcxHeartRate{Value: formatNullableInt(point.HeartRate)}
+			}
+			track.Trackpoints = append(track.Trackpoints, trackpoint)
+		}
+
+		first, last := &points[0], &points[len(points)-1]
+		lap.TotalTimeSeconds = strconv.FormatFloat(previousTime.Sub(lapStartTime).Seconds(), 'f', -1, 64)
+		lap.DistanceMeters = strconv.FormatFloat(distance-lapStartDistance, 'f', 2, 64)
+		lap.BeginPosition, lap.BeginAltitudeMeters = newTCXPosition(first), formatNullableFloat64(first.Elevation)
+		lap.EndPosition, lap.EndAltitudeMeters = newTCXPosition(last), formatNullableFloat64(last.Elevation)
+		result.Laps = append(result.Laps, lap)
+		result.Tracks = append(result.Tracks, track)
+	}
+	return result
+}
+
+func newTCXPosition(point *GPXPoint) *tcxPosition {
+	return &tcxPosition{
+		LatitudeDegrees:  formatExtensionFloat(point.Latitude),
+		LongitudeDegrees: formatExtensionFloat(point.Longitude),
+	}
+}
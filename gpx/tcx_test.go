@@ -0,0 +1,159 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tcxDistance(point *GPXPoint) string {
+	if node := point.Extensions.GetNode(ClueTrustGpxData, "distance"); node != nil {
+		return node.Data
+	}
+	return ""
+}
+
+func TestParseTCXActivity(t *testing.T) {
+	f, err := os.Open("../test_files/activity.tcx")
+	assertNil(t, err)
+	defer f.Close()
+	g, err := ParseTCX(f)
+	assertNil(t, err)
+
+	assertEquals(t, len(g.Waypoints), 0)
+	assertEquals(t, len(g.Tracks), 1)
+	track := g.Tracks[0]
+	assertEquals(t, track.Name, "2014-06-01T07:00:00.000Z")
+	assertEquals(t, track.Type, "Running")
+	assertEquals(t, track.Description, "Morning run")
+
+	// A segment for each lap, the trackpoint without position is ignored:
+	assertEquals(t, len(track.Segments), 2)
+	assertEquals(t, len(track.Segments[0].Points), 3)
+	assertEquals(t, len(track.Segments[1].Points), 1)
+
+	first := track.Segments[0].Points[0]
+	assertEquals(t, first.Latitude, 46.0)
+	assertEquals(t, first.Elevation.Value(), 500.0)
+	assertEquals(t, first.HeartRate.Value(), 120)
+	assertEquals(t, first.Cadence.Value(), 80)
+	assertEquals(t, first.Speed.Value(), 2.5)
+	assertEquals(t, tcxDistance(&first), "0")
+	assertTrue(t, "time", first.Timestamp.Equal(time.Date(2014, 6, 1, 7, 0, 0, 0, time.UTC)))
+
+	second := track.Segments[0].Points[1]
+	assertEquals(t, second.HeartRate.Value(), 125)
+	assertEquals(t, second.Cadence.Value(), 85)
+	assertTrue(t, "no speed", second.Speed.Null())
+	assertEquals(t, tcxDistance(&second), "22.2")
+	assertEquals(t, tcxDistance(&track.Segments[1].Points[0]), "66.7")
+
+	movingData := g.MovingData()
+	assertEquals(t, movingData.MovingTime, 20.0)
+	assertTrue(t, "uphill", g.UphillDownhill().Uphill > 0)
+
+	// The distances are written as gpxdata extensions:
+	xml, err := g.ToXml(ToXmlParams{Version: "1.1"})
+	assertNil(t, err)
+	assertTrue(t, "gpxdata distance", strings.Contains(string(xml), `<gpxdata:distance>22.2</gpxdata:distance>`))
+	assertTrue(t, "heart rate", strings.Contains(string(xml), `:hr>125</`))
+}
+
+func TestParseTCXCourse(t *testing.T) {
+	tcx := `<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"><Courses><Course>
+<Name>Loop</Name>
+<Lap><TotalTimeSeconds>10</TotalTimeSeconds><DistanceMeters>100</DistanceMeters><Intensity>Active</Intensity></Lap>
+<Track>
+<Trackpoint><Time>2014-06-01T07:00:00Z</Time><Position><LatitudeDegrees>46</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position></Trackpoint>
+<Trackpoint><Time>2014-06-01T07:00:10Z</Time><Position><LatitudeDegrees>46.001</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position></Trackpoint>
+</Track>
+<CoursePoint><Name>Water</Name><Time>2014-06-01T07:00:05Z</Time><Position><LatitudeDegrees>46.0005</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><AltitudeMeters>300</AltitudeMeters><PointType>Water</PointType><Notes>Fountain</Notes></CoursePoint>
+</Course></Courses></TrainingCenterDatabase>`
+	g, err := ParseTCX(strings.NewReader(tcx))
+	assertNil(t, err)
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, g.Tracks[0].Name, "Loop")
+	assertEquals(t, len(g.Tracks[0].Segments), 1)
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 2)
+	assertEquals(t, len(g.Waypoints), 1)
+	assertEquals(t, g.Waypoints[0].Name, "Water")
+	assertEquals(t, g.Waypoints[0].Type, "Water")
+	assertEquals(t, g.Waypoints[0].Description, "Fountain")
+	assertEquals(t, g.Waypoints[0].Elevation.Value(), 300.0)
+
+	_, err = ParseTCX(strings.NewReader(`<gpx></gpx>`))
+	assertTrue(t, "invalid root", err != nil)
+	_, err = ParseTCX(strings.NewReader(strings.Replace(tcx, "<LatitudeDegrees>46</LatitudeDegrees>", "<LatitudeDegrees>x</LatitudeDegrees>", 1)))
+	assertTrue(t, "invalid latitude", err != nil)
+}
+
+func TestToTCX(t *testing.T) {
+	g := new(GPX)
+	point := GPXPoint{Point: Point{Latitude: 46, Longitude: 13}, Timestamp: time.Date(2014, 6, 1, 7, 0, 0, 0, time.UTC)}
+	point.Elevation.SetValue(500)
+	point.HeartRate.SetValue(120)
+	g.AppendRoute(&GPXRoute{Points: []GPXPoint{
+		{Point: Point{Latitude: 46, Longitude: 13}},
+		{Point: Point{Latitude: 46.001, Longitude: 13}},
+	}})
+	g.AppendTrack(&GPXTrack{Name: "A very long track name", Segments: []GPXTrackSegment{
+		{Points: []GPXPoint{point, {Point: Point{Latitude: 46.001, Longitude: 13}}}},
+		{},
+		{Points: []GPXPoint{{Point: Point{Latitude: 46.002, Longitude: 13}, Timestamp: time.Date(2014, 6, 1, 7, 1, 0, 0, time.UTC)}}},
+	}})
+
+	tcx, err := g.ToTCX(TCXOptions{Speed: 10})
+	assertNil(t, err)
+	assertEquals(t, string(tcx), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"><Courses>`+
+		`<Course><Name>Course 1</Name>`+
+		`<Lap><TotalTimeSeconds>11.112</TotalTimeSeconds><DistanceMeters>111.12</DistanceMeters>`+
+		`<BeginPosition><LatitudeDegrees>46</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></BeginPosition>`+
+		`<EndPosition><LatitudeDegrees>46.001</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></EndPosition>`+
+		`<Intensity>Active</Intensity></Lap>`+
+		`<Track><Trackpoint><Time>2000-01-01T00:00:00Z</Time><Position><LatitudeDegrees>46</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><DistanceMeters>0.00</DistanceMeters></Trackpoint>`+
+		`<Trackpoint><Time>2000-01-01T00:00:11.112Z</Time><Position><LatitudeDegrees>46.001</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><DistanceMeters>111.12</DistanceMeters></Trackpoint></Track></Course>`+
+		`<Course><Name>A very long tra</Name>`+
+		`<Lap><TotalTimeSeconds>11.112</TotalTimeSeconds><DistanceMeters>111.12</DistanceMeters>`+
+		`<BeginPosition><LatitudeDegrees>46</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></BeginPosition><BeginAltitudeMeters>500</BeginAltitudeMeters>`+
+		`<EndPosition><LatitudeDegrees>46.001</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></EndPosition>`+
+		`<Intensity>Active</Intensity></Lap>`+
+		`<Lap><TotalTimeSeconds>0</TotalTimeSeconds><DistanceMeters>111.12</DistanceMeters>`+
+		`<BeginPosition><LatitudeDegrees>46.002</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></BeginPosition>`+
+		`<EndPosition><LatitudeDegrees>46.002</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></EndPosition>`+
+		`<Intensity>Active</Intensity></Lap>`+
+		`<Track><Trackpoint><Time>2014-06-01T07:00:00Z</Time><Position><LatitudeDegrees>46</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><AltitudeMeters>500</AltitudeMeters><DistanceMeters>0.00</DistanceMeters><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>`+
+		`<Trackpoint><Time>2014-06-01T07:00:11.112Z</Time><Position><LatitudeDegrees>46.001</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><DistanceMeters>111.12</DistanceMeters></Trackpoint></Track>`+
+		`<Track><Trackpoint><Time>2014-06-01T07:01:00Z</Time><Position><LatitudeDegrees>46.002</LatitudeDegrees><LongitudeDegrees>13</LongitudeDegrees></Position><DistanceMeters>222.24</DistanceMeters></Trackpoint></Track>`+
+		`</Course></Courses></TrainingCenterDatabase>`)
+}
+
+func TestTCXRoundTrip(t *testing.T) {
+	original, err := ParseFile("../test_files/file.gpx")
+	assertNil(t, err)
+	tcx, err := original.ToTCX(TCXOptions{Indent: true})
+	assertNil(t, err)
+	g, err := ParseTCX(bytes.NewReader(tcx))
+	assertNil(t, err)
+
+	assertEquals(t, len(g.Tracks), len(original.Routes)+len(original.Tracks))
+	track := g.Tracks[len(original.Routes)]
+	originalTrack := original.Tracks[0]
+	assertEquals(t, len(track.Segments), len(originalTrack.Segments))
+	for segmentNo, segment := range originalTrack.Segments {
+		assertEquals(t, len(track.Segments[segmentNo].Points), len(segment.Points))
+		for pointNo, point := range segment.Points {
+			parsed := track.Segments[segmentNo].Points[pointNo]
+			assertEquals(t, parsed.Point, point.Point)
+			assertTrue(t, "time", parsed.Timestamp.Equal(point.Timestamp))
+		}
+	}
+	assertTrue(t, "length", cca(track.Length2D(), originalTrack.Length2D()))
+}
@@ -0,0 +1,584 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationIssue is a violation of the GPX schema found by Validate
+type ValidationIssue struct {
+	// Line and Column (in bytes) of the element, starting with 1
+	Line   int
+	Column int
+	// Path of the element, numbered as in ParseError.Path
+	Path    string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	if len(i.Path) == 0 {
+		return fmt.Sprintf("line %d, column %d: %s", i.Line, i.Column, i.Message)
+	}
+	return fmt.Sprintf("line %d, column %d, %s: %s", i.Line, i.Column, i.Path, i.Message)
+}
+
+// Validate checks a GPX 1.0 or 1.1 document against the rules of the
+// official schemas: element order and cardinality, required attributes and
+// the value types (coordinates, degrees, dgpsid, fix, times, numbers, GPX 1.0
+// emails...). The version is detected as in ParseBytes. Elements of other
+// namespaces are allowed in the GPX 1.1 extensions and anywhere in GPX 1.0,
+// their content isn't checked. A valid document returns no issues, a
+// document which isn't well formed XML returns the issues found before the
+// syntax error followed by the syntax error.
+func Validate(data []byte) []ValidationIssue {
+	r, err := newUTF8Reader(bytes.NewReader(data))
+	if err != nil {
+		return []ValidationIssue{{Line: 1, Column: 1, Message: err.Error()}}
+	}
+	v := &validator{pr: newPositionReader(r)}
+	v.d = xml.NewDecoder(v.pr)
+	v.d.CharsetReader = passCharsetReader
+
+	if err := v.validateDocument(); err != nil {
+		v.addIssue("", v.offset, err.Error())
+	}
+	return v.issues
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// schemaType is an XSD element type, with a value check for simple types or
+// the sequence of child elements for complex types
+type schemaType struct {
+	attributes []schemaAttribute
+	children   []schemaChild
+	// value checks the text of simple types, nil for complex types
+	value func(string) error
+	// any is the content of extensions elements, not checked
+	any bool
+}
+
+type schemaAttribute struct {
+	name     string
+	required bool
+	value    func(string) error
+}
+
+type schemaChild struct {
+	name     string
+	multiple bool
+	typ      *schemaType
+}
+
+func (t *schemaType) child(name string) int {
+	for childNo, child := range t.children {
+		if child.name == name {
+			return childNo
+		}
+	}
+	return -1
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+var (
+	xsdDateTime = regexp.MustCompile(`^-?\d{4,}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+	xsdYear     = regexp.MustCompile(`^-?\d{4,}(Z|[+-]\d{2}:\d{2})?$`)
+	xsdDecimal  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	// gpx10Email is the emailType pattern of the GPX 1.0 schema
+	gpx10Email = regexp.MustCompile(`^[\p{L}_]+(\.[\p{L}_]+)*@[\p{L}_]+(\.[\p{L}_]+)+$`)
+)
+
+func anyValue(value string) error {
+	return nil
+}
+
+func decimalValue(value string) error {
+	if !xsdDecimal.MatchString(value) {
+		return fmt.Errorf("invalid decimal %q", value)
+	}
+	return nil
+}
+
+// decimalRange returns a check of decimals between min and max, max is
+// excluded if maxExclusive
+func decimalRange(min, max float64, maxExclusive bool) func(string) error {
+	return func(value string) error {
+		if err := decimalValue(value); err != nil {
+			return err
+		}
+		parsed, _ := strconv.ParseFloat(value, 64)
+		if parsed < min || parsed > max || (maxExclusive && parsed == max) {
+			return fmt.Errorf("%s out of range", value)
+		}
+		return nil
+	}
+}
+
+func integerRange(min, max int64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		if parsed < min || parsed > max {
+			return fmt.Errorf("%s out of range", value)
+		}
+		return nil
+	}
+}
+
+func dateTimeValue(value string) error {
+	if !xsdDateTime.MatchString(value) {
+		return fmt.Errorf("invalid time %q", value)
+	}
+	if _, err := parseGPXTime(value, nil); err != nil {
+		return fmt.Errorf("invalid time %q", value)
+	}
+	return nil
+}
+
+func yearValue(value string) error {
+	if !xsdYear.MatchString(value) {
+		return fmt.Errorf("invalid year %q", value)
+	}
+	return nil
+}
+
+func fixValue(value string) error {
+	fixType, err := ParseFixType(value)
+	if err != nil || fixType == FixUnknown || value != fixType.String() {
+		return fmt.Errorf("invalid fix %q", value)
+	}
+	return nil
+}
+
+func gpx10EmailValue(value string) error {
+	if !gpx10Email.MatchString(value) {
+		return fmt.Errorf("invalid email %q", value)
+	}
+	return nil
+}
+
+func fixedValue(fixed string) func(string) error {
+	return func(value string) error {
+		if value != fixed {
+			return fmt.Errorf("expected %q, found %q", fixed, value)
+		}
+		return nil
+	}
+}
+
+var (
+	stringType             = &schemaType{value: anyValue}
+	decimalType            = &schemaType{value: decimalValue}
+	nonNegativeIntegerType = &schemaType{value: integerRange(0, 1<<62)}
+	dgpsStationType        = &schemaType{value: integerRange(0, 1023)}
+	dateTimeType           = &schemaType{value: dateTimeValue}
+	fixSchemaType          = &schemaType{value: fixValue}
+	extensionsType         = &schemaType{any: true}
+)
+
+// ----------------------------------------------------------------------------------------------------
+// Gpx 1.0 schema
+// ----------------------------------------------------------------------------------------------------
+
+var (
+	gpx10DegreesType = &schemaType{value: decimalRange(0, 360, false)}
+	gpx10BoundsType  = &schemaType{attributes: []schemaAttribute{
+		{"minlat", true, decimalRange(-90, 90, false)},
+		{"minlon", true, decimalRange(-180, 180, false)},
+		{"maxlat", true, decimalRange(-90, 90, false)},
+		{"maxlon", true, decimalRange(-180, 180, false)},
+	}}
+	gpx10PointAttributes = []schemaAttribute{
+		{"lat", true, decimalRange(-90, 90, false)},
+		{"lon", true, decimalRange(-180, 180, false)},
+	}
+	gpx10PointDescription = []schemaChild{
+		{"name", false, stringType},
+		{"cmt", false, stringType},
+		{"desc", false, stringType},
+		{"src", false, stringType},
+		{"url", false, stringType},
+		{"urlname", false, stringType},
+		{"sym", false, stringType},
+		{"type", false, stringType},
+		{"fix", false, fixSchemaType},
+		{"sat", false, nonNegativeIntegerType},
+		{"hdop", false, decimalType},
+		{"vdop", false, decimalType},
+		{"pdop", false, decimalType},
+		{"ageofdgpsdata", false, decimalType},
+		{"dgpsid", false, dgpsStationType},
+	}
+	gpx10WptType = &schemaType{
+		attributes: gpx10PointAttributes,
+		children: append([]schemaChild{
+			{"ele", false, decimalType},
+			{"time", false, dateTimeType},
+			{"magvar", false, gpx10DegreesType},
+			{"geoidheight", false, decimalType},
+		}, gpx10PointDescription...),
+	}
+	gpx10TrkptType = &schemaType{
+		attributes: gpx10PointAttributes,
+		children: append([]schemaChild{
+			{"ele", false, decimalType},
+			{"time", false, dateTimeType},
+			{"course", false, gpx10DegreesType},
+			{"speed", false, decimalType},
+			{"magvar", false, gpx10DegreesType},
+			{"geoidheight", false, decimalType},
+		}, gpx10PointDescription...),
+	}
+	gpx10RteType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"cmt", false, stringType},
+		{"desc", false, stringType},
+		{"src", false, stringType},
+		{"url", false, stringType},
+		{"urlname", false, stringType},
+		{"number", false, nonNegativeIntegerType},
+		{"rtept", true, gpx10WptType},
+	}}
+	gpx10TrksegType = &schemaType{children: []schemaChild{
+		{"trkpt", true, gpx10TrkptType},
+	}}
+	gpx10TrkType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"cmt", false, stringType},
+		{"desc", false, stringType},
+		{"src", false, stringType},
+		{"url", false, stringType},
+		{"urlname", false, stringType},
+		{"number", false, nonNegativeIntegerType},
+		{"trkseg", true, gpx10TrksegType},
+	}}
+	gpx10GpxType = &schemaType{
+		attributes: []schemaAttribute{
+			{"version", true, fixedValue("1.0")},
+			{"creator", true, anyValue},
+		},
+		children: []schemaChild{
+			{"name", false, stringType},
+			{"desc", false, stringType},
+			{"author", false, stringType},
+			{"email", false, &schemaType{value: gpx10EmailValue}},
+			{"url", false, stringType},
+			{"urlname", false, stringType},
+			{"time", false, dateTimeType},
+			{"keywords", false, stringType},
+			{"bounds", false, gpx10BoundsType},
+			{"wpt", true, gpx10WptType},
+			{"rte", true, gpx10RteType},
+			{"trk", true, gpx10TrkType},
+		},
+	}
+)
+
+// ----------------------------------------------------------------------------------------------------
+// Gpx 1.1 schema
+// ----------------------------------------------------------------------------------------------------
+
+var (
+	gpx11LatitudeType  = decimalRange(-90, 90, false)
+	gpx11LongitudeType = decimalRange(-180, 180, true)
+	gpx11DegreesType   = &schemaType{value: decimalRange(0, 360, true)}
+	gpx11LinkType      = &schemaType{
+		attributes: []schemaAttribute{{"href", true, anyValue}},
+		children: []schemaChild{
+			{"text", false, stringType},
+			{"type", false, stringType},
+		},
+	}
+	gpx11EmailType = &schemaType{attributes: []schemaAttribute{
+		{"id", true, anyValue},
+		{"domain", true, anyValue},
+	}}
+	gpx11PersonType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"email", false, gpx11EmailType},
+		{"link", false, gpx11LinkType},
+	}}
+	gpx11CopyrightType = &schemaType{
+		attributes: []schemaAttribute{{"author", true, anyValue}},
+		children: []schemaChild{
+			{"year", false, &schemaType{value: yearValue}},
+			{"license", false, stringType},
+		},
+	}
+	gpx11BoundsType = &schemaType{attributes: []schemaAttribute{
+		{"minlat", true, gpx11LatitudeType},
+		{"minlon", true, gpx11LongitudeType},
+		{"maxlat", true, gpx11LatitudeType},
+		{"maxlon", true, gpx11LongitudeType},
+	}}
+	gpx11MetadataType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"desc", false, stringType},
+		{"author", false, gpx11PersonType},
+		{"copyright", false, gpx11CopyrightType},
+		{"link", true, gpx11LinkType},
+		{"time", false, dateTimeType},
+		{"keywords", false, stringType},
+		{"bounds", false, gpx11BoundsType},
+		{"extensions", false, extensionsType},
+	}}
+	gpx11WptType = &schemaType{
+		attributes: []schemaAttribute{
+			{"lat", true, gpx11LatitudeType},
+			{"lon", true, gpx11LongitudeType},
+		},
+		children: []schemaChild{
+			{"ele", false, decimalType},
+			{"time", false, dateTimeType},
+			{"magvar", false, gpx11DegreesType},
+			{"geoidheight", false, decimalType},
+			{"name", false, stringType},
+			{"cmt", false, stringType},
+			{"desc", false, stringType},
+			{"src", false, stringType},
+			{"link", true, gpx11LinkType},
+			{"sym", false, stringType},
+			{"type", false, stringType},
+			{"fix", false, fixSchemaType},
+			{"sat", false, nonNegativeIntegerType},
+			{"hdop", false, decimalType},
+			{"vdop", false, decimalType},
+			{"pdop", false, decimalType},
+			{"ageofdgpsdata", false, decimalType},
+			{"dgpsid", false, dgpsStationType},
+			{"extensions", false, extensionsType},
+		},
+	}
+	gpx11RteType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"cmt", false, stringType},
+		{"desc", false, stringType},
+		{"src", false, stringType},
+		{"link", true, gpx11LinkType},
+		{"number", false, nonNegativeIntegerType},
+		{"type", false, stringType},
+		{"extensions", false, extensionsType},
+		{"rtept", true, gpx11WptType},
+	}}
+	gpx11TrksegType = &schemaType{children: []schemaChild{
+		{"trkpt", true, gpx11WptType},
+		{"extensions", false, extensionsType},
+	}}
+	gpx11TrkType = &schemaType{children: []schemaChild{
+		{"name", false, stringType},
+		{"cmt", false, stringType},
+		{"desc", false, stringType},
+		{"src", false, stringType},
+		{"link", true, gpx11LinkType},
+		{"number", false, nonNegativeIntegerType},
+		{"type", false, stringType},
+		{"extensions", false, extensionsType},
+		{"trkseg", true, gpx11TrksegType},
+	}}
+	gpx11GpxType = &schemaType{
+		attributes: []schemaAttribute{
+			{"version", true, fixedValue("1.1")},
+			{"creator", true, anyValue},
+		},
+		children: []schemaChild{
+			{"metadata", false, gpx11MetadataType},
+			{"wpt", true, gpx11WptType},
+			{"rte", true, gpx11RteType},
+			{"trk", true, gpx11TrkType},
+			{"extensions", false, extensionsType},
+		},
+	}
+)
+
+// ----------------------------------------------------------------------------------------------------
+
+type validator struct {
+	d  *xml.Decoder
+	pr *positionReader
+	// offset of the last token
+	offset int64
+	// namespace of the GPX elements
+	namespace string
+	version   string
+	issues    []ValidationIssue
+}
+
+func (v *validator) addIssue(path string, offset int64, message string) {
+	line, column := v.pr.position(offset)
+	v.issues = append(v.issues, ValidationIssue{Line: line, Column: column, Path: path, Message: message})
+}
+
+func (v *validator) token() (xml.Token, error) {
+	v.offset = v.d.InputOffset()
+	t, err := v.d.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return t, err
+}
+
+func (v *validator) validateDocument() error {
+	for {
+		t, err := v.token()
+		if err == io.ErrUnexpectedEOF {
+			return errors.New("invalid GPX file, no gpx element found")
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "gpx" {
+			return fmt.Errorf("invalid root element %s, expected gpx", start.Name.Local)
+		}
+		offset := v.offset
+		if v.version, err = rootVersion(start); err != nil {
+			return err
+		}
+		v.namespace = start.Name.Space
+		if len(v.namespace) == 0 {
+			v.addIssue("gpx", offset, "missing GPX namespace")
+		} else if strings.HasSuffix(v.namespace, "/") {
+			v.addIssue("gpx", offset, fmt.Sprintf("invalid GPX namespace %s", v.namespace))
+		}
+
+		typ := gpx11GpxType
+		if v.version == "1.0" {
+			typ = gpx10GpxType
+		}
+		if err := v.validateElement("gpx", offset, start, typ); err != nil {
+			return err
+		}
+		break
+	}
+	// Only comments and processing instructions can follow the root element
+	for {
+		t, err := v.token()
+		if err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			return fmt.Errorf("unexpected element %s after the gpx element", t.Name.Local)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return errors.New("unexpected text after the gpx element")
+			}
+		}
+	}
+}
+
+func (v *validator) validateAttributes(path string, offset int64, start xml.StartElement, typ *schemaType) {
+	for _, attr := range start.Attr {
+		if len(attr.Name.Space) > 0 || attr.Name.Local == "xmlns" {
+			continue
+		}
+		found := false
+		for _, schemaAttr := range typ.attributes {
+			found = found || schemaAttr.name == attr.Name.Local
+		}
+		if !found {
+			v.addIssue(path, offset, fmt.Sprintf("unexpected attribute %s", attr.Name.Local))
+		}
+	}
+	for _, schemaAttr := range typ.attributes {
+		found := false
+		for _, attr := range start.Attr {
+			if len(attr.Name.Space) > 0 || attr.Name.Local != schemaAttr.name {
+				continue
+			}
+			found = true
+			if err := schemaAttr.value(strings.TrimSpace(attr.Value)); err != nil {
+				v.addIssue(path, offset, fmt.Sprintf("invalid %s attribute: %s", schemaAttr.name, err))
+			}
+		}
+		if !found && schemaAttr.required {
+			v.addIssue(path, offset, fmt.Sprintf("missing %s attribute", schemaAttr.name))
+		}
+	}
+}
+
+// validateElement checks an element after its start token and consumes all
+// its content, the returned errors are XML syntax errors
+func (v *validator) validateElement(path string, offset int64, start xml.StartElement, typ *schemaType) error {
+	v.validateAttributes(path, offset, start, typ)
+	if typ.any {
+		return v.d.Skip()
+	}
+
+	var text []byte
+	counts := map[string]int{}
+	childCounts := make([]int, len(typ.children))
+	lastChild := -1
+	for {
+		t, err := v.token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.EndElement:
+			if typ.value != nil {
+				if err := typ.value(strings.TrimSpace(string(text))); err != nil {
+					v.addIssue(path, offset, err.Error())
+				}
+			} else if len(bytes.TrimSpace(text)) > 0 {
+				v.addIssue(path, offset, "unexpected text")
+			}
+			return nil
+		case xml.StartElement:
+			childOffset := v.offset
+			name := t.Name.Local
+			if t.Name.Space != v.namespace {
+				if v.version != "1.0" || typ.value != nil {
+					v.addIssue(path, childOffset, fmt.Sprintf("unexpected element %s:%s", t.Name.Space, name))
+				}
+				if err := v.d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			childPath := path + "/" + elementPathName(counts, name)
+			childNo := typ.child(name)
+			if childNo < 0 {
+				v.addIssue(childPath, childOffset, fmt.Sprintf("unexpected element %s", name))
+				if err := v.d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			childCounts[childNo]++
+			if childNo < lastChild {
+				v.addIssue(childPath, childOffset, fmt.Sprintf("element %s must be before %s", name, typ.children[lastChild].name))
+			} else {
+				lastChild = childNo
+			}
+			if childCounts[childNo] > 1 && !typ.children[childNo].multiple {
+				v.addIssue(childPath, childOffset, fmt.Sprintf("duplicate element %s", name))
+			}
+			if err := v.validateElement(childPath, childOffset, t, typ.children[childNo].typ); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package gpx
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidateTestFiles(t *testing.T) {
+	for _, fileName := range []string{"../test_files/gpx1.0_with_all_fields.gpx", "../test_files/Mojstrovka.gpx", "../test_files/file.gpx"} {
+		data, err := ioutil.ReadFile(fileName)
+		assertNil(t, err)
+		assertStringers(t, Validate(data))
+	}
+
+	data, err := ioutil.ReadFile("../test_files/gpx1.1_with_all_fields.gpx")
+	assertNil(t, err)
+	assertStringers(t, Validate(data), "line 164, column 5, gpx/aaa: unexpected element aaa")
+}
+
+func TestValidateWrittenFiles(t *testing.T) {
+	g, err := ParseFile("../test_files/gpx1.1_with_all_fields.gpx")
+	assertNil(t, err)
+	xmlBytes, err := g.ToXml(ToXmlParams{Version: "1.1", Indent: true})
+	assertNil(t, err)
+	assertStringers(t, Validate(xmlBytes))
+}
+
+func TestValidate11(t *testing.T) {
+	xml := `<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1">
+<wpt lat="91" lon="180"><fix>3D</fix><dgpsid>1024</dgpsid></wpt>
+<metadata><author><email id="a"/></author></metadata>
+<trk><trkseg><trkpt lat="1" lon="1"><time>2014-01-01 12:00:00</time><ele>1</ele><ele>2</ele></trkpt></trkseg><name>x</name></trk>
+<trk><trkseg><trkpt><magvar>360</magvar><extensions><a:b xmlns:a="http://example.com"><c/></a:b></extensions></trkpt></trkseg></trk>
+</gpx>`
+	assertStringers(t, Validate([]byte(xml)),
+		`line 1, column 1, gpx: missing creator attribute`,
+		`line 2, column 1, gpx/wpt[1]: invalid lat attribute: 91 out of range`,
+		`line 2, column 1, gpx/wpt[1]: invalid lon attribute: 180 out of range`,
+		`line 2, column 25, gpx/wpt[1]/fix: invalid fix "3D"`,
+		`line 2, column 38, gpx/wpt[1]/dgpsid: 1024 out of range`,
+		`line 3, column 1, gpx/metadata: element metadata must be before wpt`,
+		`line 3, column 19, gpx/metadata/author/email: missing domain attribute`,
+		`line 4, column 37, gpx/trk[1]/trkseg[1]/trkpt[1]/time: invalid time "2014-01-01 12:00:00"`,
+		`line 4, column 69, gpx/trk[1]/trkseg[1]/trkpt[1]/ele: element ele must be before time`,
+		`line 4, column 81, gpx/trk[1]/trkseg[1]/trkpt[1]/ele: element ele must be before time`,
+		`line 4, column 81, gpx/trk[1]/trkseg[1]/trkpt[1]/ele: duplicate element ele`,
+		`line 4, column 110, gpx/trk[1]/name: element name must be before trkseg`,
+		`line 5, column 14, gpx/trk[2]/trkseg[1]/trkpt[1]: missing lat attribute`,
+		`line 5, column 14, gpx/trk[2]/trkseg[1]/trkpt[1]: missing lon attribute`,
+		`line 5, column 21, gpx/trk[2]/trkseg[1]/trkpt[1]/magvar: 360 out of range`,
+	)
+}
+
+func TestValidate10(t *testing.T) {
+	xml := `<gpx xmlns="http://www.topografix.com/GPX/1/0" version="1.0" creator="test">
+<email>first.last@example.com</email><email>123@example.com</email>
+<bounds minlat="1" minlon="180" maxlat="2"/>
+<wpt lat="1" lon="180"><course>1</course><x:y xmlns:x="http://example.com">foreign</x:y><link href="http://example.com"/></wpt>
+<trk><trkseg><trkpt lat="1" lon="1"><course>360</course><speed>fast</speed></trkpt></trkseg></trk>
+</gpx>`
+	assertStringers(t, Validate([]byte(xml)),
+		`line 2, column 38, gpx/email: duplicate element email`,
+		`line 2, column 38, gpx/email: invalid email "123@example.com"`,
+		`line 3, column 1, gpx/bounds: missing maxlon attribute`,
+		`line 4, column 24, gpx/wpt[1]/course: unexpected element course`,
+		`line 4, column 89, gpx/wpt[1]/link[1]: unexpected element link`,
+		`line 5, column 57, gpx/trk[1]/trkseg[1]/trkpt[1]/speed: invalid decimal "fast"`,
+	)
+}
+
+func TestValidateDocumentErrors(t *testing.T) {
+	assertStringers(t, Validate([]byte(`<kml></kml>`)), "line 1, column 1: invalid root element kml, expected gpx")
+	assertStringers(t, Validate([]byte(`<gpx xmlns="http://www.topografix.com/GPX/1/2"></gpx>`)), "line 1, column 1: unsupported GPX namespace http://www.topografix.com/GPX/1/2")
+	assertStringers(t, Validate([]byte(`<gpx version="1.1" creator="x"><wpt lat="a" lon="1">`)),
+		"line 1, column 1, gpx: missing GPX namespace",
+		`line 1, column 32, gpx/wpt[1]: invalid lat attribute: invalid decimal "a"`,
+		"line 1, column 53: XML syntax error on line 1: unexpected EOF")
+	assertStringers(t, Validate([]byte(`<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.0" creator="x"/>`)),
+		`line 1, column 1, gpx: invalid version attribute: expected "1.1", found "1.0"`)
+}
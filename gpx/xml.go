@@ -9,20 +9,28 @@ import (
 	"bytes"
 	"encoding/xml"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 )
 
-const formattingTimelayout = "2006-01-02T15:04:05.000Z"
-
-// parsingTimelayouts defines a list of possible time formats
+// parsingTimelayouts defines a list of possible time formats. Fractional
+// seconds of any length are accepted after the seconds by time.Parse.
 var parsingTimelayouts = []string{
-	formattingTimelayout,
-	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05Z07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05Z07",
+}
+
+// naiveTimeLayouts are the time formats without a timezone, parsed in the
+// ParseOptions.DefaultLocation
+var naiveTimeLayouts = []string{
 	"2006-01-02T15:04:05",
-	"2006-01-02 15:04:05Z",
 	"2006-01-02 15:04:05",
 }
 
@@ -38,6 +46,33 @@ func init() {
 type ToXmlParams struct {
 	Version string
 	Indent  bool
+	// TimePrecision is the number of fractional second digits written (up to
+	// 9). Zero writes only the digits needed (none for whole seconds), a
+	// negative value always writes whole seconds.
+	TimePrecision int
+	// PreserveTimeZone writes times with their own offset instead of
+	// converting them to UTC
+	PreserveTimeZone bool
+	// Encoding of the document, for example "ISO-8859-1" or "windows-1250"
+	// (UTF-8 if empty). Characters not available in the encoding are written
+	// as character references.
+	Encoding string
+	// WriteBounds writes the bounds computed from the tracks with GPX.Bounds()
+	// instead of the declared Metadata.DeclaredBounds. With the Encoder the
+	// bounds are computed from the GPX passed to WriteMetadata.
+	WriteBounds bool
+}
+
+//ParseOptions contains settings for parsing
+type ParseOptions struct {
+	// DefaultLocation is used for times without a timezone, UTC if nil
+	DefaultLocation *time.Location
+	// Lenient skips the invalid elements instead of failing, their errors
+	// are collected in GPX.ParseErrors
+	Lenient bool
+	// ForceVersion ("1.0" or "1.1") is used instead of the version detected
+	// from the root element namespace and version attribute
+	ForceVersion string
 }
 
 //ToXml returns the xml representation of the GPX object.
@@ -49,70 +84,87 @@ func ToXml(g *GPX, params ToXmlParams) ([]byte, error) {
 	}
 	indentation := params.Indent
 
-	var gpxDoc interface{}
-	if version == "1.0" {
-		gpxDoc = convertToGpx10Models(g)
-	} else if version == "1.1" {
-		gpxDoc = convertToGpx11Models(g)
-	} else {
+	if version != "1.0" && version != "1.1" {
 		g.Version = "1.1"
-		gpxDoc = convertToGpx11Models(g)
+		version = "1.1"
 	}
 
 	var buffer bytes.Buffer
-	buffer.WriteString(xml.Header)
-	if indentation {
-		b, err := xml.MarshalIndent(gpxDoc, "", "	")
-		if err != nil {
-			return nil, err
-		}
-		buffer.Write(b)
-	} else {
-		b, err := xml.Marshal(gpxDoc)
-		if err != nil {
-			return nil, err
-		}
-		buffer.Write(b)
+	params.Version = version
+	params.Indent = indentation
+	encoder := NewEncoder(&buffer, params)
+	if err := encoder.Encode(g); err != nil {
+		return nil, err
 	}
 	return buffer.Bytes(), nil
 }
 
-func guessGPXVersion(bytes []byte) (string, error) {
-	bytesCount := 1000
-	if len(bytes) < 1000 {
-		bytesCount = len(bytes)
-	}
+// gpxNamespaceVersions are the GPX versions of the root element namespaces
+var gpxNamespaceVersions = map[string]string{
+	gpx10Namespace: "1.0",
+	gpx11Namespace: "1.1",
+}
 
-	startOfDocument := string(bytes[:bytesCount])
+const gpxNamespacePrefix = "http://www.topografix.com/GPX/"
 
-	parts := strings.Split(startOfDocument, "<gpx")
-	if len(parts) <= 1 {
-		return "", errors.New("invalid GPX file, cannot find version")
+// rootVersion returns the GPX version of the root element. The namespace
+// is used if it's a GPX namespace, otherwise the version attribute.
+// Documents without both are parsed as GPX 1.1.
+func rootVersion(start xml.StartElement) (string, error) {
+	namespace := strings.TrimSuffix(strings.TrimSpace(start.Name.Space), "/")
+	if version, found := gpxNamespaceVersions[namespace]; found {
+		return version, nil
 	}
-	parts = strings.Split(parts[1], "version=")
-
-	if len(parts) <= 1 {
-		return "", errors.New("invalid GPX file, cannot find version")
+	if strings.HasPrefix(namespace, gpxNamespacePrefix) {
+		return "", fmt.Errorf("unsupported GPX namespace %s", start.Name.Space)
 	}
 
-	if len(parts[1]) < 10 {
-		return "", errors.New("invalid GPX file, cannot find version")
+	version := ""
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "version" {
+			version = strings.TrimSpace(attr.Value)
+		}
 	}
-
-	result := parts[1][1:4]
-
-	return result, nil
+	switch version {
+	case "":
+		return "1.1", nil
+	case "1.0", "1.1":
+		return version, nil
+	}
+	return "", errors.New("Invalid version:" + version)
 }
 
-func parseGPXTime(timestr string) (*time.Time, error) {
-	if strings.Contains(timestr, ".") {
-		// Probably seconds with milliseconds
-		timestr = strings.Split(timestr, ".")[0]
+func checkForcedVersion(version string) error {
+	if version != "1.0" && version != "1.1" {
+		return errors.New("Invalid forced version:" + version)
 	}
-	timestr = strings.Trim(timestr, " \t\n\r")
+	return nil
+}
+
+func parseGPXTime(timestr string, location *time.Location) (*time.Time, error) {
+	// RFC 3339 allows lowercase "t" and "z":
+	timestr = strings.ToUpper(strings.Trim(timestr, " \t\n\r"))
 	for _, timeLayout := range parsingTimelayouts {
 		t, err := time.Parse(timeLayout, timestr)
+		if err == nil {
+			if t.Location() != time.UTC {
+				// Keep the parsed offset, not the local zone time.Parse may pick
+				_, offset := t.Zone()
+				if offset == 0 {
+					t = t.UTC()
+				} else {
+					t = t.In(time.FixedZone("", offset))
+				}
+			}
+			return &t, nil
+		}
+	}
 
+	if location == nil {
+		location = time.UTC
+	}
+	for _, timeLayout := range naiveTimeLayouts {
+		t, err := time.ParseInLocation(timeLayout, timestr, location)
 		if err == nil {
 			return &t, nil
 		}
@@ -121,7 +173,15 @@ func parseGPXTime(timestr string) (*time.Time, error) {
 	return nil, errors.New("Cannot parse " + timestr)
 }
 
-func formatGPXTime(time *time.Time) string {
+// parseOptionalTime returns the zero time for empty or invalid times
+func parseOptionalTime(timestr string) time.Time {
+	if t, err := parseGPXTime(timestr, nil); err == nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+func formatGPXTime(time *time.Time, params ToXmlParams) string {
 	if time == nil {
 		return ""
 	}
@@ -129,11 +189,31 @@ func formatGPXTime(time *time.Time) string {
 		// Invalid date:
 		return ""
 	}
-	return time.Format(formattingTimelayout)
+	t := *time
+	if !params.PreserveTimeZone {
+		t = t.UTC()
+	}
+
+	layout := "2006-01-02T15:04:05"
+	if params.TimePrecision == 0 {
+		layout += ".999999999"
+	} else if params.TimePrecision > 0 {
+		precision := params.TimePrecision
+		if precision > 9 {
+			precision = 9
+		}
+		layout += "." + strings.Repeat("0", precision)
+	}
+	return t.Format(layout + "Z07:00")
 }
 
 //ParseFile parses a gpx file and returns a GPX object
 func ParseFile(fileName string) (*GPX, error) {
+	return ParseFileWithOptions(fileName, ParseOptions{})
+}
+
+//ParseFileWithOptions parses a gpx file with the given options
+func ParseFileWithOptions(fileName string, opts ParseOptions) (*GPX, error) {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
@@ -141,44 +221,68 @@ func ParseFile(fileName string) (*GPX, error) {
 
 	defer f.Close()
 
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
-	}
-
-	return ParseBytes(b)
+	return parse(f, opts)
 }
 
 //ParseBytes parses GPX from bytes
 func ParseBytes(bytes []byte) (*GPX, error) {
-	version, err := guessGPXVersion(bytes)
-	if err != nil {
-		// Unknown version, try with 1.1
-		version = "1.1"
-	}
+	return ParseBytesWithOptions(bytes, ParseOptions{})
+}
 
-	if version == "1.0" {
-		g := &gpx10Gpx{}
-		err := xml.Unmarshal(bytes, &g)
-		if err != nil {
-			return nil, err
-		}
+//ParseBytesWithOptions parses GPX from bytes with the given options
+func ParseBytesWithOptions(data []byte, opts ParseOptions) (*GPX, error) {
+	return parse(bytes.NewReader(data), opts)
+}
 
-		return convertFromGpx10Models(g), nil
-	} else if version == "1.1" {
-		g := &gpx11Gpx{}
-		err := xml.Unmarshal(bytes, &g)
+// parse builds the whole document from the Decoder tokens
+func parse(r io.Reader, opts ParseOptions) (*GPX, error) {
+	var result *GPX
+	decoder := NewDecoderWithOptions(r, opts)
+	for {
+		token, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
-
-		return convertFromGpx11Models(g), nil
-	} else {
-		return nil, errors.New("Invalid version:" + version)
+		switch token.Type {
+		case MetadataToken:
+			if result != nil {
+				// The whole header again, with the header elements found
+				// after the waypoints, routes or tracks
+				token.Metadata.Waypoints = result.Waypoints
+				token.Metadata.Routes = result.Routes
+				token.Metadata.Tracks = result.Tracks
+			}
+			result = token.Metadata
+		case WaypointToken:
+			result.AppendWaypoint(token.Point)
+		case RouteToken:
+			result.AppendRoute(token.Route)
+		case TrackToken:
+			result.AppendTrack(token.Track)
+		case TrackSegmentToken:
+			result.Tracks[len(result.Tracks)-1].AppendSegment(new(GPXTrackSegment))
+		case TrackPointToken:
+			result.AppendPoint(token.Point)
+		case TrackSegmentExtensionsToken:
+			track := &result.Tracks[len(result.Tracks)-1]
+			track.Segments[len(track.Segments)-1].Extensions = *token.Extensions
+		case ExtensionsToken:
+			result.Extensions = *token.Extensions
+		}
 	}
+	result.ParseErrors = decoder.Errors()
+	return result, nil
 }
 
 //ParseString parses GPX from string
 func ParseString(str string) (*GPX, error) {
 	return ParseBytes([]byte(str))
 }
+
+//ParseStringWithOptions parses GPX from string with the given options
+func ParseStringWithOptions(str string, opts ParseOptions) (*GPX, error) {
+	return ParseBytesWithOptions([]byte(str), opts)
+}
@@ -7,11 +7,13 @@ package gpx
 
 import (
 	"encoding/xml"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseTime(t *testing.T) {
-	time, err := parseGPXTime("")
+	time, err := parseGPXTime("", nil)
 	if time != nil {
 		t.Errorf("Empty string should not return a nonnil time")
 	}
@@ -37,6 +39,43 @@ func TestInvalidFloat(t *testing.T) {
 	}
 }
 
+func TestInvalidFloatFollowingElements(t *testing.T) {
+	xmlStr := `<gpx><float>...a</float><int>x</int></gpx>`
+	testXmlDoc := testXml{}
+	assertNil(t, xml.Unmarshal([]byte(xmlStr), &testXmlDoc))
+	assertTrue(t, "invalid float", testXmlDoc.Float.Null())
+	assertTrue(t, "invalid int", testXmlDoc.Int.Null())
+}
+
+func TestEmptyNumericElements(t *testing.T) {
+	xmlStr := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+	<wpt lat="1" lon="2"><ele/><sat></sat><name>Wpt</name></wpt>
+	<trk><trkseg>
+		<trkpt lat="3" lon="4"><ele></ele><sat/><magvar/><name>Pt</name><hdop>1.5</hdop></trkpt>
+		<trkpt lat="5" lon="6"><ele>7</ele></trkpt>
+	</trkseg></trk>
+</gpx>`
+	for _, lenient := range []bool{false, true} {
+		g, err := ParseBytesWithOptions([]byte(xmlStr), ParseOptions{Lenient: lenient})
+		assertNil(t, err)
+		assertEquals(t, len(g.ParseErrors), 0)
+
+		assertEquals(t, len(g.Waypoints), 1)
+		wpt := g.Waypoints[0]
+		assertTrue(t, "empty ele", wpt.Elevation.Null())
+		assertEquals(t, wpt.Name, "Wpt")
+
+		points := g.Tracks[0].Segments[0].Points
+		assertEquals(t, len(points), 2)
+		assertTrue(t, "empty ele", points[0].Elevation.Null())
+		assertTrue(t, "empty magvar", points[0].MagneticVariation.Null())
+		assertEquals(t, points[0].Name, "Pt")
+		assertEquals(t, points[0].HorizontalDilution.Value(), 1.5)
+		assertEquals(t, points[1].Elevation.Value(), 7.0)
+	}
+}
+
 func TestValidFloat(t *testing.T) {
 	xmlStr := `<gpx floatattr="13"><float>12</float><aaa /></gpx>`
 	testFloat(xmlStr, 12, 13, `<gpx floatattr="13"><float>12</float></gpx>`, t)
@@ -104,3 +143,99 @@ func testInt(xmlStr string, expectedInt int, expectedIntAttribute int, expectedX
 		t.Error("Invalid marshalled xml:", string(bytes), "expected:", expectedXml)
 	}
 }
+
+func TestParseTimeFractionAndOffset(t *testing.T) {
+	parsed, err := parseGPXTime("2013-01-02T12:07:08.123456+02:00", nil)
+	assertNil(t, err)
+	assertEquals(t, parsed.UTC().Format(time.RFC3339Nano), "2013-01-02T10:07:08.123456Z")
+	_, offset := parsed.Zone()
+	assertEquals(t, offset, 7200)
+
+	parsed, err = parseGPXTime("2013-01-02t12:07:08.5z", nil)
+	assertNil(t, err)
+	assertEquals(t, parsed.Location(), time.UTC)
+	assertEquals(t, parsed.Nanosecond(), 500000000)
+
+	parsed, err = parseGPXTime("2013-01-02T12:07:08-0530", nil)
+	assertNil(t, err)
+	assertEquals(t, parsed.UTC().Format(time.RFC3339), "2013-01-02T17:37:08Z")
+
+	location := time.FixedZone("test", -3*3600)
+	parsed, err = parseGPXTime("2013-01-02T12:07:08.25", location)
+	assertNil(t, err)
+	assertEquals(t, parsed.UTC().Format(time.RFC3339Nano), "2013-01-02T15:07:08.25Z")
+}
+
+func TestFormatTime(t *testing.T) {
+	value := time.Date(2013, time.January, 2, 12, 7, 8, 120000000, time.FixedZone("", 3600))
+	whole := time.Date(2013, time.January, 2, 12, 7, 8, 0, time.UTC)
+
+	assertEquals(t, formatGPXTime(&value, ToXmlParams{}), "2013-01-02T11:07:08.12Z")
+	assertEquals(t, formatGPXTime(&whole, ToXmlParams{}), "2013-01-02T12:07:08Z")
+	assertEquals(t, formatGPXTime(&value, ToXmlParams{TimePrecision: 3}), "2013-01-02T11:07:08.120Z")
+	assertEquals(t, formatGPXTime(&whole, ToXmlParams{TimePrecision: 3}), "2013-01-02T12:07:08.000Z")
+	assertEquals(t, formatGPXTime(&value, ToXmlParams{TimePrecision: -1}), "2013-01-02T11:07:08Z")
+	assertEquals(t, formatGPXTime(&value, ToXmlParams{PreserveTimeZone: true}), "2013-01-02T12:07:08.12+01:00")
+	assertEquals(t, formatGPXTime(&whole, ToXmlParams{PreserveTimeZone: true}), "2013-01-02T12:07:08Z")
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	xmlStr := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="test">
+<trk><trkseg>
+<trkpt lat="1" lon="1"><time>2013-01-02T12:07:08.1+02:00</time></trkpt>
+<trkpt lat="1" lon="1"><time>2013-01-02T12:07:08.2+02:00</time></trkpt>
+<trkpt lat="1" lon="1"><time>2013-01-02T12:07:08</time></trkpt>
+</trkseg></trk>
+</gpx>`
+	g, err := ParseStringWithOptions(xmlStr, ParseOptions{DefaultLocation: time.FixedZone("", 7200)})
+	assertNil(t, err)
+	points := g.Tracks[0].Segments[0].Points
+	assertTrue(t, "sub-second ordering kept", points[0].Timestamp.Before(points[1].Timestamp))
+	assertTrue(t, "naive time in the default location", points[2].Timestamp.Equal(time.Date(2013, time.January, 2, 10, 7, 8, 0, time.UTC)))
+
+	xmlBytes, err := g.ToXml(ToXmlParams{PreserveTimeZone: true})
+	assertNil(t, err)
+	assertTrue(t, "offset preserved", strings.Contains(string(xmlBytes), "<time>2013-01-02T12:07:08.2+02:00</time>"))
+	xmlBytes, err = g.ToXml(ToXmlParams{})
+	assertNil(t, err)
+	assertTrue(t, "UTC by default", strings.Contains(string(xmlBytes), "<time>2013-01-02T10:07:08.2Z</time>"))
+}
+
+func TestDetectVersion(t *testing.T) {
+	comment := "<!-- " + strings.Repeat("version=\"1.1\" <gpx ", 100) + "-->"
+	for xmlStr, expected := range map[string]string{
+		"\xef\xbb\xbf<?xml version='1.0'?>" + comment + "<gpx xmlns='http://www.topografix.com/GPX/1/0'></gpx>": "1.0",
+		`<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.0"></gpx>`:                                   "1.1",
+		`<gpx xmlns="http://www.topografix.com/GPX/1/0/" version="1.1"></gpx>`:                                  "1.0",
+		`<gpx version = '1.0' ></gpx>`: "1.0",
+		`<gpx></gpx>`:                  "1.1",
+	} {
+		g, err := ParseString(xmlStr)
+		assertNil(t, err)
+		assertEquals(t, g.Version, expected)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	for _, xmlStr := range []string{
+		`<gpx xmlns="http://www.topografix.com/GPX/1/2" version="1.1"></gpx>`,
+		`<gpx version="2.0"></gpx>`,
+	} {
+		_, err := ParseString(xmlStr)
+		parseError, ok := err.(*ParseError)
+		assertTrue(t, "*ParseError expected", ok)
+		assertEquals(t, parseError.Category, VersionCategory)
+	}
+}
+
+func TestForceVersion(t *testing.T) {
+	xmlStr := `<gpx xmlns="http://www.topografix.com/GPX/1/2" version="1.1"><wpt lat="1" lon="2"><url>u</url></wpt></gpx>`
+	g, err := ParseStringWithOptions(xmlStr, ParseOptions{ForceVersion: "1.0"})
+	assertNil(t, err)
+	assertEquals(t, g.Version, "1.0")
+	assertEquals(t, g.Waypoints[0].Links[0].Href, "u")
+
+	_, err = ParseStringWithOptions(xmlStr, ParseOptions{ForceVersion: "2.0"})
+	assertTrue(t, "invalid forced version", err != nil)
+}
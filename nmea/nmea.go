@@ -0,0 +1,606 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+// Package nmea builds GPX tracks from NMEA 0183 logs.
+package nmea
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+const (
+	knotsToMetersPerSecond = 1852.0 / 3600.0
+	kmhToMetersPerSecond   = 1 / 3.6
+)
+
+// Options contains settings for parsing NMEA logs
+type Options struct {
+	// Lenient skips the invalid sentences (wrong checksums or values)
+	// instead of failing, their errors are in GPX.ParseErrors
+	Lenient bool
+	// Date is used for the times of logs without RMC or ZDA sentences
+	Date time.Time
+}
+
+// Parse reads NMEA 0183 sentences and returns the fixes as a track.
+// See ParseWithOptions.
+func Parse(r io.Reader) (*gpx.GPX, error) {
+	return ParseWithOptions(r, Options{})
+}
+
+// ParseWithOptions reads NMEA 0183 sentences (one per line, lines without
+// sentences are ignored) and returns the fixes as a track.
+//
+// GGA, RMC, GLL and ZDA sentences with the same time are merged into one
+// point, GSA and VTG sentences (which have no time) are merged into the
+// point of the previous sentences. The talker ID isn't checked, so GPS
+// (GP), GLONASS (GL) and combined (GN) sentences are all used. A new
+// segment is started after every fix loss (GGA fix quality 0, RMC or GLL
+// status V or GSA fix mode 1).
+//
+// Sentences must have a valid checksum. The errors are *gpx.ParseError
+// values with the sentence address as Path.
+func ParseWithOptions(r io.Reader, opts Options) (*gpx.GPX, error) {
+	p := &parser{opts: opts, g: &gpx.GPX{Version: "1.1"}}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r\n ")
+		start := strings.IndexByte(line, '$')
+		if start < 0 {
+			continue
+		}
+		fields, err := parseSentence(line[start:])
+		if err == nil {
+			err = p.sentence(fields)
+		}
+		if err != nil {
+			parseError := &gpx.ParseError{
+				Line:     lineNo,
+				Column:   start + 1,
+				Path:     fields[0],
+				Category: gpx.ValueCategory,
+				Err:      err,
+			}
+			if !opts.Lenient {
+				return nil, parseError
+			}
+			p.g.ParseErrors = append(p.g.ParseErrors, parseError)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.flush()
+
+	return p.toGPX(), nil
+}
+
+// parseSentence checks the checksum and splits the sentence into fields,
+// the first is the address (talker ID and sentence type)
+func parseSentence(sentence string) ([]string, error) {
+	end := strings.LastIndexByte(sentence, '*')
+	if end < 0 {
+		return []string{strings.SplitN(sentence[1:], ",", 2)[0]}, errors.New("missing checksum")
+	}
+	body := sentence[1:end]
+	fields := strings.Split(body, ",")
+
+	expected, err := strconv.ParseUint(sentence[end+1:], 16, 8)
+	if err != nil || len(sentence)-end != 3 {
+		return fields, fmt.Errorf("invalid checksum %q", sentence[end+1:])
+	}
+	var checksum byte
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	if checksum != byte(expected) {
+		return fields, fmt.Errorf("wrong checksum %02X, computed %02X", expected, checksum)
+	}
+	return fields, nil
+}
+
+// fix collects the values of the sentences of one position fix
+type fix struct {
+	point     gpx.GPXPoint
+	timeOfDay time.Duration
+	hasTime   bool
+	date      time.Time
+	hasDate   bool
+	// quality is the GGA fix quality and mode the GSA fix mode, 0 if unknown
+	quality     int
+	mode        int
+	hasPosition bool
+	lost        bool
+	// newSegment is set for the first fix after a fix loss
+	newSegment bool
+	seen       map[string]bool
+}
+
+type parser struct {
+	opts  Options
+	g     *gpx.GPX
+	fix   *fix
+	fixes []*fix
+	lost  bool
+}
+
+func (p *parser) sentence(fields []string) error {
+	address := fields[0]
+	// Proprietary sentences start with P, standard ones with the 2 letter talker ID
+	if len(address) != 5 || address[0] == 'P' {
+		return nil
+	}
+	field := func(i int) string {
+		if i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	switch address[2:] {
+	case "GGA":
+		return p.gga(field)
+	case "RMC":
+		return p.rmc(field)
+	case "GSA":
+		return p.gsa(field)
+	case "VTG":
+		return p.vtg(field)
+	case "GLL":
+		return p.gll(field)
+	case "ZDA":
+		return p.zda(field)
+	}
+	return nil
+}
+
+// current returns the fix for a sentence, a new fix is started if the time
+// changed or if the current fix already has a sentence of the same type
+func (p *parser) current(sentenceType string, timeOfDay time.Duration, hasTime bool) *fix {
+	if p.fix != nil && (p.fix.seen[sentenceType] || hasTime && p.fix.hasTime && p.fix.timeOfDay != timeOfDay) {
+		p.flush()
+	}
+	if p.fix == nil {
+		p.fix = &fix{seen: map[string]bool{}}
+	}
+	if hasTime && !p.fix.hasTime {
+		p.fix.timeOfDay = timeOfDay
+		p.fix.hasTime = true
+	}
+	if len(sentenceType) > 0 {
+		p.fix.seen[sentenceType] = true
+	}
+	return p.fix
+}
+
+// flush ends the current fix, fixes without position are ignored
+func (p *parser) flush() {
+	f := p.fix
+	p.fix = nil
+	if f == nil {
+		return
+	}
+	if f.lost {
+		p.lost = true
+		return
+	}
+	if !f.hasPosition {
+		return
+	}
+
+	switch f.quality {
+	case 2, 4, 5:
+		// DGPS and RTK fixes
+		f.point.TypeOfGpsFix = gpx.FixDGPS
+	case 3:
+		f.point.TypeOfGpsFix = gpx.FixPPS
+	default:
+		switch f.mode {
+		case 2:
+			f.point.TypeOfGpsFix = gpx.Fix2D
+		case 3:
+			f.point.TypeOfGpsFix = gpx.Fix3D
+		}
+	}
+
+	f.newSegment = p.lost || len(p.fixes) == 0
+	p.lost = false
+	p.fixes = append(p.fixes, f)
+}
+
+func (p *parser) toGPX() *gpx.GPX {
+	p.setTimestamps()
+	var track *gpx.GPXTrack
+	for _, f := range p.fixes {
+		if track == nil {
+			track = new(gpx.GPXTrack)
+		}
+		if f.newSegment {
+			track.AppendSegment(new(gpx.GPXTrackSegment))
+		}
+		point := f.point
+		track.Segments[len(track.Segments)-1].AppendPoint(&point)
+	}
+	if track != nil {
+		p.g.AppendTrack(track)
+	}
+	return p.g
+}
+
+// setTimestamps adds the dates to the times of the fixes. Fixes without date
+// are on the date of the previous fix (or the next one for fixes before the
+// first date), the date changes when the time of day decreases.
+func (p *parser) setTimestamps() {
+	first := -1
+	for i, f := range p.fixes {
+		if f.hasTime && f.hasDate {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		if p.opts.Date.IsZero() {
+			return
+		}
+		for i, f := range p.fixes {
+			if f.hasTime {
+				first = i
+				year, month, day := p.opts.Date.Date()
+				f.date = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+				break
+			}
+		}
+		if first < 0 {
+			return
+		}
+	}
+
+	date, next := p.fixes[first].date, p.fixes[first].timeOfDay
+	for i := first; i >= 0; i-- {
+		f := p.fixes[i]
+		if !f.hasTime {
+			continue
+		}
+		if f.timeOfDay > next {
+			date = date.AddDate(0, 0, -1)
+		}
+		f.point.Timestamp = date.Add(f.timeOfDay)
+		next = f.timeOfDay
+	}
+
+	date, previous := p.fixes[first].date, p.fixes[first].timeOfDay
+	for _, f := range p.fixes[first:] {
+		if !f.hasTime {
+			continue
+		}
+		if f.hasDate {
+			date = f.date
+		} else if f.timeOfDay < previous {
+			date = date.AddDate(0, 0, 1)
+		}
+		f.point.Timestamp = date.Add(f.timeOfDay)
+		previous = f.timeOfDay
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+type fieldFunc func(i int) string
+
+// gga is the fix time, position, quality, satellites, HDOP and altitude
+func (p *parser) gga(field fieldFunc) error {
+	timeOfDay, hasTime, err := parseTimeOfDay(field(1))
+	if err != nil {
+		return err
+	}
+	lat, lon, hasPosition, err := parsePosition(field(2), field(3), field(4), field(5))
+	if err != nil {
+		return err
+	}
+	quality, err := parseInt(field(6), "fix quality")
+	if err != nil {
+		return err
+	}
+	values, err := parseFloats(field, []floatField{{8, "HDOP"}, {9, "altitude"}, {11, "geoid separation"}, {13, "DGPS age"}})
+	if err != nil {
+		return err
+	}
+	satellites, err := parseInt(field(7), "satellites")
+	if err != nil {
+		return err
+	}
+	station, err := parseInt(field(14), "DGPS station")
+	if err != nil {
+		return err
+	}
+
+	f := p.current("GGA", timeOfDay, hasTime)
+	if quality.NotNull() {
+		f.quality = quality.Value()
+		if f.quality == 0 {
+			f.lost = true
+		}
+	}
+	f.setPosition(lat, lon, hasPosition)
+	setInt(&f.point.Satellites, satellites)
+	setFloat(&f.point.HorizontalDilution, values[8])
+	setFloat(&f.point.Elevation, values[9])
+	setFloat(&f.point.GeoidHeight, values[11])
+	setFloat(&f.point.AgeOfDGpsData, values[13])
+	setInt(&f.point.DGpsId, station)
+	return nil
+}
+
+// rmc is the fix time, date, status, position, speed, course and magnetic
+// variation
+func (p *parser) rmc(field fieldFunc) error {
+	timeOfDay, hasTime, err := parseTimeOfDay(field(1))
+	if err != nil {
+		return err
+	}
+	lat, lon, hasPosition, err := parsePosition(field(3), field(4), field(5), field(6))
+	if err != nil {
+		return err
+	}
+	values, err := parseFloats(field, []floatField{{7, "speed"}, {8, "course"}, {10, "magnetic variation"}})
+	if err != nil {
+		return err
+	}
+	date, hasDate, err := parseDate(field(9))
+	if err != nil {
+		return err
+	}
+
+	f := p.current("RMC", timeOfDay, hasTime)
+	if field(2) == "V" || field(12) == "N" {
+		f.lost = true
+	}
+	f.setPosition(lat, lon, hasPosition)
+	if hasDate && !f.hasDate {
+		f.date, f.hasDate = date, true
+	}
+	if speed := values[7]; speed.NotNull() {
+		f.point.Speed.SetValue(speed.Value() * knotsToMetersPerSecond)
+	}
+	setFloat(&f.point.Course, values[8])
+	if variation := values[10]; variation.NotNull() {
+		// GPX variations are from 0 to 360, west variations are negative in NMEA
+		value := variation.Value()
+		if field(11) == "W" {
+			value = math.Mod(360-value, 360)
+		}
+		f.point.MagneticVariation.SetValue(value)
+	}
+	return nil
+}
+
+// gsa is the fix mode and the dilutions of precision
+func (p *parser) gsa(field fieldFunc) error {
+	mode, err := parseInt(field(2), "fix mode")
+	if err != nil {
+		return err
+	}
+	values, err := parseFloats(field, []floatField{{15, "PDOP"}, {16, "HDOP"}, {17, "VDOP"}})
+	if err != nil {
+		return err
+	}
+
+	// With multiple constellations there is a GSA sentence for each of them
+	f := p.current("", 0, false)
+	if mode.NotNull() {
+		f.mode = mode.Value()
+		if f.mode == 1 {
+			f.lost = true
+		}
+	}
+	setFloat(&f.point.PositionalDilution, values[15])
+	setFloat(&f.point.HorizontalDilution, values[16])
+	setFloat(&f.point.VerticalDilution, values[17])
+	return nil
+}
+
+// vtg is the course and speed
+func (p *parser) vtg(field fieldFunc) error {
+	// NMEA 2.3 VTG sentences have unit fields after the values and a mode
+	course, knots, kmh, mode := 1, 5, 7, field(9)
+	if field(2) != "T" {
+		// Older sentences are only the values
+		course, knots, kmh, mode = 1, 3, 4, ""
+	}
+	values, err := parseFloats(field, []floatField{{course, "course"}, {knots, "speed"}, {kmh, "speed"}})
+	if err != nil {
+		return err
+	}
+
+	f := p.current("VTG", 0, false)
+	if mode == "N" {
+		return nil
+	}
+	setFloat(&f.point.Course, values[course])
+	if speed := values[kmh]; speed.NotNull() {
+		f.point.Speed.SetValue(speed.Value() * kmhToMetersPerSecond)
+	} else if speed := values[knots]; speed.NotNull() {
+		f.point.Speed.SetValue(speed.Value() * knotsToMetersPerSecond)
+	}
+	return nil
+}
+
+// gll is the position, time and status
+func (p *parser) gll(field fieldFunc) error {
+	lat, lon, hasPosition, err := parsePosition(field(1), field(2), field(3), field(4))
+	if err != nil {
+		return err
+	}
+	timeOfDay, hasTime, err := parseTimeOfDay(field(5))
+	if err != nil {
+		return err
+	}
+
+	f := p.current("GLL", timeOfDay, hasTime)
+	if field(6) == "V" || field(7) == "N" {
+		f.lost = true
+	}
+	f.setPosition(lat, lon, hasPosition)
+	return nil
+}
+
+// zda is the time and date
+func (p *parser) zda(field fieldFunc) error {
+	timeOfDay, hasTime, err := parseTimeOfDay(field(1))
+	if err != nil {
+		return err
+	}
+	if len(field(2)) == 0 || len(field(3)) == 0 || len(field(4)) == 0 {
+		p.current("ZDA", timeOfDay, hasTime)
+		return nil
+	}
+	date, err := time.Parse("02 01 2006", fmt.Sprintf("%s %s %s", field(2), field(3), field(4)))
+	if err != nil {
+		return fmt.Errorf("invalid date %s.%s.%s", field(2), field(3), field(4))
+	}
+
+	f := p.current("ZDA", timeOfDay, hasTime)
+	if !f.hasDate {
+		f.date, f.hasDate = date, true
+	}
+	return nil
+}
+
+func (f *fix) setPosition(lat, lon float64, hasPosition bool) {
+	if hasPosition {
+		f.point.Latitude = lat
+		f.point.Longitude = lon
+		f.hasPosition = true
+	}
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+// setFloat sets the value if not null, so that the values of the previous
+// sentences aren't removed
+func setFloat(target *gpx.NullableFloat64, value gpx.NullableFloat64) {
+	if value.NotNull() {
+		target.SetValue(value.Value())
+	}
+}
+
+func setInt(target *gpx.NullableInt, value gpx.NullableInt) {
+	if value.NotNull() {
+		target.SetValue(value.Value())
+	}
+}
+
+// parseTimeOfDay parses a hhmmss.ss UTC time
+func parseTimeOfDay(value string) (time.Duration, bool, error) {
+	if len(value) == 0 {
+		return 0, false, nil
+	}
+	invalid := fmt.Errorf("invalid time %q", value)
+	if len(value) < 6 {
+		return 0, false, invalid
+	}
+	hours, err1 := strconv.Atoi(value[0:2])
+	minutes, err2 := strconv.Atoi(value[2:4])
+	seconds, err3 := strconv.ParseFloat(value[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil || hours > 23 || minutes > 59 || seconds < 0 || seconds >= 61 {
+		return 0, false, invalid
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(math.Round(seconds*1000))*time.Millisecond, true, nil
+}
+
+// parseDate parses a ddmmyy date
+func parseDate(value string) (time.Time, bool, error) {
+	if len(value) == 0 {
+		return time.Time{}, false, nil
+	}
+	date, err := time.Parse("020106", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+	}
+	return date, true, nil
+}
+
+// parsePosition parses the ddmm.mm latitude and dddmm.mm longitude with
+// their hemispheres
+func parsePosition(lat, ns, lon, ew string) (float64, float64, bool, error) {
+	if len(lat) == 0 || len(lon) == 0 {
+		return 0, 0, false, nil
+	}
+	latitude, err := parseCoordinate(lat, ns, "N", "S", 90)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	longitude, err := parseCoordinate(lon, ew, "E", "W", 180)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return latitude, longitude, true, nil
+}
+
+func parseCoordinate(value, hemisphere, positive, negative string, max float64) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || (hemisphere != positive && hemisphere != negative) {
+		return 0, fmt.Errorf("invalid coordinate %q %q", value, hemisphere)
+	}
+	degrees := math.Floor(f / 100)
+	minutes := f - degrees*100
+	result := degrees + minutes/60
+	if minutes >= 60 || result > max {
+		return 0, fmt.Errorf("invalid coordinate %q %q", value, hemisphere)
+	}
+	if hemisphere == negative {
+		result = -result
+	}
+	return result, nil
+}
+
+// floatField is the index of a sentence field and its name (for the errors)
+type floatField struct {
+	index int
+	name  string
+}
+
+// parseFloats parses the fields in the given order, so that the error of the
+// first invalid field is returned. Empty fields are null.
+func parseFloats(field fieldFunc, fields []floatField) (map[int]gpx.NullableFloat64, error) {
+	result := map[int]gpx.NullableFloat64{}
+	for _, f := range fields {
+		var value gpx.NullableFloat64
+		if data := field(f.index); len(data) > 0 {
+			parsed, err := strconv.ParseFloat(data, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", f.name, data)
+			}
+			value.SetValue(parsed)
+		}
+		result[f.index] = value
+	}
+	return result, nil
+}
+
+func parseInt(value string, name string) (gpx.NullableInt, error) {
+	var result gpx.NullableInt
+	if len(value) == 0 {
+		return result, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return result, fmt.Errorf("invalid %s %q", name, value)
+	}
+	result.SetValue(i)
+	return result, nil
+}
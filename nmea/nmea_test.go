@@ -0,0 +1,218 @@
+// Copyright 2013, 2014 Peter Vasil, Tomo Krajina. All
+// rights reserved. Use of this source code is governed
+// by a BSD-style license that can be found in the
+// LICENSE file.
+
+package nmea
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+func cca(x, y float64) bool {
+	return math.Abs(x-y) < 0.001
+}
+
+func assertEquals(t *testing.T, var1 interface{}, var2 interface{}) {
+	if var1 != var2 {
+		t.Errorf("%v not equals to %v", var1, var2)
+	}
+}
+
+func assertTrue(t *testing.T, message string, expr bool) {
+	if !expr {
+		t.Error(message)
+	}
+}
+
+// nmeaLog returns the sentences with their checksums, one per line
+func nmeaLog(sentences ...string) string {
+	var result []string
+	for _, sentence := range sentences {
+		result = append(result, fmt.Sprintf("$%s*%02X", sentence, nmeaChecksum(sentence)))
+	}
+	return strings.Join(result, "\r\n") + "\r\n"
+}
+
+func TestParse(t *testing.T) {
+	log := nmeaLog(
+		"GPGGA,123519.00,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,",
+		"GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1",
+		"GPGSV,2,1,08,01,40,083,46,02,17,308,41,12,07,344,39,14,22,228,45",
+		"GPRMC,123519.00,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W",
+		"GPVTG,084.4,T,087.5,M,022.4,N,041.5,K,A",
+		"GPGGA,123520.00,4807.040,N,01131.010,E,2,09,0.8,546.0,M,46.9,M,1.5,0120",
+		"GPRMC,123520.00,A,4807.040,N,01131.010,E,022.0,085.0,230394,003.1,E",
+		// Fix lost:
+		"GPGGA,123521.00,,,,,0,00,,,M,,M,,",
+		"GPGSA,A,1,,,,,,,,,,,,,,,",
+		"GPRMC,123521.00,V,,,,,,,230394,,",
+		"GPGGA,123530.00,4807.100,S,01131.100,W,1,05,1.9,550.0,M,46.9,M,,",
+		"GPGSA,A,2,04,05,09,,,,,,,,,,3.5,1.9,2.9",
+	)
+	g, err := Parse(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, len(g.Tracks), 1)
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 2)
+
+	p := points[0]
+	assertTrue(t, "latitude", cca(p.Latitude, 48.1173))
+	assertTrue(t, "longitude", cca(p.Longitude, 11.516666))
+	assertEquals(t, p.Elevation.Value(), 545.4)
+	assertEquals(t, p.GeoidHeight.Value(), 46.9)
+	assertEquals(t, p.Timestamp, time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC))
+	assertEquals(t, p.Satellites.Value(), 8)
+	assertEquals(t, p.HorizontalDilution.Value(), 1.3)
+	assertEquals(t, p.VerticalDilution.Value(), 2.1)
+	assertEquals(t, p.PositionalDilution.Value(), 2.5)
+	assertEquals(t, p.TypeOfGpsFix, gpx.Fix3D)
+	// VTG (41.5 km/h) after RMC (22.4 knots)
+	assertTrue(t, "speed", cca(p.Speed.Value(), 41.5/3.6))
+	assertEquals(t, p.Course.Value(), 84.4)
+	assertTrue(t, "magnetic variation", cca(p.MagneticVariation.Value(), 356.9))
+
+	p = points[1]
+	assertEquals(t, p.TypeOfGpsFix, gpx.FixDGPS)
+	assertEquals(t, p.AgeOfDGpsData.Value(), 1.5)
+	assertEquals(t, p.DGpsId.Value(), 120)
+	assertTrue(t, "speed", cca(p.Speed.Value(), 22*1852.0/3600))
+	assertEquals(t, p.MagneticVariation.Value(), 3.1)
+	assertTrue(t, "no VDOP", p.VerticalDilution.Null())
+
+	points = g.Tracks[0].Segments[1].Points
+	assertEquals(t, len(points), 1)
+	p = points[0]
+	assertTrue(t, "latitude", cca(p.Latitude, -48.118333))
+	assertTrue(t, "longitude", cca(p.Longitude, -11.518333))
+	assertEquals(t, p.TypeOfGpsFix, gpx.Fix2D)
+	assertEquals(t, p.Timestamp, time.Date(1994, 3, 23, 12, 35, 30, 0, time.UTC))
+	assertTrue(t, "no speed", p.Speed.Null())
+
+	gpxBytes, err := g.ToXml(gpx.ToXmlParams{Version: "1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, "fix", strings.Contains(string(gpxBytes), "<fix>dgps</fix>"))
+}
+
+func TestParseTalkersAndSentences(t *testing.T) {
+	log := "Logger started\n" +
+		nmeaLog(
+			"GNGLL,5107.0013414,N,11402.3279144,W,205412.00,A,A",
+			"GNVTG,,T,,M,0.5,N,,K,A",
+			"GNGLL,5107.0014000,N,11402.3280000,W,205413.00,A,A",
+			// Older VTG sentences without units
+			"GPVTG,054.7,034.4,005.5,010.2",
+			"PGRME,15.0,M,45.0,M,25.0,M",
+			"GNGLL,5107.0015000,N,11402.3281000,W,205414.00,A,N",
+			"GNGLL,5107.0016000,N,11402.3282000,W,205415.00,A,A",
+		) +
+		// Sentences with a prefix added by the logger
+		"2023-06-01 20:54:16 " + nmeaLog("GNGLL,5107.0017000,N,11402.3283000,W,205416.00,A,A")
+
+	g, err := ParseWithOptions(strings.NewReader(log), Options{Date: time.Date(2023, 6, 1, 22, 0, 0, 0, time.Local)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, len(g.Tracks[0].Segments), 2)
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 2)
+	assertTrue(t, "latitude", cca(points[0].Latitude, 51.116689))
+	assertTrue(t, "longitude", cca(points[0].Longitude, -114.038798))
+	assertTrue(t, "speed", cca(points[0].Speed.Value(), 0.5*1852/3600))
+	assertTrue(t, "speed", cca(points[1].Speed.Value(), 10.2/3.6))
+	assertEquals(t, points[1].Course.Value(), 54.7)
+	assertEquals(t, points[0].Timestamp, time.Date(2023, 6, 1, 20, 54, 12, 0, time.UTC))
+	assertEquals(t, points[0].TypeOfGpsFix, gpx.FixUnknown)
+
+	points = g.Tracks[0].Segments[1].Points
+	assertEquals(t, len(points), 2)
+	assertEquals(t, points[1].Timestamp, time.Date(2023, 6, 1, 20, 54, 16, 0, time.UTC))
+}
+
+func nmeaChecksum(sentence string) byte {
+	var checksum byte
+	for i := 0; i < len(sentence); i++ {
+		checksum ^= sentence[i]
+	}
+	return checksum
+}
+
+func TestParseDates(t *testing.T) {
+	log := nmeaLog(
+		"GPGGA,235958.5,4807.038,N,01131.000,E,1,08,0.9,545.4,M,,,,",
+		"GPGGA,235959.5,4807.038,N,01131.000,E,1,08,0.9,545.4,M,,,,",
+		"GPZDA,000000.5,01,01,2020,00,00",
+		"GPGGA,000000.5,4807.038,N,01131.000,E,1,08,0.9,545.4,M,,,,",
+		"GPGGA,000001.5,4807.038,N,01131.000,E,1,08,0.9,545.4,M,,,,",
+	)
+	g, err := Parse(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := g.Tracks[0].Segments[0].Points
+	assertEquals(t, len(points), 4)
+	assertEquals(t, points[0].Timestamp, time.Date(2019, 12, 31, 23, 59, 58, 5e8, time.UTC))
+	assertEquals(t, points[2].Timestamp, time.Date(2020, 1, 1, 0, 0, 0, 5e8, time.UTC))
+	assertEquals(t, points[3].Timestamp, time.Date(2020, 1, 1, 0, 0, 1, 5e8, time.UTC))
+
+	// Without dates the times are unknown:
+	g, err = Parse(strings.NewReader(nmeaLog("GPGGA,235958.5,4807.038,N,01131.000,E,1,08,0.9,545.4,M,,,,")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(t, "no time", g.Tracks[0].Segments[0].Points[0].Timestamp.IsZero())
+}
+
+func TestParseErrors(t *testing.T) {
+	log := nmeaLog("GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,") +
+		"$GPGGA,123520,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*00\n" +
+		"$GPGGA,123521,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,\n" +
+		nmeaLog("GPGGA,123522,4807.038,X,01131.000,E,1,08,0.9,545.4,M,46.9,M,,") +
+		nmeaLog("GPGGA,123523,4807.038,N,01131.000,E,1,08,0.9,xxx,M,46.9,M,,") +
+		nmeaLog("GPRMC,123524,A,4807.038,N,01131.000,E,022.4,084.4,310294,003.1,W") +
+		nmeaLog("GPGGA,123525,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,")
+
+	_, err := Parse(strings.NewReader(log))
+	parseError, ok := err.(*gpx.ParseError)
+	if !ok {
+		t.Fatalf("Expected a *gpx.ParseError, found %#v", err)
+	}
+	assertEquals(t, parseError.Line, 2)
+	assertEquals(t, parseError.Path, "GPGGA")
+	assertEquals(t, parseError.Category, gpx.ValueCategory)
+
+	g, err := ParseWithOptions(strings.NewReader(log), Options{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, len(g.Tracks[0].Segments[0].Points), 2)
+	assertEquals(t, len(g.ParseErrors), 5)
+	expected := []string{
+		"line 2, column 1, GPGGA: invalid value: wrong checksum 00, computed 4D",
+		"line 3, column 1, GPGGA: invalid value: missing checksum",
+		`line 4, column 1, GPGGA: invalid value: invalid coordinate "4807.038" "X"`,
+		`line 5, column 1, GPGGA: invalid value: invalid altitude "xxx"`,
+		`line 6, column 1, GPRMC: invalid value: invalid date "310294"`,
+	}
+	for i, parseError := range g.ParseErrors {
+		assertEquals(t, parseError.Error(), expected[i])
+	}
+
+	// The first of the invalid fields is reported
+	for i := 0; i < 10; i++ {
+		_, err = Parse(strings.NewReader(nmeaLog("GPGGA,123519,4807.038,N,01131.000,E,1,08,a,b,M,c,M,d,")))
+		assertEquals(t, err.Error(), `line 1, column 1, GPGGA: invalid value: invalid HDOP "a"`)
+	}
+}